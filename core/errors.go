@@ -2,15 +2,19 @@ package core
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/lib/pq"
 )
 
+// Deprecated: коды WrapError, используйте виды ошибок Err* и Error
 const (
 	SuccessCompleted = iota + 100
 	SystemError
 	ForeignKeyError
 )
 
+// Deprecated: используйте Error
 type WrapError struct {
 	Err  error
 	Code int
@@ -20,14 +24,160 @@ func (w *WrapError) Error() string {
 	return w.Err.Error()
 }
 
+// Виды ошибок операций хранилища, проверяются через errors.Is
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrConflict          = errors.New("conflict")
+	ErrReferenced        = errors.New("referenced by other entities")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrCellBlocked       = errors.New("cell is blocked")        // ячейка закрыта для размещения (NotAllowedIn) или отбора (NotAllowedOut)
+	ErrCapacityExceeded  = errors.New("cell capacity exceeded") // превышен допустимый вес (MaxWeight) или объем (MaxVolume) ячейки
+	ErrValidation        = errors.New("validation failed")
+)
+
+// Error ошибка операции над сущностью Entity (имя таблицы: "products", "cells" ...) с идентификатором Id
+// errors.Is(err, Kind) истинно, исходная ошибка базы данных (Err) доступна через errors.Is/As
+type Error struct {
+	Kind   error  // вид ошибки, одна из Err*
+	Entity string // сущность, пустая строка - ошибка не относится к конкретной сущности
+	Id     int64  // идентификатор сущности, 0 - не известен
+	Msg    string // описание, по умолчанию - текст Kind
+	Err    error  // исходная ошибка
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = e.Kind.Error()
+	}
+	switch {
+	case e.Entity != "" && e.Id != 0:
+		return fmt.Sprintf("%s %d: %s", e.Entity, e.Id, msg)
+	case e.Entity != "":
+		return e.Entity + ": " + msg
+	}
+	return msg
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StockError недостаточно остатка продукта ProductId в ячейке CellId склада WhsId, errors.Is(err, ErrInsufficientStock)
+type StockError struct {
+	WhsId     int64
+	CellId    int64
+	ProductId int64
+	Lot       string // партия, остаток которой недостаточен ("" - общий остаток продукта)
+	Balance   int    // остаток после операции (отрицательный)
+}
+
+func (e *StockError) Error() string {
+	if e.Lot != "" {
+		return fmt.Sprintf("insufficient stock of product %d lot %s in cell %d: balance %d", e.ProductId, e.Lot, e.CellId, e.Balance)
+	}
+	return fmt.Sprintf("insufficient stock of product %d in cell %d: balance %d", e.ProductId, e.CellId, e.Balance)
+}
+
+func (e *StockError) Is(target error) bool {
+	return target == ErrInsufficientStock
+}
+
+// NotFound запись entity с идентификатором id не найдена
+// Исходная ошибка sql.ErrNoRows сохраняется, errors.Is(err, sql.ErrNoRows) остается истинным
+func NotFound(entity string, id int64) error {
+	return &Error{Kind: ErrNotFound, Entity: entity, Id: id, Err: sql.ErrNoRows}
+}
+
+// Validation недопустимые параметры операции над entity
+func Validation(entity string, id int64, format string, args ...any) error {
+	return &Error{Kind: ErrValidation, Entity: entity, Id: id, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Conflict операция противоречит текущему состоянию записи entity
+func Conflict(entity string, id int64, format string, args ...any) error {
+	return &Error{Kind: ErrConflict, Entity: entity, Id: id, Msg: fmt.Sprintf(format, args...)}
+}
+
+// CellBlocked ячейка cellId закрыта для размещения или отбора
+func CellBlocked(cellId int64, format string, args ...any) error {
+	return &Error{Kind: ErrCellBlocked, Entity: "cells", Id: cellId, Msg: fmt.Sprintf(format, args...)}
+}
+
+// CapacityExceeded размещение превышает допустимый вес или объем ячейки cellId
+func CapacityExceeded(cellId int64, format string, args ...any) error {
+	return &Error{Kind: ErrCapacityExceeded, Entity: "cells", Id: cellId, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Коды ошибок ограничений SQLite (расширенные коды modernc.org/sqlite)
+const (
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// Translate приводит ошибку базы данных операции над записью entity (id) к виду Err*:
+// sql.ErrNoRows - ErrNotFound, нарушение уникальности - ErrConflict, нарушение внешнего ключа - ErrReferenced
+// Прочие ошибки (и nil) возвращаются без изменений
+func Translate(entity string, id int64, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Kind: ErrNotFound, Entity: entity, Id: id, Err: err}
+	}
+	switch {
+	case ErrForeignKey(err):
+		return &Error{Kind: ErrReferenced, Entity: entity, Id: id, Msg: referencedMsg(err), Err: err}
+	case errUnique(err):
+		return &Error{Kind: ErrConflict, Entity: entity, Id: id, Msg: "duplicate " + entity, Err: err}
+	}
+	return err
+}
+
+func referencedMsg(err error) string {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) && pgErr.Table != "" {
+		return "referenced by " + pgErr.Table
+	}
+	return ErrReferenced.Error()
+}
+
 func ErrNoRows(err error) bool {
-	return err == sql.ErrNoRows
+	return errors.Is(err, sql.ErrNoRows)
 }
 
+// ErrForeignKey нарушение внешнего ключа (PostgreSQL или SQLite)
 func ErrForeignKey(err error) bool {
-	if pgErr, isPgErr := err.(*pq.Error); isPgErr {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
 		return pgErr.Code == "23503"
-	} else {
-		return false
 	}
+	return sqliteCode(err) == sqliteConstraintForeignKey
+}
+
+func errUnique(err error) bool {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	code := sqliteCode(err)
+	return code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey
+}
+
+// sqliteCode код ошибки драйвера SQLite без зависимости от него
+func sqliteCode(err error) int {
+	var coded interface{ Code() int }
+	if errors.As(err, &coded) {
+		return coded.Code()
+	}
+	return 0
 }
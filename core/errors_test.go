@@ -0,0 +1,64 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"testing"
+)
+
+// codedError ошибка драйвера SQLite с кодом результата
+type codedError int
+
+func (e codedError) Error() string { return fmt.Sprintf("sqlite error %d", int(e)) }
+func (e codedError) Code() int     { return int(e) }
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+		msg  string
+	}{
+		{"no rows", sql.ErrNoRows, ErrNotFound, "products 7: not found"},
+		{"pq foreign key", &pq.Error{Code: "23503", Table: "barcodes"}, ErrReferenced, "products 7: referenced by barcodes"},
+		{"pq unique", &pq.Error{Code: "23505"}, ErrConflict, "products 7: duplicate products"},
+		{"sqlite foreign key", fmt.Errorf("exec: %w", codedError(sqliteConstraintForeignKey)), ErrReferenced, "products 7: referenced by other entities"},
+		{"sqlite unique", codedError(sqliteConstraintUnique), ErrConflict, "products 7: duplicate products"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Translate("products", 7, tt.err)
+			if !errors.Is(err, tt.kind) || !errors.Is(err, tt.err) {
+				t.Errorf("Translate = %v, want kind %v wrapping %v", err, tt.kind, tt.err)
+			}
+			if err.Error() != tt.msg {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.msg)
+			}
+		})
+	}
+
+	other := errors.New("connection refused")
+	if err := Translate("products", 7, other); err != other {
+		t.Errorf("Translate of other error = %v, want unchanged", err)
+	}
+	if err := Translate("products", 7, nil); err != nil {
+		t.Errorf("Translate(nil) = %v", err)
+	}
+	typed := Validation("cells", 1, "bad")
+	if err := Translate("products", 7, typed); err != typed {
+		t.Errorf("Translate of typed error = %v, want unchanged", err)
+	}
+}
+
+func TestStockError(t *testing.T) {
+	err := fmt.Errorf("pick: %w", &StockError{WhsId: 1, CellId: 2, ProductId: 3, Balance: -4})
+	var se *StockError
+	if !errors.Is(err, ErrInsufficientStock) || !errors.As(err, &se) || se.CellId != 2 || se.ProductId != 3 {
+		t.Errorf("StockError is not matched: %v", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("StockError matches ErrNotFound")
+	}
+}
@@ -0,0 +1,41 @@
+package whs
+
+import (
+	"context"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+type actorCtx struct{}
+
+// WithActor возвращает контекст операций, выполняемых пользователем actor.User с терминала actor.Terminal
+// Пользователь и терминал записываются в строки ledger, волны и журнал аудита
+func WithActor(ctx context.Context, actor model.Actor) context.Context {
+	return context.WithValue(ctx, actorCtx{}, actor)
+}
+
+// WithUser возвращает контекст операций, выполняемых пользователем user без указания терминала, см. WithActor
+func WithUser(ctx context.Context, user model.User) context.Context {
+	return WithActor(ctx, model.Actor{User: user})
+}
+
+// ActorFrom возвращает пользователя и терминал контекста, false - пользователь не задан
+// Используется, в том числе, для проверки прав пользователя на операцию
+func ActorFrom(ctx context.Context) (model.Actor, bool) {
+	actor, ok := ctx.Value(actorCtx{}).(model.Actor)
+	return actor, ok
+}
+
+// CheckActor проверяет длину идентификатора терминала
+func CheckActor(actor model.Actor) error {
+	if len(actor.Terminal) > model.MaxTerminalLen {
+		return core.Validation("", 0, "terminal id is longer than %d bytes", model.MaxTerminalLen)
+	}
+	return nil
+}
+
+// actorOf возвращает id пользователя и терминал контекста для записи в БД
+func actorOf(ctx context.Context) (int64, string, error) {
+	actor, _ := ActorFrom(ctx)
+	return actor.User.Id, actor.Terminal, CheckActor(actor)
+}
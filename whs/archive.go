@@ -0,0 +1,258 @@
+package whs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+// entityTables таблицы архивируемых справочников по типу сущности (model.Entity*)
+var entityTables = map[string]string{
+	model.EntityProduct:      "products",
+	model.EntityManufacturer: tableManufacturers,
+	model.EntityWarehouse:    tableWarehouses,
+	model.EntityUser:         tableUsers,
+}
+
+// archivable таблицы с колонкой archived_at, архивные записи исключаются из списков и подсказок
+var archivable = map[string]bool{
+	"products":         true,
+	tableManufacturers: true,
+	tableWarehouses:    true,
+	tableUsers:         true,
+}
+
+func entityTable(entity string) (string, error) {
+	table, ok := entityTables[entity]
+	if !ok {
+		return "", core.Validation("", 0, "entity %q can not be archived", entity)
+	}
+	return table, nil
+}
+
+// Archive переносит запись справочника entity (model.Entity*) в архив
+// Архивная запись не попадает в списки и подсказки, но доступна по id и в ссылающихся документах
+func (s *Storage) Archive(ctx context.Context, entity string, id int64) error {
+	return s.setArchived(ctx, entity, model.AuditArchive, id, fmt.Sprintf("coalesce(archived_at, %s)", s.wms.now()))
+}
+
+// Restore возвращает запись справочника entity из архива
+func (s *Storage) Restore(ctx context.Context, entity string, id int64) error {
+	return s.setArchived(ctx, entity, model.AuditRestore, id, "NULL")
+}
+
+func (s *Storage) setArchived(ctx context.Context, entity string, action string, id int64, value string) error {
+	table, err := entityTable(entity)
+	if err != nil {
+		return err
+	}
+	_, err = s.audited(ctx, entity, action, id, func(s *Storage) (int64, error) {
+		sqlUpd := fmt.Sprintf("UPDATE %s SET archived_at = %s, version = version + 1 WHERE id = $1", table, value)
+		res, err := s.db().ExecContext(ctx, sqlUpd, id)
+		if err != nil {
+			return 0, err
+		}
+		if a, err := res.RowsAffected(); err != nil || a == 0 {
+			if err == nil {
+				err = core.NotFound(table, id)
+			}
+			return 0, err
+		}
+		return id, nil
+	})
+	return err
+}
+
+// GetArchived возвращает архивные записи справочника entity
+func (s *Storage) GetArchived(ctx context.Context, entity string) ([]model.ArchivedItem, error) {
+	table, err := entityTable(entity)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]model.ArchivedItem, 0)
+	sqlSel := fmt.Sprintf("SELECT id, name, archived_at FROM %s WHERE archived_at IS NOT NULL ORDER BY name, id", table)
+	rows, err := s.db().QueryContext(ctx, sqlSel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := model.ArchivedItem{Entity: entity}
+		if err = rows.Scan(&item.Id, &item.Name, scanTime(&item.ArchivedAt)); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetDependencies возвращает записи, ссылающиеся на запись справочника entity с идентификатором id:
+// остатки и документы (ledger) складов, штрих-коды, продукты производителя, ячейки и волны склада
+// Запись с зависимостями не может быть удалена, ее можно перенести в архив (Archive)
+func (s *Storage) GetDependencies(ctx context.Context, entity string, id int64) (*model.DependencyReport, error) {
+	table, err := entityTable(entity)
+	if err != nil {
+		return nil, err
+	}
+	var found int64
+	sqlSel := fmt.Sprintf("SELECT id FROM %s WHERE id = $1%s", table, s.wms.forUpdate())
+	if err = s.db().QueryRowContext(ctx, sqlSel, id).Scan(&found); err != nil {
+		return nil, core.Translate(table, id, err)
+	}
+
+	report := &model.DependencyReport{Entity: entity, Id: id, Dependencies: make([]model.Dependency, 0)}
+	add := func(kind string, whsId int64, query string, args ...any) error {
+		ids, err := s.queryIds(ctx, query, args...)
+		if err == nil {
+			report.Add(model.Dependency{Kind: kind, WhsId: whsId, Count: int64(len(ids)), Ids: ids})
+		}
+		return err
+	}
+	count := func(kind string, whsId int64, query string, args ...any) error {
+		d := model.Dependency{Kind: kind, WhsId: whsId}
+		err := s.db().QueryRowContext(ctx, query, args...).Scan(&d.Count)
+		if err == nil {
+			report.Add(d)
+		}
+		return err
+	}
+	whsIds, err := s.queryIds(ctx, fmt.Sprintf("SELECT id FROM %s ORDER BY id", tableWarehouses))
+	if err != nil {
+		return nil, err
+	}
+
+	switch entity {
+	case model.EntityProduct:
+		err = add(model.DependencyBarcodes, 0, fmt.Sprintf("SELECT id FROM %s WHERE owner_ref = 'products' AND owner_id = $1 ORDER BY id", tableBarcodes), id)
+		if err == nil {
+			err = add(model.DependencyPickFaces, 0, fmt.Sprintf("SELECT cell_id FROM %s WHERE prod_id = $1 ORDER BY cell_id", tablePickFaces), id)
+		}
+		for _, whsId := range whsIds {
+			if err == nil {
+				err = add(model.DependencyStock, whsId, fmt.Sprintf("SELECT cell_id FROM storage%d WHERE prod_id = $1 "+
+					"GROUP BY cell_id HAVING SUM(quantity) <> 0 ORDER BY cell_id", whsId), id)
+			}
+			if err == nil {
+				err = count(model.DependencyDocuments, whsId, fmt.Sprintf("SELECT count(*) FROM storage%d WHERE prod_id = $1", whsId), id)
+			}
+		}
+	case model.EntityManufacturer:
+		err = add(model.DependencyProducts, 0, "SELECT id FROM products WHERE manufacturer_id = $1 ORDER BY id", id)
+		if err == nil {
+			err = add(model.DependencyBarcodes, 0, fmt.Sprintf("SELECT id FROM %s WHERE owner_ref = $2 AND owner_id = $1 ORDER BY id", tableBarcodes), id, tableManufacturers)
+		}
+	case model.EntityWarehouse:
+		err = add(model.DependencyCells, id, fmt.Sprintf("SELECT id FROM %s WHERE whs_id = $1 ORDER BY id", tableCells), id)
+		if err == nil {
+			err = add(model.DependencyStock, id, fmt.Sprintf("SELECT DISTINCT cell_id FROM (SELECT cell_id FROM storage%d "+
+				"GROUP BY cell_id, prod_id HAVING SUM(quantity) <> 0) st ORDER BY cell_id", id))
+		}
+		if err == nil {
+			err = count(model.DependencyDocuments, id, fmt.Sprintf("SELECT count(*) FROM storage%d", id))
+		}
+		if err == nil {
+			err = add(model.DependencyWaves, id, fmt.Sprintf("SELECT id FROM %s WHERE whs_id = $1 ORDER BY id", tableWaves), id)
+		}
+	case model.EntityUser:
+		for _, whsId := range whsIds {
+			if err == nil {
+				err = count(model.DependencyDocuments, whsId, fmt.Sprintf("SELECT count(*) FROM storage%d WHERE user_id = $1", whsId), id)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// queryIds возвращает идентификаторы, выбранные запросом query
+func (s *Storage) queryIds(ctx context.Context, query string, args ...any) ([]int64, error) {
+	rows, err := s.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// deleteEntity удаляет запись справочника entity, если на нее ничего не ссылается
+// Иначе возвращает ошибку core.ErrReferenced с перечнем зависимостей. Удаление отсутствующей записи не является ошибкой
+func (s *Storage) deleteEntity(ctx context.Context, entity string, id int64) error {
+	table, err := entityTable(entity)
+	if err != nil {
+		return err
+	}
+	return s.unit(ctx, func(s *Storage) error {
+		report, err := s.GetDependencies(ctx, entity, id)
+		if errors.Is(err, core.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !report.Empty() {
+			return &core.Error{Kind: core.ErrReferenced, Entity: table, Id: id, Msg: "referenced by " + report.String()}
+		}
+		before, err := auditReaders[entity](s, ctx, id)
+		if err != nil {
+			return err
+		}
+		if err = s.deleteReferences(ctx, entity, id); err != nil {
+			return err
+		}
+		_, err = s.db().ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = $1", table), id)
+		if err == nil && entity == model.EntityWarehouse {
+			// ledger склада без документов пуст
+			_, err = s.db().ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS storage%d", id))
+		}
+		if err != nil {
+			return core.Translate(table, id, err)
+		}
+		return s.audit(ctx, entity, model.AuditDelete, id, before, nil)
+	})
+}
+
+// deleteReferences удаляет сведения об удаляемой записи entity с id, которые не препятствуют удалению:
+// внешние идентификаторы записи и классы ABC/XYZ продукта или склада. Удаления записываются в журнал аудита
+func (s *Storage) deleteReferences(ctx context.Context, entity string, id int64) error {
+	exts, err := s.GetExternalIds(ctx, entity, id)
+	if err != nil {
+		return err
+	}
+	for i := range exts {
+		if err = s.audit(ctx, model.EntityExternalId, model.AuditDelete, id, &exts[i], nil); err != nil {
+			return err
+		}
+	}
+	sqlDel := fmt.Sprintf("DELETE FROM %s WHERE entity = $1 AND id = $2", tableExternalIds)
+	if _, err = s.db().ExecContext(ctx, sqlDel, entity, id); err != nil {
+		return err
+	}
+
+	column := map[string]string{model.EntityProduct: "prod_id", model.EntityWarehouse: "whs_id"}[entity]
+	if column == "" {
+		return nil
+	}
+	classes, err := s.productClasses(ctx, column, id)
+	if err != nil {
+		return err
+	}
+	for i := range classes {
+		if err = s.audit(ctx, model.EntityProductClass, model.AuditDelete, classes[i].ProductId, &classes[i], nil); err != nil {
+			return err
+		}
+	}
+	_, err = s.db().ExecContext(ctx, fmt.Sprintf("DELETE FROM product_classes WHERE %s = $1", column), id)
+	return err
+}
@@ -0,0 +1,176 @@
+package whs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"strings"
+)
+
+const tableAudit = "audit_log"
+
+// auditRead читает запись сущности журнала аудита, отсутствующая запись - nil
+type auditRead func(s *Storage, ctx context.Context, id int64) (any, error)
+
+// auditReader приводит метод чтения записи по id к auditRead
+func auditReader[T any](get func(s *Storage, ctx context.Context, id int64) (*T, error)) auditRead {
+	return func(s *Storage, ctx context.Context, id int64) (any, error) {
+		item, err := get(s, ctx, id)
+		if errors.Is(err, core.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+}
+
+// auditReaders чтение записей сущностей, изменения которых записываются в журнал аудита
+var auditReaders = map[string]auditRead{
+	model.EntityProduct:      auditReader((*Storage).GetProductById),
+	model.EntityManufacturer: auditReader((*Storage).GetManufacturerById),
+	model.EntityBarcode:      auditReader((*Storage).GetBarcodeById),
+	model.EntityWarehouse:    auditReader((*Storage).GetWarehouseById),
+	model.EntityUser:         auditReader((*Storage).GetUserById),
+	model.EntityCell:         auditReader((*Storage).GetCellById),
+}
+
+// audited выполняет изменение op записи id сущности entity в единице работы и записывает его в журнал аудита
+// id 0 - создаваемая запись; op возвращает id измененной записи, 0 - запись не изменена
+func (s *Storage) audited(ctx context.Context, entity string, action string, id int64, op func(s *Storage) (int64, error)) (int64, error) {
+	// недопустимый пользователь/терминал отклоняет изменение до его выполнения
+	if _, _, err := actorOf(ctx); err != nil {
+		return 0, err
+	}
+	var resId int64
+	err := s.unit(ctx, func(s *Storage) error {
+		var before any
+		var err error
+		if id != 0 {
+			if before, err = auditReaders[entity](s, ctx, id); err != nil {
+				return err
+			}
+		}
+		if resId, err = op(s); err != nil || resId == 0 {
+			return err
+		}
+		return s.auditAfter(ctx, entity, action, resId, before)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resId, nil
+}
+
+// created создает запись сущности entity по данным request с записью в журнал аудита (см. audited)
+// с учетом ключа идемпотентности контекста: повторный вызов с тем же ключом возвращает id созданной записи
+func (s *Storage) created(ctx context.Context, entity string, request any, op func(s *Storage) (int64, error)) (int64, error) {
+	return idempotent(s, ctx, "create "+entity, request, func(ctx context.Context, s *Storage) (int64, error) {
+		return s.audited(ctx, entity, model.AuditCreate, 0, op)
+	})
+}
+
+// auditAfter записывает в журнал изменение записи id сущности entity из состояния before в текущее
+func (s *Storage) auditAfter(ctx context.Context, entity string, action string, id int64, before any) error {
+	after, err := auditReaders[entity](s, ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.audit(ctx, entity, action, id, before, after)
+}
+
+// auditAction действие журнала для изменения записи: existed - запись была до изменения, exists - есть после него
+func auditAction(existed, exists bool) string {
+	switch {
+	case !exists:
+		return model.AuditDelete
+	case !existed:
+		return model.AuditCreate
+	}
+	return model.AuditUpdate
+}
+
+// audit записывает в журнал изменение записи id сущности entity из состояния before в after (nil - запись отсутствует)
+// Изменение без различий в полях записи не записывается
+func (s *Storage) audit(ctx context.Context, entity string, action string, id int64, before, after any) error {
+	changes, err := model.AuditDiff(before, after)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	userId, terminal, err := actorOf(ctx)
+	if err != nil {
+		return err
+	}
+	sqlIns := fmt.Sprintf("INSERT INTO %s (entity, entity_id, action, changes, user_id, terminal) VALUES ($1, $2, $3, $4, $5, $6)", tableAudit)
+	_, err = s.db().ExecContext(ctx, sqlIns, entity, id, action, string(data), userId, terminal)
+	return err
+}
+
+// GetAuditLog возвращает записи журнала аудита по отбору filter, последние изменения первыми
+// Без ограничения filter.Limit возвращается не более DefaultRowsLimit записей, более ранние записи
+// выбираются следующими страницами (filter.BeforeId - id последней записи предыдущей страницы)
+func (s *Storage) GetAuditLog(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	conds := make([]string, 0)
+	args := make([]any, 0)
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.Entity != "" {
+		where("entity = $%d", filter.Entity)
+	}
+	if filter.EntityId != 0 {
+		where("entity_id = $%d", filter.EntityId)
+	}
+	if filter.UserId != 0 {
+		where("user_id = $%d", filter.UserId)
+	}
+	if !filter.From.IsZero() {
+		where("created_at >= $%d", s.wms.timeArg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where("created_at < $%d", s.wms.timeArg(filter.To))
+	}
+	if filter.BeforeId != 0 {
+		where("id < $%d", filter.BeforeId)
+	}
+	sqlCond := ""
+	if len(conds) > 0 {
+		sqlCond = "WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultRowsLimit
+	}
+	args = append(args, limit)
+	sqlSel := fmt.Sprintf("SELECT id, entity, entity_id, action, changes, user_id, terminal, created_at FROM %s %s ORDER BY id DESC LIMIT $%d",
+		tableAudit, sqlCond, len(args))
+
+	items := make([]model.AuditEntry, 0)
+	rows, err := s.db().QueryContext(ctx, sqlSel, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e model.AuditEntry
+		var changes []byte
+		err = rows.Scan(&e.Id, &e.Entity, &e.EntityId, &e.Action, &changes, &e.UserId, &e.Terminal, scanTime(&e.CreatedAt))
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, err
+		}
+		items = append(items, e)
+	}
+	return items, rows.Err()
+}
@@ -2,9 +2,8 @@ package whs
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"github.com/lib/pq"
+	"github.com/mlplabs/mwms-core/core"
 	"github.com/mlplabs/mwms-core/whs/model"
 )
 
@@ -13,9 +12,9 @@ const tableBarcodes = "barcodes"
 // GetBarcodes returns a list of barcodes
 func (s *Storage) GetBarcodes(ctx context.Context) ([]model.Barcode, error) {
 	items := make([]model.Barcode, 0)
-	sqlSel := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref FROM %s ORDER BY name ASC", tableBarcodes)
+	sqlSel := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref, version FROM %s ORDER BY name ASC", tableBarcodes)
 
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel)
+	rows, err := s.db().QueryContext(ctx, sqlSel)
 	if err != nil {
 		return items, err
 	}
@@ -23,7 +22,7 @@ func (s *Storage) GetBarcodes(ctx context.Context) ([]model.Barcode, error) {
 
 	for rows.Next() {
 		bc := model.Barcode{}
-		err = rows.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef)
+		err = rows.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef, &bc.Version)
 		items = append(items, bc)
 	}
 	return items, nil
@@ -43,9 +42,9 @@ func (s *Storage) GetBarcodesItems(ctx context.Context, offset int, limit int) (
 	args = append(args, limit)
 	args = append(args, offset)
 
-	sqlSel := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref FROM %s %s ORDER BY name ASC", tableBarcodes, sqlCond)
+	sqlSel := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref, version FROM %s %s ORDER BY name ASC", tableBarcodes, sqlCond)
 
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel+" LIMIT $1 OFFSET $2", args...)
+	rows, err := s.db().QueryContext(ctx, sqlSel+" LIMIT $1 OFFSET $2", args...)
 	if err != nil {
 		return items, totalCount, err
 	}
@@ -53,12 +52,12 @@ func (s *Storage) GetBarcodesItems(ctx context.Context, offset int, limit int) (
 
 	for rows.Next() {
 		bc := model.Barcode{}
-		err = rows.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef)
+		err = rows.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef, &bc.Version)
 		items = append(items, bc)
 	}
 
 	sqlCount := fmt.Sprintf("SELECT COUNT(*) as count FROM ( %s ) sub", sqlSel)
-	err = s.wms.Db.QueryRowContext(ctx, sqlCount).Scan(&totalCount)
+	err = s.db().QueryRowContext(ctx, sqlCount).Scan(&totalCount)
 	if err != nil {
 		return items, totalCount, err
 	}
@@ -81,9 +80,9 @@ func (s *Storage) GetBarcodesItemsByOwner(ctx context.Context, offset int, limit
 	args = append(args, limit)
 	args = append(args, offset)
 
-	sqlSel := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref FROM %s %s ORDER BY name ASC", tableBarcodes, sqlCond)
+	sqlSel := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref, version FROM %s %s ORDER BY name ASC", tableBarcodes, sqlCond)
 
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel+" LIMIT $3 OFFSET $4", args...)
+	rows, err := s.db().QueryContext(ctx, sqlSel+" LIMIT $3 OFFSET $4", args...)
 	if err != nil {
 		return items, totalCount, err
 	}
@@ -91,12 +90,12 @@ func (s *Storage) GetBarcodesItemsByOwner(ctx context.Context, offset int, limit
 
 	for rows.Next() {
 		bc := model.Barcode{}
-		err = rows.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef)
+		err = rows.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef, &bc.Version)
 		items = append(items, bc)
 	}
 
 	sqlCount := fmt.Sprintf("SELECT COUNT(*) as count FROM ( %s ) sub", sqlSel)
-	err = s.wms.Db.QueryRow(sqlCount, args[:2]...).Scan(&totalCount)
+	err = s.db().QueryRowContext(ctx, sqlCount, args[:2]...).Scan(&totalCount)
 	if err != nil {
 		return items, totalCount, err
 	}
@@ -104,9 +103,15 @@ func (s *Storage) GetBarcodesItemsByOwner(ctx context.Context, offset int, limit
 }
 
 func (s *Storage) CreateBarcode(ctx context.Context, bc *model.Barcode) (int64, error) {
+	return s.created(ctx, model.EntityBarcode, bc, func(s *Storage) (int64, error) {
+		return s.createBarcode(ctx, bc)
+	})
+}
+
+func (s *Storage) createBarcode(ctx context.Context, bc *model.Barcode) (int64, error) {
 	var insertId int64
 	sqlCreate := fmt.Sprintf("INSERT INTO %s (name, barcode_type, owner_id, owner_ref) VALUES ($1, $2, $3, $4) RETURNING id", tableBarcodes)
-	err := s.wms.Db.QueryRowContext(ctx, sqlCreate, bc.Name, bc.Type, bc.OwnerId, bc.OwnerRef).Scan(&insertId)
+	err := s.db().QueryRowContext(ctx, sqlCreate, bc.Name, bc.Type, bc.OwnerId, bc.OwnerRef).Scan(&insertId)
 	if err != nil {
 		return insertId, err
 	}
@@ -114,57 +119,57 @@ func (s *Storage) CreateBarcode(ctx context.Context, bc *model.Barcode) (int64,
 }
 
 func (s *Storage) UpdateBarcode(ctx context.Context, bc *model.Barcode) (int64, error) {
-	sqlUpd := fmt.Sprintf("UPDATE %s SET name=$2, barcode_type=$3, owner_id=$4, owner_ref=$5 WHERE id=$1", tableBarcodes)
-	res, err := s.wms.Db.ExecContext(ctx, sqlUpd, bc.Id, bc.Name, bc.Type, bc.OwnerId, bc.OwnerRef)
-	if err != nil {
+	if err := CheckVersion(tableBarcodes, bc.Id, bc.Version); err != nil {
 		return 0, err
 	}
-	if a, err := res.RowsAffected(); a != 1 || err != nil {
+	return s.audited(ctx, model.EntityBarcode, model.AuditUpdate, bc.Id, func(s *Storage) (int64, error) {
+		return s.updateBarcode(ctx, bc)
+	})
+}
+
+func (s *Storage) updateBarcode(ctx context.Context, bc *model.Barcode) (int64, error) {
+	sqlUpd := fmt.Sprintf("UPDATE %s SET name=$2, barcode_type=$3, owner_id=$4, owner_ref=$5, version=version+1 WHERE id=$1 AND %s", tableBarcodes, versionCond(6))
+	res, err := s.db().ExecContext(ctx, sqlUpd, bc.Id, bc.Name, bc.Type, bc.OwnerId, bc.OwnerRef, bc.Version)
+	if err != nil {
 		return 0, err
 	}
-	return bc.Id, nil
+	return s.updated(ctx, res, tableBarcodes, bc.Id, bc.Version)
 }
 
 func (s *Storage) DeleteBarcode(ctx context.Context, itemId int64) error {
 	if itemId == 0 {
-		return fmt.Errorf("unacceptable action. item id eq 0")
-	}
-	sqlDel := fmt.Sprintf("DELETE FROM %s WHERE id=$1", tableBarcodes)
-	_, err := s.wms.Db.ExecContext(ctx, sqlDel, itemId)
-	if err != nil {
-		var pgErr *pq.Error
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == ("23503") {
-				return err
-			}
-		}
-		return err
-	}
-	return nil
+		return core.Validation(tableBarcodes, 0, "unacceptable action. item id eq 0")
+	}
+	_, err := s.audited(ctx, model.EntityBarcode, model.AuditDelete, itemId, func(s *Storage) (int64, error) {
+		sqlDel := fmt.Sprintf("DELETE FROM %s WHERE id=$1", tableBarcodes)
+		_, err := s.db().ExecContext(ctx, sqlDel, itemId)
+		return itemId, core.Translate(tableBarcodes, itemId, err)
+	})
+	return err
 }
 
 func (s *Storage) GetBarcodeById(ctx context.Context, itemId int64) (*model.Barcode, error) {
-	sqlUsr := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref FROM %s WHERE id = $1", tableBarcodes)
-	row := s.wms.Db.QueryRowContext(ctx, sqlUsr, itemId)
+	sqlUsr := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref, version FROM %s WHERE id = $1", tableBarcodes)
+	row := s.db().QueryRowContext(ctx, sqlUsr, itemId)
 	bc := model.Barcode{}
-	err := row.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef)
+	err := row.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef, &bc.Version)
 	if err != nil {
-		return nil, err
+		return nil, core.Translate(tableBarcodes, itemId, err)
 	}
 	return &bc, nil
 }
 
 func (s *Storage) FindBarcodesByName(ctx context.Context, itemName string) ([]model.Barcode, error) {
 	items := make([]model.Barcode, 0)
-	sql := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref FROM %s WHERE name = $1", tableBarcodes)
-	rows, err := s.wms.Db.QueryContext(ctx, sql, itemName)
+	sql := fmt.Sprintf("SELECT id, name, barcode_type, owner_id, owner_ref, version FROM %s WHERE name = $1", tableBarcodes)
+	rows, err := s.db().QueryContext(ctx, sql, itemName)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		bc := model.Barcode{}
-		err = rows.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef)
+		err = rows.Scan(&bc.Id, &bc.Name, &bc.Type, &bc.OwnerId, &bc.OwnerRef, &bc.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -176,15 +181,15 @@ func (s *Storage) FindBarcodesByName(ctx context.Context, itemName string) ([]mo
 // FindBarcodesByOwnerId returns a list of barcodes for the product (owner)
 func (s *Storage) FindBarcodesByOwnerId(ctx context.Context, ownerId int64, ownerRef string) ([]model.Barcode, error) {
 	retBc := make([]model.Barcode, 0)
-	sqlSel := `SELECT b.id, b.name, b.barcode_type, b.owner_id FROM barcodes b WHERE b.owner_id = $1 AND b.owner_ref = $2`
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel, ownerId, ownerRef)
+	sqlSel := `SELECT b.id, b.name, b.barcode_type, b.owner_id, b.owner_ref, b.version FROM barcodes b WHERE b.owner_id = $1 AND b.owner_ref = $2`
+	rows, err := s.db().QueryContext(ctx, sqlSel, ownerId, ownerRef)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		bci := model.Barcode{}
-		err = rows.Scan(&bci.Id, &bci.Name, &bci.Type, &bci.OwnerId)
+		err = rows.Scan(&bci.Id, &bci.Name, &bci.Type, &bci.OwnerId, &bci.OwnerRef, &bci.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -199,8 +204,8 @@ func (s *Storage) BarcodesSuggest(ctx context.Context, text string, limit int) (
 		limit = DefaultSuggestionLimit
 	}
 
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE name ILIKE $1 LIMIT $2", tableBarcodes)
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel, text+"%", limit)
+	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE %s LIMIT $2", tableBarcodes, s.wms.ilike("name", "$1"))
+	rows, err := s.db().QueryContext(ctx, sqlSel, text+"%", limit)
 	if err != nil {
 		return retVal, err
 	}
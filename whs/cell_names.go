@@ -0,0 +1,229 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"sort"
+)
+
+const tableCellNameFormats = "cell_name_formats"
+
+// GetCellNameFormat возвращает шаблон имени ячеек зоны zoneId склада whsId
+// Если для зоны шаблон не задан, используется шаблон склада (zone_id = 0),
+// если не задан и он - пустой шаблон (числовое представление)
+func (s *Storage) GetCellNameFormat(ctx context.Context, whsId int64, zoneId int64) (model.CellNameFormat, error) {
+	var format string
+	sqlSel := fmt.Sprintf("SELECT format FROM %s WHERE whs_id = $1 AND zone_id IN (0, $2) "+
+		"ORDER BY zone_id DESC LIMIT 1", tableCellNameFormats)
+	err := s.db().QueryRowContext(ctx, sqlSel, whsId, zoneId).Scan(&format)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return model.CellNameFormat(format), nil
+}
+
+// SetCellNameFormat сохраняет шаблон имени ячеек склада (zoneId = 0) или зоны
+// Пустой шаблон удаляет настройку. Имена существующих ячеек не меняются, см. RenameCells
+func (s *Storage) SetCellNameFormat(ctx context.Context, whsId int64, zoneId int64, format model.CellNameFormat) error {
+	if whsId == 0 {
+		return core.Validation(tableCellNameFormats, 0, "unacceptable action. whs id eq 0")
+	}
+	if err := format.Validate(); err != nil {
+		return err
+	}
+	return s.unit(ctx, func(s *Storage) error {
+		var before, after *cellNameFormatEntry
+		var stored string
+		sqlSel := fmt.Sprintf("SELECT format FROM %s WHERE whs_id = $1 AND zone_id = $2", tableCellNameFormats)
+		err := s.db().QueryRowContext(ctx, sqlSel, whsId, zoneId).Scan(&stored)
+		switch {
+		case err == nil:
+			before = &cellNameFormatEntry{ZoneId: zoneId, Format: model.CellNameFormat(stored)}
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		if err = s.setCellNameFormat(ctx, whsId, zoneId, format); err != nil {
+			return err
+		}
+		if format != "" {
+			after = &cellNameFormatEntry{ZoneId: zoneId, Format: format}
+		}
+		return s.audit(ctx, model.EntityCellNameFormat, auditAction(before != nil, after != nil), whsId, before, after)
+	})
+}
+
+// cellNameFormatEntry шаблон имени ячеек в журнале аудита
+type cellNameFormatEntry struct {
+	ZoneId int64                `json:"zone_id"`
+	Format model.CellNameFormat `json:"format"`
+}
+
+func (s *Storage) setCellNameFormat(ctx context.Context, whsId int64, zoneId int64, format model.CellNameFormat) error {
+	if format == "" {
+		sqlDel := fmt.Sprintf("DELETE FROM %s WHERE whs_id = $1 AND zone_id = $2", tableCellNameFormats)
+		_, err := s.db().ExecContext(ctx, sqlDel, whsId, zoneId)
+		return err
+	}
+	sqlUps := fmt.Sprintf("INSERT INTO %s (whs_id, zone_id, format) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (whs_id, zone_id) DO UPDATE SET format = excluded.format", tableCellNameFormats)
+	_, err := s.db().ExecContext(ctx, sqlUps, whsId, zoneId, string(format))
+	return err
+}
+
+// RenameCells применяет действующие шаблоны к существующим ячейкам склада whsId
+// (только зоны zoneId, если он не 0). Возвращает количество переименованных ячеек,
+// переименования записываются в журнал аудита
+func (s *Storage) RenameCells(ctx context.Context, whsId int64, zoneId int64) (int, error) {
+	formats := make(map[int64]model.CellNameFormat)
+	cells := make([]model.Cell, 0)
+
+	sqlSel := fmt.Sprintf("SELECT id, name, whs_id, zone_id, section_id, passage_id, rack_id, floor, number "+
+		"FROM %s WHERE whs_id = $1 AND ($2 = 0 OR zone_id = $2)", tableCells)
+	rows, err := s.db().QueryContext(ctx, sqlSel, whsId, zoneId)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		c := model.Cell{}
+		err = rows.Scan(&c.Id, &c.Name, &c.WhsId, &c.ZoneId, &c.SectionId, &c.PassageId, &c.RackId, &c.Floor, &c.Number)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		cells = append(cells, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sqlUpd := fmt.Sprintf("UPDATE %s SET name = $2, version = version + 1 WHERE id = $1", tableCells)
+	renamed := 0
+	err = s.unit(ctx, func(s *Storage) error {
+		for _, c := range cells {
+			format, ok := formats[c.ZoneId]
+			if !ok {
+				if format, err = s.GetCellNameFormat(ctx, c.WhsId, c.ZoneId); err != nil {
+					return err
+				}
+				formats[c.ZoneId] = format
+			}
+			oldName := c.Name
+			if err = c.SetName(format); err != nil {
+				return err
+			}
+			if c.Name == oldName {
+				continue
+			}
+			before, err := s.GetCellById(ctx, c.Id)
+			if err != nil {
+				return err
+			}
+			if _, err = s.db().ExecContext(ctx, sqlUpd, c.Id, c.Name); err != nil {
+				return err
+			}
+			if err = s.auditAfter(ctx, model.EntityCell, model.AuditUpdate, c.Id, before); err != nil {
+				return err
+			}
+			renamed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return renamed, nil
+}
+
+// GetCellNameFormats возвращает все шаблоны имен ячеек склада whsId по зонам (0 - шаблон склада)
+func (s *Storage) GetCellNameFormats(ctx context.Context, whsId int64) (map[int64]model.CellNameFormat, error) {
+	formats := make(map[int64]model.CellNameFormat)
+	sqlSel := fmt.Sprintf("SELECT zone_id, format FROM %s WHERE whs_id = $1", tableCellNameFormats)
+	rows, err := s.db().QueryContext(ctx, sqlSel, whsId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var zoneId int64
+		var format string
+		if err = rows.Scan(&zoneId, &format); err != nil {
+			return nil, err
+		}
+		formats[zoneId] = model.CellNameFormat(format)
+	}
+	return formats, rows.Err()
+}
+
+// FindCellsByAddr возвращает ячейки по адресу
+// Зона, секция и номер ячейки учитываются, только если заданы (не 0)
+func (s *Storage) FindCellsByAddr(ctx context.Context, addr *model.CellAddr) ([]model.Cell, error) {
+	items := make([]model.Cell, 0)
+	sqlSel := fmt.Sprintf("SELECT id, name, whs_id, zone_id, section_id, passage_id, rack_id, floor, number, "+
+		"is_size_free, is_weight_free, not_allowed_in, not_allowed_out, is_service, max_weight, max_volume, version FROM %s "+
+		"WHERE whs_id = $1 AND ($2 = 0 OR zone_id = $2) AND passage_id = $3 AND rack_id = $4 AND floor = $5 "+
+		"AND ($6 = 0 OR section_id = $6) AND ($7 = 0 OR number = $7) ORDER BY zone_id, number", tableCells)
+	rows, err := s.db().QueryContext(ctx, sqlSel, addr.WhsId, addr.ZoneId, addr.PassageId, addr.RackId, addr.Floor, addr.SectionId, addr.Number)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := model.Cell{}
+		err = rows.Scan(&c.Id, &c.Name, &c.WhsId, &c.ZoneId, &c.SectionId, &c.PassageId, &c.RackId, &c.Floor, &c.Number,
+			&c.IsSizeFree, &c.IsWeightFree, &c.NotAllowedIn, &c.NotAllowedOut, &c.IsService, &c.MaxWeight, &c.MaxVolume, &c.Version)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, c)
+	}
+	return items, rows.Err()
+}
+
+// FindCellsByAddrName возвращает ячейки склада whsId по введенному или отсканированному имени
+// Имя разбирается шаблонами склада и его зон, затем числовым и человеко-понятным представлением.
+// Склад, отсутствующий в шаблоне, - whsId, зона - зона настройки шаблона.
+// Шаблон склада без $z зону не ограничивает
+func (s *Storage) FindCellsByAddrName(ctx context.Context, whsId int64, name string) ([]model.Cell, error) {
+	formats, err := s.GetCellNameFormats(ctx, whsId)
+	if err != nil {
+		return nil, err
+	}
+	zones := make([]int64, 0, len(formats))
+	for zoneId := range formats {
+		zones = append(zones, zoneId)
+	}
+	// шаблоны зон проверяются раньше шаблона склада
+	sort.Slice(zones, func(i, j int) bool { return zones[i] > zones[j] })
+	for _, zoneId := range zones {
+		addr, err := formats[zoneId].Parse(name)
+		if err != nil {
+			continue
+		}
+		if addr.WhsId == 0 {
+			addr.WhsId = whsId
+		}
+		if addr.ZoneId == 0 {
+			addr.ZoneId = zoneId
+		}
+		items, err := s.FindCellsByAddr(ctx, &addr)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) > 0 {
+			return items, nil
+		}
+	}
+	addr, err := model.ParseCellAddr(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.FindCellsByAddr(ctx, &addr)
+}
@@ -2,45 +2,160 @@ package whs
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
 	"github.com/mlplabs/mwms-core/whs/model"
 )
 
+const tableCells = "cells"
+
 func (s *Storage) GetCellById(ctx context.Context, cellId int64) (*model.Cell, error) {
-	return nil, nil
+	sqlSel := fmt.Sprintf("SELECT id, name, whs_id, zone_id, section_id, passage_id, rack_id, floor, number, "+
+		"is_size_free, is_weight_free, not_allowed_in, not_allowed_out, is_service, max_weight, max_volume, version FROM %s WHERE id = $1", tableCells)
+	c := model.Cell{}
+	row := s.db().QueryRowContext(ctx, sqlSel, cellId)
+	err := row.Scan(&c.Id, &c.Name, &c.WhsId, &c.ZoneId, &c.SectionId, &c.PassageId, &c.RackId, &c.Floor, &c.Number,
+		&c.IsSizeFree, &c.IsWeightFree, &c.NotAllowedIn, &c.NotAllowedOut, &c.IsService, &c.MaxWeight, &c.MaxVolume, &c.Version)
+	if err != nil {
+		return nil, core.Translate(tableCells, cellId, err)
+	}
+	return &c, nil
 }
 
+// CreateCell создает ячейку. Если имя не задано, оно формируется по шаблону склада/зоны
 func (s *Storage) CreateCell(ctx context.Context, cell *model.Cell) (int64, error) {
-	if cell.Name == "" {
-		cell.SetName("")
-	}
-	cellNum, err := s.getNextCellNum(ctx, &cell.CellAddr)
+	return s.created(ctx, model.EntityCell, cell, func(s *Storage) (int64, error) {
+		return s.createCell(ctx, cell)
+	})
+}
+
+func (s *Storage) createCell(ctx context.Context, cell *model.Cell) (int64, error) {
+	cellNum, err := s.getNextCellNum(ctx, &cell.CellAddr, nil)
 	if err != nil {
 		return 0, err
 	}
 	cell.Number = cellNum
-	sqlIns := `INSERT INTO cells (name, whs_id, zone_id, section_id, passage_id, rack_id, floor, number,
-                   sz_length, sz_width, sz_height, sz_volume, sz_uf_volume, sz_weight, is_size_free, is_weight_free, not_allowed_in, not_allowed_out, is_service)
-				VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
-	err = s.wms.Db.QueryRowContext(ctx, sqlIns, cell.Name, cell.WhsId, cell.ZoneId, cell.SectionId, cell.PassageId, cell.RackId, cell.Floor, cellNum).Scan(&cell.Id)
+	if cell.Name == "" {
+		format, err := s.GetCellNameFormat(ctx, cell.WhsId, cell.ZoneId)
+		if err != nil {
+			return 0, err
+		}
+		if err = cell.SetName(format); err != nil {
+			return 0, err
+		}
+	}
+	err = s.db().QueryRowContext(ctx, sqlInsertCell, cell.Name, cell.WhsId, cell.ZoneId, cell.SectionId, cell.PassageId, cell.RackId, cell.Floor, cellNum,
+		cell.IsSizeFree, cell.IsWeightFree, cell.NotAllowedIn, cell.NotAllowedOut, cell.IsService, cell.MaxWeight, cell.MaxVolume).Scan(&cell.Id)
 	if err != nil {
 		return 0, err
 	}
+	cell.Version = 1
 	return cell.Id, nil
 }
 
+// UpdateCell изменяет имя ячейки. Пустое имя формируется заново по шаблону склада/зоны
 func (s *Storage) UpdateCell(ctx context.Context, cell *model.Cell) (int64, error) {
+	if err := CheckVersion(tableCells, cell.Id, cell.Version); err != nil {
+		return 0, err
+	}
+	return s.audited(ctx, model.EntityCell, model.AuditUpdate, cell.Id, func(s *Storage) (int64, error) {
+		return s.updateCell(ctx, cell)
+	})
+}
+
+func (s *Storage) updateCell(ctx context.Context, cell *model.Cell) (int64, error) {
 	if cell.Name == "" {
-		cell.SetName("")
+		stored, err := s.GetCellById(ctx, cell.Id)
+		if err != nil {
+			return 0, err
+		}
+		format, err := s.GetCellNameFormat(ctx, stored.WhsId, stored.ZoneId)
+		if err != nil {
+			return 0, err
+		}
+		if err = stored.SetName(format); err != nil {
+			return 0, err
+		}
+		cell.Name = stored.Name
 	}
-	sqlUpd := `UPDATE cells SET name=$2 WHERE id=$1`
-	res, err := s.wms.Db.ExecContext(ctx, sqlUpd, cell.Id, cell.Name)
+	sqlUpd := `UPDATE cells SET name=$2, version=version+1 WHERE id=$1 AND ` + versionCond(3)
+	res, err := s.db().ExecContext(ctx, sqlUpd, cell.Id, cell.Name, cell.Version)
 	if err != nil {
 		return 0, err
 	}
-	if a, err := res.RowsAffected(); a != 1 || err != nil {
-		return 0, err
+	return s.updated(ctx, res, tableCells, cell.Id, cell.Version)
+}
+
+// GenerateCells массово создает ячейки по диапазону адресов rng
+// Имена формируются по шаблону склада/зоны, нумерация продолжает уже существующие ячейки адреса
+// Возвращает идентификаторы созданных ячеек
+func (s *Storage) GenerateCells(ctx context.Context, rng *model.CellsRange) ([]int64, error) {
+	return idempotent(s, ctx, "generate cells", rng, func(ctx context.Context, s *Storage) ([]int64, error) {
+		var ids []int64
+		err := s.unit(ctx, func(s *Storage) (err error) {
+			if ids, err = s.generateCells(ctx, rng); err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err = s.auditAfter(ctx, model.EntityCell, model.AuditCreate, id, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ids, nil
+	})
+}
+
+func (s *Storage) generateCells(ctx context.Context, rng *model.CellsRange) ([]int64, error) {
+	if rng.CellsPerFloor <= 0 || rng.PassageFrom > rng.PassageTo || rng.RackFrom > rng.RackTo || rng.FloorFrom > rng.FloorTo {
+		return nil, core.Validation(tableCells, 0, "invalid cells range")
 	}
-	return cell.Id, nil
+	format, err := s.GetCellNameFormat(ctx, rng.WhsId, rng.ZoneId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0)
+	for p := rng.PassageFrom; p <= rng.PassageTo; p++ {
+		for r := rng.RackFrom; r <= rng.RackTo; r++ {
+			for f := rng.FloorFrom; f <= rng.FloorTo; f++ {
+				cell := rng.Props
+				cell.CellAddr = model.CellAddr{WhsId: rng.WhsId, ZoneId: rng.ZoneId, SectionId: rng.SectionId, PassageId: p, RackId: r, Floor: f}
+				firstNum, err := s.getNextCellNum(ctx, &cell.CellAddr, tx.Tx)
+				if err != nil {
+					_ = tx.Rollback()
+					return nil, err
+				}
+				for n := firstNum; n < firstNum+rng.CellsPerFloor; n++ {
+					cell.Number = n
+					if err = cell.SetName(format); err != nil {
+						_ = tx.Rollback()
+						return nil, err
+					}
+					err = tx.QueryRowContext(ctx, sqlInsertCell, cell.Name, cell.WhsId, cell.ZoneId, cell.SectionId, cell.PassageId, cell.RackId, cell.Floor, n,
+						cell.IsSizeFree, cell.IsWeightFree, cell.NotAllowedIn, cell.NotAllowedOut, cell.IsService, cell.MaxWeight, cell.MaxVolume).Scan(&cell.Id)
+					if err != nil {
+						_ = tx.Rollback()
+						return nil, err
+					}
+					ids = append(ids, cell.Id)
+				}
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
 func (s *Storage) CellsSuggest(ctx context.Context, text string, limit int) ([]model.Suggestion, error) {
@@ -49,8 +164,8 @@ func (s *Storage) CellsSuggest(ctx context.Context, text string, limit int) ([]m
 		limit = DefaultSuggestionLimit
 	}
 
-	sqlSel := `SELECT id, name FROM cells WHERE name ILIKE $1 LIMIT $2`
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel, text+"%", limit)
+	sqlSel := fmt.Sprintf("SELECT id, name FROM cells WHERE %s LIMIT $2", s.wms.ilike("name", "$1"))
+	rows, err := s.db().QueryContext(ctx, sqlSel, text+"%", limit)
 	if err != nil {
 		return retVal, err
 	}
@@ -67,12 +182,21 @@ func (s *Storage) CellsSuggest(ctx context.Context, text string, limit int) ([]m
 	return retVal, err
 }
 
-func (s *Storage) getNextCellNum(ctx context.Context, addr *model.CellAddr) (int, error) {
+const sqlInsertCell = `INSERT INTO cells (name, whs_id, zone_id, section_id, passage_id, rack_id, floor, number,
+                   is_size_free, is_weight_free, not_allowed_in, not_allowed_out, is_service, max_weight, max_volume)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id`
+
+func (s *Storage) getNextCellNum(ctx context.Context, addr *model.CellAddr, tx *sql.Tx) (int, error) {
 	var nextNum int
+	var row *sql.Row
 	sqlCell := `SELECT count(*) +1 as next_cell FROM cells 
                              WHERE whs_id = $1 AND zone_id = $2 AND section_id = $3
-                             AND passage_id = $4 AND rack_id=$5 AND floor=6`
-	row := s.wms.Db.QueryRow(sqlCell, addr.WhsId, addr.ZoneId, addr.SectionId, addr.PassageId, addr.RackId, addr.Floor)
+                             AND passage_id = $4 AND rack_id=$5 AND floor=$6`
+	if tx != nil {
+		row = tx.QueryRowContext(ctx, sqlCell, addr.WhsId, addr.ZoneId, addr.SectionId, addr.PassageId, addr.RackId, addr.Floor)
+	} else {
+		row = s.db().QueryRowContext(ctx, sqlCell, addr.WhsId, addr.ZoneId, addr.SectionId, addr.PassageId, addr.RackId, addr.Floor)
+	}
 	if err := row.Scan(&nextNum); err != nil {
 		return 0, err
 	}
@@ -0,0 +1,179 @@
+package whs
+
+import (
+	"context"
+	"fmt"
+	"github.com/mlplabs/mwms-core/whs/commerceml"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"io"
+	"time"
+)
+
+// ImportCommerceML загружает каталог товаров CommerceML 2 (import.xml) в продукты, производителей и штрих-коды.
+// Товары и изготовители сопоставляются по GUID 1С (реестр внешних идентификаторов, система model.ExternalSystem1C),
+// при отсутствии сопоставления - по артикулу и наименованию соответственно, после чего сопоставление сохраняется
+func (s *Storage) ImportCommerceML(ctx context.Context, r io.Reader, opts model.ImportOptions) (*model.ImportReport, error) {
+	catalog, err := commerceml.ReadCatalog(r)
+	if err != nil {
+		return nil, err
+	}
+	report := &model.ImportReport{DryRun: opts.DryRun, Rows: make([]model.ImportRowResult, 0, len(catalog.Products))}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = model.DefaultImportBatchSize
+	}
+
+	rows := make([]model.ProductImportRow, 0, len(catalog.Products))
+	valid := make([]int, 0, len(catalog.Products))
+	errs := make(map[int]string)
+	seen := make(map[string]int)
+	for i, p := range catalog.Products {
+		row := model.ProductImportRow{Line: i + 1, ExternalId: p.Id, Name: p.Name, ItemNumber: p.Article, Barcodes: p.Barcodes}
+		rows = append(rows, row)
+		if p.Id == "" {
+			errs[i] = "product id is empty"
+			continue
+		}
+		if err = validateProductRow(&row); err != nil {
+			errs[i] = err.Error()
+			continue
+		}
+		if line, ok := seen[p.Id]; ok {
+			errs[i] = fmt.Sprintf("product id %q duplicates product %d", p.Id, line)
+			continue
+		}
+		seen[p.Id] = row.Line
+		valid = append(valid, i)
+	}
+
+	results := make(map[int]model.ImportRowResult)
+	for start := 0; start < len(valid); start += batchSize {
+		end := min(start+batchSize, len(valid))
+		err = s.importBatch(ctx, rows, valid[start:end], opts.DryRun, results, func(s *Storage, row *model.ProductImportRow) (model.ImportRowResult, error) {
+			manufacturerId, err := s.importCmlManufacturer(ctx, catalog.Products[row.Line-1].Manufacturer)
+			if err != nil {
+				return model.ImportRowResult{}, err
+			}
+			productId, err := lookupExternalId(ctx, s.db(), model.ExternalSystem1C, model.EntityProduct, row.ExternalId)
+			if err != nil {
+				return model.ImportRowResult{}, err
+			}
+			res, err := s.importProductRow(ctx, row, productId, manufacturerId)
+			if err != nil {
+				return res, err
+			}
+			res.ExternalId = row.ExternalId
+			return res, s.setExternalId(ctx, &model.ExternalId{System: model.ExternalSystem1C, Key: row.ExternalId, Entity: model.EntityProduct, Id: res.ProductId})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, row := range rows {
+		if msg, ok := errs[i]; ok {
+			report.Add(model.ImportRowResult{Line: row.Line, ItemNumber: row.ItemNumber, ExternalId: row.ExternalId, Action: model.ImportActionError, Error: msg})
+			continue
+		}
+		report.Add(results[i])
+	}
+	return report, nil
+}
+
+// importCmlManufacturer возвращает id производителя по GUID 1С или имени, создавая его при отсутствии
+// (0 - производитель не указан). Выполняется в транзакции строки импорта, см. importManufacturer
+func (s *Storage) importCmlManufacturer(ctx context.Context, mnf *commerceml.Manufacturer) (int64, error) {
+	if mnf == nil {
+		return 0, nil
+	}
+	if mnf.Id != "" {
+		id, err := lookupExternalId(ctx, s.db(), model.ExternalSystem1C, model.EntityManufacturer, mnf.Id)
+		if err != nil || id != 0 {
+			return id, err
+		}
+	}
+	id, err := s.importManufacturer(ctx, mnf.Name)
+	if err != nil || id == 0 || mnf.Id == "" {
+		return id, err
+	}
+	return id, s.setExternalId(ctx, &model.ExternalId{System: model.ExternalSystem1C, Key: mnf.Id, Entity: model.EntityManufacturer, Id: id})
+}
+
+// ExportCommerceMLOffers формирует пакет предложений CommerceML 2 (offers.xml) с остатками складов whsIds
+// (всех складов, если не указаны). Выгружаются только товары, сопоставленные с 1С.
+// Склады без сопоставления (SetExternalId) выгружаются с Ид, равным id склада
+func (s *Storage) ExportCommerceMLOffers(ctx context.Context, w io.Writer, catalogId string, whsIds ...int64) error {
+	warehouses, err := s.GetWarehouses(ctx)
+	if err != nil {
+		return err
+	}
+	if len(whsIds) > 0 {
+		filtered := make([]model.Warehouse, 0, len(whsIds))
+		for _, whs := range warehouses {
+			for _, id := range whsIds {
+				if whs.Id == id {
+					filtered = append(filtered, whs)
+				}
+			}
+		}
+		warehouses = filtered
+	}
+
+	// 1С формирует Ид пакета предложений как Ид каталога с суффиксом "#"
+	offers := &commerceml.Offers{Id: catalogId + "#", Name: "Пакет предложений", CatalogId: catalogId,
+		Warehouses: make([]commerceml.Warehouse, 0, len(warehouses)), Offers: make([]commerceml.Offer, 0)}
+	index := make(map[int64]int)
+	rows, err := s.db().QueryContext(ctx, fmt.Sprintf(`SELECT p.id, e.ext_key, p.name, p.item_number FROM products p
+		JOIN %s e ON e.system = $1 AND e.entity = $2 AND e.id = p.id ORDER BY p.name, p.id`, tableExternalIds), model.ExternalSystem1C, model.EntityProduct)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		offer := commerceml.Offer{Stocks: make([]commerceml.OfferStock, 0)}
+		if err = rows.Scan(&id, &offer.Id, &offer.Name, &offer.Article); err != nil {
+			rows.Close()
+			return err
+		}
+		index[id] = len(offers.Offers)
+		offers.Offers = append(offers.Offers, offer)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, whs := range warehouses {
+		guid, err := externalKey(ctx, s.db(), model.ExternalSystem1C, model.EntityWarehouse, whs.Id)
+		if err != nil {
+			return err
+		}
+		if guid == "" {
+			guid = fmt.Sprintf("%d", whs.Id)
+		}
+		offers.Warehouses = append(offers.Warehouses, commerceml.Warehouse{Id: guid, Name: whs.Name})
+
+		rows, err := s.db().QueryContext(ctx, fmt.Sprintf(`SELECT prod_id, SUM(quantity) FROM storage%d
+			GROUP BY prod_id HAVING SUM(quantity) <> 0`, whs.Id))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var prodId int64
+			var qty int
+			if err = rows.Scan(&prodId, &qty); err != nil {
+				rows.Close()
+				return err
+			}
+			if i, ok := index[prodId]; ok {
+				offers.Offers[i].Quantity += qty
+				offers.Offers[i].Stocks = append(offers.Offers[i].Stocks, commerceml.OfferStock{WarehouseId: guid, Quantity: qty})
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+	return commerceml.WriteOffers(w, offers, time.Now())
+}
@@ -0,0 +1,144 @@
+// Package commerceml читает и формирует документы обмена CommerceML 2 (1С):
+// каталог товаров (import.xml) и пакет предложений с остатками (offers.xml)
+package commerceml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"io"
+	"strings"
+	"time"
+)
+
+// SchemaVersion версия схемы формируемых документов
+const SchemaVersion = "2.05"
+
+// Manufacturer изготовитель товара
+type Manufacturer struct {
+	Id   string `xml:"Ид"`
+	Name string `xml:"Наименование"`
+}
+
+// Product товар каталога
+type Product struct {
+	Id           string        `xml:"Ид"`
+	Article      string        `xml:"Артикул"`
+	Name         string        `xml:"Наименование"`
+	Barcodes     []string      `xml:"Штрихкод"`
+	Manufacturer *Manufacturer `xml:"Изготовитель"`
+	Properties   []Property    `xml:"ЗначенияРеквизитов>ЗначениеРеквизита"`
+}
+
+// Property значение реквизита товара
+type Property struct {
+	Name  string `xml:"Наименование"`
+	Value string `xml:"Значение"`
+}
+
+// Catalog каталог товаров (import.xml)
+type Catalog struct {
+	Id           string    `xml:"Ид"`
+	ClassifierId string    `xml:"ИдКлассификатора"`
+	Name         string    `xml:"Наименование"`
+	OnlyChanges  bool      `xml:"СодержитТолькоИзменения,attr"`
+	Products     []Product `xml:"Товары>Товар"`
+}
+
+// Warehouse склад пакета предложений
+type Warehouse struct {
+	Id   string `xml:"Ид"`
+	Name string `xml:"Наименование"`
+}
+
+// OfferStock остаток предложения на складе
+type OfferStock struct {
+	WarehouseId string `xml:"ИдСклада,attr"`
+	Quantity    int    `xml:"КоличествоНаСкладе,attr"`
+}
+
+// Offer предложение (остаток товара)
+type Offer struct {
+	Id       string       `xml:"Ид"`
+	Article  string       `xml:"Артикул,omitempty"`
+	Name     string       `xml:"Наименование"`
+	Quantity int          `xml:"Количество"`
+	Stocks   []OfferStock `xml:"Склад"`
+}
+
+// Offers пакет предложений (offers.xml)
+type Offers struct {
+	Id           string      `xml:"Ид"`
+	Name         string      `xml:"Наименование"`
+	CatalogId    string      `xml:"ИдКаталога,omitempty"`
+	ClassifierId string      `xml:"ИдКлассификатора,omitempty"`
+	OnlyChanges  bool        `xml:"СодержитТолькоИзменения,attr"`
+	Warehouses   []Warehouse `xml:"Склады>Склад"`
+	Offers       []Offer     `xml:"Предложения>Предложение"`
+}
+
+type document struct {
+	XMLName xml.Name `xml:"КоммерческаяИнформация"`
+	Version string   `xml:"ВерсияСхемы,attr"`
+	Date    string   `xml:"ДатаФормирования,attr"`
+	Catalog *Catalog `xml:"Каталог,omitempty"`
+	Offers  *Offers  `xml:"ПакетПредложений,omitempty"`
+}
+
+// ReadCatalog читает каталог товаров из документа import.xml
+// Штрих-коды и изготовитель, переданные реквизитами (ЗначенияРеквизитов), переносятся в поля товара
+func ReadCatalog(r io.Reader) (*Catalog, error) {
+	doc := document{}
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charsetReader
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.Catalog == nil {
+		return nil, fmt.Errorf("commerceml: document has no catalog")
+	}
+	for i := range doc.Catalog.Products {
+		p := &doc.Catalog.Products[i]
+		for _, prop := range p.Properties {
+			switch strings.ToLower(prop.Name) {
+			case "штрихкод":
+				p.Barcodes = append(p.Barcodes, prop.Value)
+			case "производитель", "изготовитель":
+				if p.Manufacturer == nil && prop.Value != "" {
+					p.Manufacturer = &Manufacturer{Name: prop.Value}
+				}
+			}
+		}
+		barcodes := make([]string, 0, len(p.Barcodes))
+		for _, bc := range p.Barcodes {
+			if bc = strings.TrimSpace(bc); bc != "" {
+				barcodes = append(barcodes, bc)
+			}
+		}
+		p.Barcodes = barcodes
+	}
+	return doc.Catalog, nil
+}
+
+// WriteOffers записывает пакет предложений как документ offers.xml в кодировке UTF-8
+func WriteOffers(w io.Writer, offers *Offers, date time.Time) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	doc := document{Version: SchemaVersion, Date: date.Format("2006-01-02T15:04:05"), Offers: offers}
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// charsetReader поддерживает кодировку windows-1251, используемую старыми конфигурациями 1С
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(label) {
+	case "windows-1251", "cp1251":
+		return charmap.Windows1251.NewDecoder().Reader(input), nil
+	}
+	return nil, fmt.Errorf("commerceml: unsupported charset %q", label)
+}
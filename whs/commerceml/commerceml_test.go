@@ -0,0 +1,101 @@
+package commerceml
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding/charmap"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testImport = `<?xml version="1.0" encoding="UTF-8"?>
+<КоммерческаяИнформация ВерсияСхемы="2.05" ДатаФормирования="2024-03-01T10:00:00">
+	<Классификатор><Ид>cls-1</Ид><Наименование>Классификатор</Наименование></Классификатор>
+	<Каталог СодержитТолькоИзменения="true">
+		<Ид>cat-1</Ид>
+		<ИдКлассификатора>cls-1</ИдКлассификатора>
+		<Наименование>Каталог товаров</Наименование>
+		<Товары>
+			<Товар>
+				<Ид>7a1b2c3d-0000-0000-0000-000000000001</Ид>
+				<Штрихкод>4601234567893</Штрихкод>
+				<Артикул>M-001</Артикул>
+				<Наименование>Молоко 1л</Наименование>
+				<Изготовитель><Ид>mnf-1</Ид><Наименование>Простоквашино</Наименование></Изготовитель>
+			</Товар>
+			<Товар>
+				<Ид>7a1b2c3d-0000-0000-0000-000000000002</Ид>
+				<Наименование>Кефир</Наименование>
+				<ЗначенияРеквизитов>
+					<ЗначениеРеквизита><Наименование>Штрихкод</Наименование><Значение> 46012345 </Значение></ЗначениеРеквизита>
+					<ЗначениеРеквизита><Наименование>Производитель</Наименование><Значение>Домик</Значение></ЗначениеРеквизита>
+				</ЗначенияРеквизитов>
+			</Товар>
+		</Товары>
+	</Каталог>
+</КоммерческаяИнформация>`
+
+func TestReadCatalog(t *testing.T) {
+	c, err := ReadCatalog(strings.NewReader(testImport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Id != "cat-1" || c.ClassifierId != "cls-1" || !c.OnlyChanges || len(c.Products) != 2 {
+		t.Fatalf("catalog = %+v", c)
+	}
+	p := c.Products[0]
+	if p.Id != "7a1b2c3d-0000-0000-0000-000000000001" || p.Article != "M-001" || p.Name != "Молоко 1л" ||
+		!reflect.DeepEqual(p.Barcodes, []string{"4601234567893"}) || *p.Manufacturer != (Manufacturer{Id: "mnf-1", Name: "Простоквашино"}) {
+		t.Errorf("product 0 = %+v", p)
+	}
+	p = c.Products[1]
+	if !reflect.DeepEqual(p.Barcodes, []string{"46012345"}) || p.Manufacturer == nil || p.Manufacturer.Name != "Домик" {
+		t.Errorf("product 1 = %+v", p)
+	}
+}
+
+func TestReadCatalog_Windows1251(t *testing.T) {
+	src := strings.Replace(testImport, "UTF-8", "windows-1251", 1)
+	data, err := charmap.Windows1251.NewEncoder().String(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadCatalog(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Products[0].Name != "Молоко 1л" {
+		t.Errorf("name = %q", c.Products[0].Name)
+	}
+}
+
+func TestReadCatalog_NoCatalog(t *testing.T) {
+	_, err := ReadCatalog(strings.NewReader(`<КоммерческаяИнформация ВерсияСхемы="2.05"/>`))
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestWriteOffers(t *testing.T) {
+	offers := &Offers{Id: "cat-1#", Name: "Пакет предложений", CatalogId: "cat-1",
+		Warehouses: []Warehouse{{Id: "whs-1", Name: "Основной"}},
+		Offers: []Offer{{Id: "p-1", Article: "M-001", Name: "Молоко", Quantity: 5,
+			Stocks: []OfferStock{{WarehouseId: "whs-1", Quantity: 5}}}}}
+	var buf bytes.Buffer
+	if err := WriteOffers(&buf, offers, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<КоммерческаяИнформация ВерсияСхемы="2.05" ДатаФормирования="2024-03-01T10:00:00">`,
+		`<ПакетПредложений СодержитТолькоИзменения="false">`,
+		`<ИдКаталога>cat-1</ИдКаталога>`,
+		`<Склад ИдСклада="whs-1" КоличествоНаСкладе="5"></Склад>`,
+		`<Количество>5</Количество>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output has no %s:\n%s", want, out)
+		}
+	}
+}
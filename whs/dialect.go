@@ -0,0 +1,211 @@
+package whs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Dialect диалект SQL базы данных Wms
+type Dialect int
+
+const (
+	DialectPostgres Dialect = iota // PostgreSQL (по умолчанию)
+	DialectSQLite                  // SQLite, см. пакет whs/sqlite
+)
+
+// sqliteTimeLayout формат хранения времени в SQLite (UTC)
+// Одинаковая длина значений позволяет сравнивать время как строки
+const sqliteTimeLayout = "2006-01-02 15:04:05.000"
+
+// Dialect возвращает диалект SQL базы данных
+func (w *Wms) Dialect() Dialect {
+	return w.dialect
+}
+
+// timeArg параметр запроса со значением времени t
+func (w *Wms) timeArg(t time.Time) any {
+	if w.dialect == DialectSQLite {
+		return t.UTC().Format(sqliteTimeLayout)
+	}
+	return t
+}
+
+// arrayArg параметр запроса с массивом идентификаторов, см. inArray и arrayLen
+func (w *Wms) arrayArg(ids []int64) any {
+	if ids == nil {
+		ids = make([]int64, 0) // nil передается как NULL
+	}
+	if w.dialect == DialectSQLite {
+		data, _ := json.Marshal(ids)
+		return string(data)
+	}
+	return pq.Array(ids)
+}
+
+// inArray условие "expr входит в массив - параметр param"
+func (w *Wms) inArray(expr string, param string) string {
+	if w.dialect == DialectSQLite {
+		return fmt.Sprintf("%s IN (SELECT value FROM json_each(%s))", expr, param)
+	}
+	return fmt.Sprintf("%s = ANY(%s)", expr, param)
+}
+
+// arrayLen количество элементов массива - параметра param
+func (w *Wms) arrayLen(param string) string {
+	if w.dialect == DialectSQLite {
+		return fmt.Sprintf("json_array_length(%s)", param)
+	}
+	return fmt.Sprintf("cardinality(%s::integer[])", param)
+}
+
+// SQLiteLower имя функции SQLite, переводящей строку в нижний регистр с учетом Unicode
+// (встроенные lower и LIKE не учитывают регистр только для латиницы). Регистрируется пакетом whs/sqlite
+const SQLiteLower = "unicode_lower"
+
+// ilike условие "expr соответствует шаблону pattern без учета регистра"
+func (w *Wms) ilike(expr string, pattern string) string {
+	if w.dialect == DialectSQLite {
+		return fmt.Sprintf("%[1]s(%[2]s) LIKE %[1]s(%[3]s)", SQLiteLower, expr, pattern)
+	}
+	return fmt.Sprintf("%s ILIKE %s", expr, pattern)
+}
+
+// forUpdate блокировка выбранных строк до конца транзакции
+// SQLite блокирует базу целиком при первой записи в транзакции
+func (w *Wms) forUpdate() string {
+	if w.dialect == DialectSQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// advisoryLock запрос блокировки ключа $1 (bigint) до конца транзакции, пустая строка - блокировка не нужна
+// В SQLite транзакции записи (sqlite.Open, BEGIN IMMEDIATE) уже выполняются последовательно
+func (w *Wms) advisoryLock() string {
+	if w.dialect == DialectSQLite {
+		return ""
+	}
+	return "SELECT pg_advisory_xact_lock($1)"
+}
+
+// now текущее время
+func (w *Wms) now() string {
+	if w.dialect == DialectSQLite {
+		return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+	}
+	return "now()"
+}
+
+// epoch начало отсчета времени (1970-01-01 UTC)
+func (w *Wms) epoch() string {
+	if w.dialect == DialectSQLite {
+		return "'" + time.Unix(0, 0).UTC().Format(sqliteTimeLayout) + "'"
+	}
+	return "'epoch'::timestamptz"
+}
+
+// truncTime время expr, усеченное до начала периода unit (hour, day, week, month)
+func (w *Wms) truncTime(unit string, expr string) string {
+	if w.dialect == DialectSQLite {
+		switch unit {
+		case "hour":
+			return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00.000', %s)", expr)
+		case "week":
+			// неделя начинается с понедельника, как в date_trunc
+			return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00.000', %s, '-6 days', 'weekday 1')", expr)
+		case "month":
+			return fmt.Sprintf("strftime('%%Y-%%m-01 00:00:00.000', %s)", expr)
+		}
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00.000', %s)", expr)
+	}
+	return fmt.Sprintf("date_trunc('%s', %s)", unit, expr)
+}
+
+// secondsBetween количество секунд от времени from до времени to
+func (w *Wms) secondsBetween(from string, to string) string {
+	if w.dialect == DialectSQLite {
+		return fmt.Sprintf("((julianday(%s) - julianday(%s)) * 86400.0)", to, from)
+	}
+	return fmt.Sprintf("extract(epoch FROM %s - %s)", to, from)
+}
+
+// floorInt наибольшее целое, не превышающее неотрицательного числа expr
+// Приведение к integer в PostgreSQL округляет, а не отбрасывает дробную часть
+func (w *Wms) floorInt(expr string) string {
+	if w.dialect == DialectSQLite {
+		return fmt.Sprintf("CAST(%s AS integer)", expr)
+	}
+	return fmt.Sprintf("floor(%s)::integer", expr)
+}
+
+// jsonArrayLen длина массива key JSON-колонки col
+func (w *Wms) jsonArrayLen(col string, key string) string {
+	if w.dialect == DialectSQLite {
+		return fmt.Sprintf("json_array_length(%s, '$.%s')", col, key)
+	}
+	return fmt.Sprintf("jsonb_array_length(%s->'%s')", col, key)
+}
+
+// timeScanner читает время, которое SQLite возвращает строкой для вычисляемых колонок
+type timeScanner struct {
+	t *time.Time
+}
+
+var _ sql.Scanner = timeScanner{}
+
+func scanTime(t *time.Time) timeScanner {
+	return timeScanner{t: t}
+}
+
+func (s timeScanner) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*s.t = v
+		return nil
+	case string:
+		return s.parse(v)
+	case []byte:
+		return s.parse(string(v))
+	case nil:
+		*s.t = time.Time{}
+		return nil
+	}
+	return fmt.Errorf("unsupported time value %T", src)
+}
+
+func (s timeScanner) parse(v string) error {
+	for _, layout := range []string{sqliteTimeLayout, "2006-01-02 15:04:05", time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, time.UTC); err == nil {
+			*s.t = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time value %q", v)
+}
+
+// nullTimeScanner читает время, допускающее NULL (nil)
+type nullTimeScanner struct {
+	t **time.Time
+}
+
+var _ sql.Scanner = nullTimeScanner{}
+
+func scanNullTime(t **time.Time) nullTimeScanner {
+	return nullTimeScanner{t: t}
+}
+
+func (s nullTimeScanner) Scan(src any) error {
+	if src == nil {
+		*s.t = nil
+		return nil
+	}
+	var v time.Time
+	if err := scanTime(&v).Scan(src); err != nil {
+		return err
+	}
+	*s.t = &v
+	return nil
+}
@@ -0,0 +1,100 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+	"io"
+	"strings"
+)
+
+// Кодировки CSV
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingWindows1251 = "windows-1251" // для старых русскоязычных программ
+)
+
+// CSVOptions параметры выгрузки CSV
+type CSVOptions struct {
+	Delimiter rune   // разделитель, по умолчанию ';' (Excel с русской локалью)
+	Encoding  string // EncodingUTF8 (по умолчанию) или EncodingWindows1251
+	BOM       bool   // UTF-8 BOM для корректного открытия в Excel
+	NoHeader  bool   // не выводить строку заголовков
+}
+
+type csvWriter struct {
+	w    io.Writer
+	opts CSVOptions
+}
+
+// NewCSV создает выгрузку в CSV
+func NewCSV(w io.Writer, opts CSVOptions) Writer {
+	return &csvWriter{w: w, opts: opts}
+}
+
+func (c *csvWriter) Write(t Table) error {
+	out := c.w
+	var closer io.Closer
+	sanitize := func(s string) string { return s }
+	switch strings.ToLower(c.opts.Encoding) {
+	case "", EncodingUTF8:
+		if c.opts.BOM {
+			if _, err := out.Write([]byte("\xef\xbb\xbf")); err != nil {
+				return err
+			}
+		}
+	case EncodingWindows1251, "cp1251":
+		tw := transform.NewWriter(out, charmap.Windows1251.NewEncoder())
+		out, closer = tw, tw
+		sanitize = toWindows1251
+	default:
+		return fmt.Errorf("unsupported csv encoding %q", c.opts.Encoding)
+	}
+
+	cw := csv.NewWriter(out)
+	if c.opts.Delimiter != 0 {
+		cw.Comma = c.opts.Delimiter
+	} else {
+		cw.Comma = ';'
+	}
+	cols := t.Columns()
+	record := make([]string, len(cols))
+	if !c.opts.NoHeader {
+		for i, col := range cols {
+			record[i] = sanitize(col.Name)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	for t.Next() {
+		for i, v := range t.Row() {
+			record[i] = sanitize(formatValue(v))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := t.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	if closer != nil {
+		return closer.Close()
+	}
+	return nil
+}
+
+// toWindows1251 заменяет символы, отсутствующие в Windows-1251, на '?'
+func toWindows1251(s string) string {
+	return strings.Map(func(ch rune) rune {
+		if _, ok := charmap.Windows1251.EncodeRune(ch); ok {
+			return ch
+		}
+		return '?'
+	}, s)
+}
@@ -0,0 +1,55 @@
+// Package export выгружает результаты отчетов в CSV, XLSX и JSON Lines.
+// Данные читаются построчно из Table, поэтому выгрузка не требует загрузки всего результата в память
+package export
+
+import (
+	"fmt"
+	"time"
+)
+
+// Типы колонок
+const (
+	ColumnString = iota
+	ColumnInt
+	ColumnFloat
+	ColumnTime
+)
+
+// Column колонка выгрузки
+type Column struct {
+	Name string
+	Type int
+}
+
+// Table источник строк выгрузки
+// Next переходит к следующей строке, Row возвращает значения текущей строки в порядке Columns
+type Table interface {
+	Columns() []Column
+	Next() bool
+	Row() []any
+	Err() error
+}
+
+// Writer выгружает таблицу в формат
+type Writer interface {
+	Write(t Table) error
+}
+
+// formatValue строковое представление значения колонки для текстовых форматов
+func formatValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case time.Time:
+		if val.IsZero() {
+			return ""
+		}
+		return val.Format(time.RFC3339)
+	case float32, float64:
+		return fmt.Sprintf("%g", val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
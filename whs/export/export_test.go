@@ -0,0 +1,91 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+	"strings"
+	"testing"
+)
+
+func testStock() *model.StockData {
+	return &model.StockData{Rows: []model.RowStock{
+		{Product: model.Product{Id: 1, Name: "Молоко; 1л"}, Zone: model.Zone{Name: "Хранение"}, Cells: []model.Cell{{Name: "1-1-01"}}, Quantity: 10},
+		{Product: model.Product{Id: 2, Name: "Tea ☕"}, Quantity: 3},
+	}}
+}
+
+func TestCSV_Windows1251(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewCSV(&buf, CSVOptions{Encoding: EncodingWindows1251}).Write(StockTable(testStock()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := charmap.Windows1251.NewDecoder().Bytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "product_id;product;manufacturer;zone;cell;quantity\n" +
+		"1;\"Молоко; 1л\";;Хранение;1-1-01;10\n" +
+		"2;Tea ?;;;;3\n"
+	if string(decoded) != want {
+		t.Errorf("csv =\n%s\nwant\n%s", decoded, want)
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewJSONLines(&buf).Write(StockTable(testStock())); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"product":"Молоко; 1л"`) || !strings.Contains(lines[1], `"quantity":3`) {
+		t.Errorf("json lines = %s", buf.String())
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewXLSX(&buf, "Остатки").Write(StockTable(testStock())); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows("Остатки")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][1] != "Молоко; 1л" || rows[2][5] != "3" {
+		t.Errorf("xlsx rows = %v", rows)
+	}
+	if typ, _ := f.GetCellType("Остатки", "F2"); typ == excelize.CellTypeSharedString || typ == excelize.CellTypeInlineString {
+		t.Errorf("quantity cell has string type")
+	}
+}
+
+func TestStockPagesTable(t *testing.T) {
+	pages := map[string]*model.StockPage{
+		"":   {Rows: testStock().Rows[:1], NextCursor: "p2"},
+		"p2": {Rows: testStock().Rows[1:]},
+	}
+	fetched := 0
+	table := StockPagesTable(func(cursor string) (*model.StockPage, error) {
+		fetched++
+		if p, ok := pages[cursor]; ok {
+			return p, nil
+		}
+		return nil, fmt.Errorf("unexpected cursor %q", cursor)
+	})
+	n := 0
+	for table.Next() {
+		n++
+	}
+	if table.Err() != nil || n != 2 || fetched != 2 {
+		t.Errorf("rows = %d, pages = %d, err = %v", n, fetched, table.Err())
+	}
+}
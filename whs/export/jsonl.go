@@ -0,0 +1,39 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type jsonLinesWriter struct {
+	w io.Writer
+}
+
+// NewJSONLines создает выгрузку в JSON Lines: по объекту с полями-колонками на строку
+func NewJSONLines(w io.Writer) Writer {
+	return &jsonLinesWriter{w: w}
+}
+
+func (j *jsonLinesWriter) Write(t Table) error {
+	bw := bufio.NewWriter(j.w)
+	enc := json.NewEncoder(bw)
+	cols := t.Columns()
+	obj := make(map[string]any, len(cols))
+	for t.Next() {
+		for i, v := range t.Row() {
+			if tm, ok := v.(time.Time); ok && tm.IsZero() {
+				v = nil
+			}
+			obj[cols[i].Name] = v
+		}
+		if err := enc.Encode(obj); err != nil {
+			return err
+		}
+	}
+	if err := t.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
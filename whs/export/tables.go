@@ -0,0 +1,151 @@
+package export
+
+import (
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+// sliceTable таблица из среза строк
+type sliceTable[T any] struct {
+	cols  []Column
+	items []T
+	row   func(item *T) []any
+	pos   int
+}
+
+// SliceTable создает таблицу из среза items, row возвращает значения колонок строки
+func SliceTable[T any](cols []Column, items []T, row func(item *T) []any) Table {
+	return &sliceTable[T]{cols: cols, items: items, row: row, pos: -1}
+}
+
+func (s *sliceTable[T]) Columns() []Column { return s.cols }
+func (s *sliceTable[T]) Next() bool {
+	s.pos++
+	return s.pos < len(s.items)
+}
+func (s *sliceTable[T]) Row() []any { return s.row(&s.items[s.pos]) }
+func (s *sliceTable[T]) Err() error { return nil }
+
+// StockColumns колонки выгрузки остатков
+var StockColumns = []Column{
+	{Name: "product_id", Type: ColumnInt},
+	{Name: "product", Type: ColumnString},
+	{Name: "manufacturer", Type: ColumnString},
+	{Name: "zone", Type: ColumnString},
+	{Name: "cell", Type: ColumnString},
+	{Name: "quantity", Type: ColumnInt},
+}
+
+func stockRow(r *model.RowStock) []any {
+	cell := ""
+	if len(r.Cells) > 0 {
+		cell = r.Cells[0].Name
+	}
+	return []any{r.Product.Id, r.Product.Name, r.Product.Manufacturer.Name, r.Zone.Name, cell, r.Quantity}
+}
+
+// StockTable таблица остатков из model.StockData
+func StockTable(data *model.StockData) Table {
+	return SliceTable(StockColumns, data.Rows, stockRow)
+}
+
+// StockPageFunc возвращает страницу остатков, следующую за курсором cursor
+type StockPageFunc func(cursor string) (*model.StockPage, error)
+
+// pagedStockTable таблица остатков, читаемая постранично
+type pagedStockTable struct {
+	fetch StockPageFunc
+	page  *model.StockPage
+	pos   int
+	done  bool
+	err   error
+}
+
+// StockPagesTable создает таблицу остатков, загружающую страницы по мере чтения
+func StockPagesTable(fetch StockPageFunc) Table {
+	return &pagedStockTable{fetch: fetch}
+}
+
+func (p *pagedStockTable) Columns() []Column { return StockColumns }
+
+func (p *pagedStockTable) Next() bool {
+	if p.err != nil {
+		return false
+	}
+	p.pos++
+	for p.page == nil || p.pos >= len(p.page.Rows) {
+		if p.done {
+			return false
+		}
+		cursor := ""
+		if p.page != nil {
+			cursor = p.page.NextCursor
+		}
+		p.page, p.err = p.fetch(cursor)
+		if p.err != nil {
+			return false
+		}
+		p.pos = 0
+		p.done = p.page.NextCursor == ""
+	}
+	return true
+}
+
+func (p *pagedStockTable) Row() []any { return stockRow(&p.page.Rows[p.pos]) }
+func (p *pagedStockTable) Err() error { return p.err }
+
+// AgingColumns колонки выгрузки возраста остатков
+var AgingColumns = []Column{
+	{Name: "product_id", Type: ColumnInt},
+	{Name: "product", Type: ColumnString},
+	{Name: "cell", Type: ColumnString},
+	{Name: "quantity", Type: ColumnInt},
+	{Name: "oldest_days", Type: ColumnInt},
+	{Name: "days_0_30", Type: ColumnInt},
+	{Name: "days_31_90", Type: ColumnInt},
+	{Name: "days_91_180", Type: ColumnInt},
+	{Name: "days_180_plus", Type: ColumnInt},
+}
+
+// AgingTable таблица возраста остатков
+func AgingTable(rows []model.AgingRow) Table {
+	return SliceTable(AgingColumns, rows, func(r *model.AgingRow) []any {
+		return []any{r.Product.Id, r.Product.Name, r.Cell.Name, r.Quantity, r.OldestDays,
+			r.Buckets.Days0To30, r.Buckets.Days31To90, r.Buckets.Days91To180, r.Buckets.Days180Plus}
+	})
+}
+
+// AbcXyzColumns колонки выгрузки ABC/XYZ анализа
+var AbcXyzColumns = []Column{
+	{Name: "product_id", Type: ColumnInt},
+	{Name: "quantity", Type: ColumnInt},
+	{Name: "value", Type: ColumnFloat},
+	{Name: "variation", Type: ColumnFloat},
+	{Name: "abc", Type: ColumnString},
+	{Name: "xyz", Type: ColumnString},
+}
+
+// AbcXyzTable таблица ABC/XYZ анализа
+func AbcXyzTable(rows []model.AbcXyzRow) Table {
+	return SliceTable(AbcXyzColumns, rows, func(r *model.AbcXyzRow) []any {
+		return []any{r.Product.Id, r.Quantity, r.Value, r.Variation, r.Abc, r.Xyz}
+	})
+}
+
+// KpiColumns колонки выгрузки рядов KPI
+var KpiColumns = []Column{
+	{Name: "period", Type: ColumnTime},
+	{Name: "zone_id", Type: ColumnInt},
+	{Name: "inbound_lines", Type: ColumnInt},
+	{Name: "inbound_qty", Type: ColumnInt},
+	{Name: "outbound_lines", Type: ColumnInt},
+	{Name: "outbound_qty", Type: ColumnInt},
+	{Name: "move_lines", Type: ColumnInt},
+	{Name: "move_qty", Type: ColumnInt},
+}
+
+// KpiTable таблица рядов KPI
+func KpiTable(points []model.KpiPoint) Table {
+	return SliceTable(KpiColumns, points, func(p *model.KpiPoint) []any {
+		return []any{p.Period, p.ZoneId, p.InboundLines, p.InboundQty, p.OutboundLines, p.OutboundQty, p.MoveLines, p.MoveQty}
+	})
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"github.com/xuri/excelize/v2"
+	"io"
+	"time"
+)
+
+type xlsxWriter struct {
+	w     io.Writer
+	sheet string
+}
+
+// NewXLSX создает выгрузку в XLSX на лист sheet. Значения записываются с типами колонок,
+// строки пишутся потоково (excelize.StreamWriter)
+func NewXLSX(w io.Writer, sheet string) Writer {
+	if sheet == "" {
+		sheet = "Sheet1"
+	}
+	return &xlsxWriter{w: w, sheet: sheet}
+}
+
+func (x *xlsxWriter) Write(t Table) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	if x.sheet != "Sheet1" {
+		if err := f.SetSheetName("Sheet1", x.sheet); err != nil {
+			return err
+		}
+	}
+	sw, err := f.NewStreamWriter(x.sheet)
+	if err != nil {
+		return err
+	}
+	timeStyle, err := f.NewStyle(&excelize.Style{NumFmt: 22}) // m/d/yy h:mm
+	if err != nil {
+		return err
+	}
+	boldStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	cols := t.Columns()
+	header := make([]any, len(cols))
+	for i, col := range cols {
+		header[i] = excelize.Cell{Value: col.Name, StyleID: boldStyle}
+	}
+	if err = sw.SetRow("A1", header); err != nil {
+		return err
+	}
+	rowNum := 1
+	for t.Next() {
+		rowNum++
+		values := t.Row()
+		cells := make([]any, len(values))
+		for i, v := range values {
+			cells[i] = typedValue(cols[i], v, timeStyle)
+		}
+		cell, err := excelize.CoordinatesToCellName(1, rowNum)
+		if err != nil {
+			return err
+		}
+		if err = sw.SetRow(cell, cells); err != nil {
+			return err
+		}
+	}
+	if err = t.Err(); err != nil {
+		return err
+	}
+	if err = sw.Flush(); err != nil {
+		return err
+	}
+	_, err = f.WriteTo(x.w)
+	return err
+}
+
+// typedValue приводит значение к типу колонки
+func typedValue(col Column, v any, timeStyle int) any {
+	switch col.Type {
+	case ColumnTime:
+		if tm, ok := v.(time.Time); ok {
+			if tm.IsZero() {
+				return nil
+			}
+			return excelize.Cell{Value: tm, StyleID: timeStyle}
+		}
+	case ColumnString:
+		if v != nil {
+			return formatValue(v)
+		}
+	}
+	return v
+}
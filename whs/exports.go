@@ -0,0 +1,21 @@
+package whs
+
+import (
+	"context"
+	"github.com/mlplabs/mwms-core/whs/export"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+// ExportPageSize количество строк, читаемых из БД за один запрос при выгрузке
+var ExportPageSize = 1000
+
+// ExportStocks выгружает остатки по запросу q в w, читая их постранично
+func (s *Storage) ExportStocks(ctx context.Context, q model.StockQuery, w export.Writer) error {
+	if q.Limit == 0 {
+		q.Limit = ExportPageSize
+	}
+	return w.Write(export.StockPagesTable(func(cursor string) (*model.StockPage, error) {
+		q.Cursor = cursor
+		return s.QueryStocks(ctx, &q)
+	}))
+}
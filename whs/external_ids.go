@@ -0,0 +1,183 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+const tableExternalIds = "external_ids"
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SetExternalId сохраняет (добавляет или переназначает) сопоставление внешнего идентификатора
+func (s *Storage) SetExternalId(ctx context.Context, ext *model.ExternalId) error {
+	if ext.System == "" || ext.Key == "" || ext.Entity == "" {
+		return core.Validation(tableExternalIds, 0, "external id system, key and entity are required")
+	}
+	return s.unit(ctx, func(s *Storage) error {
+		return s.setExternalId(ctx, ext)
+	})
+}
+
+// setExternalId сохраняет сопоставление внешнего идентификатора и записывает его изменение в журнал аудита
+func (s *Storage) setExternalId(ctx context.Context, ext *model.ExternalId) error {
+	before, err := s.externalIdEntry(ctx, ext.System, ext.Entity, ext.Key)
+	if err != nil {
+		return err
+	}
+	if err = storeExternalId(ctx, s.db(), ext.System, ext.Entity, ext.Key, ext.Id); err != nil {
+		return err
+	}
+	return s.audit(ctx, model.EntityExternalId, auditAction(before != nil, true), ext.Id, before, ext)
+}
+
+// DeleteExternalId удаляет сопоставление внешнего идентификатора
+func (s *Storage) DeleteExternalId(ctx context.Context, system, entity, key string) error {
+	sqlDel := fmt.Sprintf("DELETE FROM %s WHERE system = $1 AND entity = $2 AND ext_key = $3", tableExternalIds)
+	return s.unit(ctx, func(s *Storage) error {
+		before, err := s.externalIdEntry(ctx, system, entity, key)
+		if err != nil || before == nil {
+			return err
+		}
+		if _, err = s.db().ExecContext(ctx, sqlDel, system, entity, key); err != nil {
+			return err
+		}
+		return s.audit(ctx, model.EntityExternalId, model.AuditDelete, before.Id, before, nil)
+	})
+}
+
+// externalIdEntry возвращает сопоставление идентификатора key системы system, nil - если сопоставления нет
+func (s *Storage) externalIdEntry(ctx context.Context, system, entity, key string) (*model.ExternalId, error) {
+	id, err := lookupExternalId(ctx, s.db(), system, entity, key)
+	if err != nil || id == 0 {
+		return nil, err
+	}
+	return &model.ExternalId{System: system, Key: key, Entity: entity, Id: id}, nil
+}
+
+// LookupExternalId возвращает id сущности entity по идентификатору key системы system, 0 - если сопоставления нет
+func (s *Storage) LookupExternalId(ctx context.Context, system, entity, key string) (int64, error) {
+	return lookupExternalId(ctx, s.db(), system, entity, key)
+}
+
+// GetExternalIds возвращает все внешние идентификаторы сущности entity с id
+func (s *Storage) GetExternalIds(ctx context.Context, entity string, id int64) ([]model.ExternalId, error) {
+	items := make([]model.ExternalId, 0)
+	sqlSel := fmt.Sprintf("SELECT system, ext_key, entity, id FROM %s WHERE entity = $1 AND id = $2 ORDER BY system, ext_key", tableExternalIds)
+	rows, err := s.db().QueryContext(ctx, sqlSel, entity, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := model.ExternalId{}
+		if err = rows.Scan(&item.System, &item.Key, &item.Entity, &item.Id); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// FindProductsByExternalId returns a product by its id in external system
+func (s *Storage) FindProductsByExternalId(ctx context.Context, system, key string) ([]model.Product, error) {
+	items := make([]model.Product, 0)
+	id, err := s.LookupExternalId(ctx, system, model.EntityProduct, key)
+	if err != nil || id == 0 {
+		return items, err
+	}
+	item, err := s.GetProductById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(items, *item), nil
+}
+
+// FindManufacturersByExternalId returns a manufacturer by its id in external system
+func (s *Storage) FindManufacturersByExternalId(ctx context.Context, system, key string) ([]model.Manufacturer, error) {
+	items := make([]model.Manufacturer, 0)
+	id, err := s.LookupExternalId(ctx, system, model.EntityManufacturer, key)
+	if err != nil || id == 0 {
+		return items, err
+	}
+	item, err := s.GetManufacturerById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(items, *item), nil
+}
+
+// FindWarehousesByExternalId returns a warehouse by its id in external system
+func (s *Storage) FindWarehousesByExternalId(ctx context.Context, system, key string) ([]model.Warehouse, error) {
+	items := make([]model.Warehouse, 0)
+	id, err := s.LookupExternalId(ctx, system, model.EntityWarehouse, key)
+	if err != nil || id == 0 {
+		return items, err
+	}
+	item, err := s.GetWarehouseById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(items, *item), nil
+}
+
+// FindUsersByExternalId returns a user by its id in external system
+func (s *Storage) FindUsersByExternalId(ctx context.Context, system, key string) ([]model.User, error) {
+	items := make([]model.User, 0)
+	id, err := s.LookupExternalId(ctx, system, model.EntityUser, key)
+	if err != nil || id == 0 {
+		return items, err
+	}
+	item, err := s.GetUserById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(items, *item), nil
+}
+
+// lookupExternalId возвращает id сущности entity по внешнему идентификатору, 0 - если сопоставления нет
+func lookupExternalId(ctx context.Context, db queryer, system, entity, key string) (int64, error) {
+	var id int64
+	sqlSel := fmt.Sprintf("SELECT id FROM %s WHERE system = $1 AND entity = $2 AND ext_key = $3", tableExternalIds)
+	err := db.QueryRowContext(ctx, sqlSel, system, entity, key).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// externalKey возвращает идентификатор сущности entity с id в системе system, "" - если сопоставления нет
+func externalKey(ctx context.Context, db queryer, system, entity string, id int64) (string, error) {
+	var key string
+	sqlSel := fmt.Sprintf("SELECT ext_key FROM %s WHERE system = $1 AND entity = $2 AND id = $3 ORDER BY ext_key LIMIT 1", tableExternalIds)
+	err := db.QueryRowContext(ctx, sqlSel, system, entity, id).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return key, err
+}
+
+// storeExternalId сохраняет сопоставление внешнего идентификатора с id сущности entity
+func storeExternalId(ctx context.Context, db execer, system, entity, key string, id int64) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (system, entity, ext_key, id) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (system, entity, ext_key) DO UPDATE SET id = excluded.id`, tableExternalIds), system, entity, key, id)
+	return err
+}
@@ -0,0 +1,191 @@
+package whs
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"time"
+)
+
+// MaxIdempotencyKeyLen максимальная длина ключа идемпотентности (колонка row_id ledger)
+const MaxIdempotencyKeyLen = 36
+
+// DefaultKeyRetention срок хранения ключей идемпотентности, если Wms.KeyRetention не задан
+var DefaultKeyRetention = 7 * 24 * time.Hour
+
+// ErrIdempotencyKeyReused ключ идемпотентности уже использован операцией с другими параметрами
+// Возвращается в составе core.Error вида core.ErrConflict
+var ErrIdempotencyKeyReused = errors.New("idempotency key is already used by another operation")
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey возвращает контекст с ключом идемпотентности операции key
+// Операция с остатками (PutItemToCell, GetItemFromCell, MoveItemToCell), повторно вызванная с тем же ключом
+// в течение срока хранения, не пишет ledger, а возвращает результат первого вызова.
+// Так же ключ учитывают создание записей справочников (Create*), CreateWaves, SetWaveStatus и ImportProducts:
+// их ключи и результаты хранятся в таблице operation_keys
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// IdempotencyKey возвращает ключ идемпотентности контекста ("" - ключ не задан)
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key
+}
+
+// CheckIdempotencyKey проверяет длину ключа идемпотентности
+func CheckIdempotencyKey(key string) error {
+	if len(key) > MaxIdempotencyKeyLen {
+		return core.Validation("", 0, "idempotency key is longer than %d bytes", MaxIdempotencyKeyLen)
+	}
+	return nil
+}
+
+func (w *Wms) keyRetention() time.Duration {
+	if w.KeyRetention > 0 {
+		return w.KeyRetention
+	}
+	return DefaultKeyRetention
+}
+
+// replay ищет в ledger склада whsId строки операции с ключом key, записанные в течение срока хранения ключей
+// Если операция найдена, возвращает ее количество и true. Операция должна совпадать с текущей:
+// тип docType, продукт itemId, ячейка cellId (для отбора и перемещения - ячейка-источник),
+// ячейка-получатель перемещения cellDstId (0 - не перемещение) и количество quantity,
+// иначе возвращается ErrIdempotencyKeyReused
+// Ключ блокируется до конца транзакции, поэтому конкурентные повторы выполняются последовательно
+func (s *Storage) replay(ctx context.Context, tx *sql.Tx, whsId int64, key string, docType int, itemId int64, cellId int64, cellDstId int64, quantity int) (int, bool, error) {
+	if err := CheckIdempotencyKey(key); err != nil {
+		return 0, false, err
+	}
+	if err := s.lock(ctx, tx, fmt.Sprintf("key%d:%s", whsId, key)); err != nil {
+		return 0, false, err
+	}
+	sqlSel := fmt.Sprintf("SELECT doc_type, prod_id, cell_id, quantity FROM storage%d "+
+		"WHERE row_id = $1 AND row_time >= $2 ORDER BY quantity", whsId)
+	rows, err := tx.QueryContext(ctx, sqlSel, key, s.wms.timeArg(time.Now().Add(-s.wms.keyRetention())))
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+	// строки упорядочены по количеству: первая - списание (источник), последняя - поступление (получатель перемещения)
+	var storedType, storedQty, n int
+	var storedProd, storedCell, storedDst int64
+	for rows.Next() {
+		var typ, qty int
+		var prod, cell int64
+		if err = rows.Scan(&typ, &prod, &cell, &qty); err != nil {
+			return 0, false, err
+		}
+		if n == 0 {
+			storedType, storedProd, storedCell, storedQty = typ, prod, cell, qty
+		}
+		storedDst = cell
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return 0, false, err
+	}
+	if n == 0 {
+		return 0, false, nil
+	}
+	if cellDstId == 0 {
+		storedDst = 0
+	}
+	if storedQty < 0 {
+		storedQty = -storedQty
+	}
+	if storedType != docType || storedProd != itemId || storedCell != cellId || storedDst != cellDstId || storedQty != quantity {
+		return 0, false, &core.Error{Kind: core.ErrConflict, Entity: fmt.Sprintf("storage%d", whsId), Msg: fmt.Sprintf("%s: %q", ErrIdempotencyKeyReused, key), Err: ErrIdempotencyKeyReused}
+	}
+	return storedQty, true, nil
+}
+
+// idempotent выполняет операцию operation с параметрами request однократно для ключа идемпотентности контекста
+// Повторный вызов с тем же ключом в течение срока хранения возвращает сохраненный результат первого вызова,
+// вызов с ключом другой операции или других параметров - ErrIdempotencyKeyReused. Без ключа op просто выполняется.
+// op выполняется в единице работы вместе с сохранением ключа и получает контекст без ключа,
+// поэтому вложенные операции ключ не используют
+func idempotent[T any](s *Storage, ctx context.Context, operation string, request any, op func(ctx context.Context, s *Storage) (T, error)) (T, error) {
+	var res T
+	key := IdempotencyKey(ctx)
+	if key == "" {
+		return op(ctx, s)
+	}
+	if err := CheckIdempotencyKey(key); err != nil {
+		return res, err
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return res, err
+	}
+	sum := sha256.Sum256(append([]byte(operation+":"), data...))
+	fingerprint := hex.EncodeToString(sum[:])
+
+	err = s.unit(ctx, func(s *Storage) error {
+		if err := s.lock(ctx, s.tx.sqlTx, "op:"+key); err != nil {
+			return err
+		}
+		var storedOp, storedReq, result string
+		err := s.db().QueryRowContext(ctx, "SELECT operation, request, result FROM operation_keys WHERE op_key = $1 AND created_at >= $2",
+			key, s.wms.timeArg(time.Now().Add(-s.wms.keyRetention()))).Scan(&storedOp, &storedReq, &result)
+		switch {
+		case err == nil:
+			if storedOp != operation || storedReq != fingerprint {
+				return &core.Error{Kind: core.ErrConflict, Entity: "operation_keys", Msg: fmt.Sprintf("%s: %q", ErrIdempotencyKeyReused, key), Err: ErrIdempotencyKeyReused}
+			}
+			return json.Unmarshal([]byte(result), &res)
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+
+		if res, err = op(WithIdempotencyKey(ctx, ""), s); err != nil {
+			return err
+		}
+		out, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		// ключ с истекшим сроком хранения используется повторно
+		if _, err = s.db().ExecContext(ctx, "DELETE FROM operation_keys WHERE op_key = $1", key); err != nil {
+			return err
+		}
+		_, err = s.db().ExecContext(ctx, "INSERT INTO operation_keys (op_key, operation, request, result, created_at) VALUES ($1, $2, $3, $4, $5)",
+			key, operation, fingerprint, string(out), s.wms.timeArg(time.Now()))
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return res, nil
+}
+
+// PurgeIdempotencyKeys очищает в ledger склада whsId ключи идемпотентности старше срока хранения
+// и удаляет такие же ключи прочих операций (operation_keys). Возвращает количество очищенных строк
+func (s *Storage) PurgeIdempotencyKeys(ctx context.Context, whsId int64) (int64, error) {
+	sqlUpd := fmt.Sprintf("UPDATE storage%d SET row_id = '' WHERE row_id <> '' AND row_time < $1", whsId)
+	var n int64
+	err := s.unit(ctx, func(s *Storage) error {
+		since := s.wms.timeArg(time.Now().Add(-s.wms.keyRetention()))
+		for _, query := range []string{sqlUpd, "DELETE FROM operation_keys WHERE created_at < $1"} {
+			res, err := s.db().ExecContext(ctx, query, since)
+			if err != nil {
+				return err
+			}
+			cnt, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			n += cnt
+		}
+		return nil
+	})
+	return n, err
+}
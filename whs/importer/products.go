@@ -0,0 +1,128 @@
+// Package importer читает строки импорта каталога из CSV, XLSX и JSON
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"strings"
+)
+
+// Форматы файлов импорта
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+	FormatJSON = "json"
+)
+
+// Колонки файла импорта продуктов (CSV, XLSX), порядок колонок определяется заголовком
+const (
+	ColumnExternalId   = "external_id"
+	ColumnName         = "name"
+	ColumnItemNumber   = "item_number"
+	ColumnManufacturer = "manufacturer"
+	ColumnBarcodes     = "barcodes" // несколько штрих-кодов разделяются '|' или ','
+)
+
+// ReadProducts читает строки импорта продуктов из r в формате format
+func ReadProducts(r io.Reader, format string) ([]model.ProductImportRow, error) {
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		return readProductsCSV(r)
+	case FormatXLSX:
+		return readProductsXLSX(r)
+	case FormatJSON:
+		return readProductsJSON(r)
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+func readProductsCSV(r io.Reader) ([]model.ProductImportRow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\xef\xbb\xbf")
+	cr := csv.NewReader(strings.NewReader(text))
+	// разделитель определяется по строке заголовков
+	header, _, _ := strings.Cut(text, "\n")
+	if strings.Count(header, ";") > strings.Count(header, ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return productRows(records)
+}
+
+func readProductsXLSX(r io.Reader) ([]model.ProductImportRow, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		return nil, err
+	}
+	return productRows(records)
+}
+
+func readProductsJSON(r io.Reader) ([]model.ProductImportRow, error) {
+	rows := make([]model.ProductImportRow, 0)
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+	return rows, nil
+}
+
+// productRows разбирает записи таблицы с заголовком в первой строке
+func productRows(records [][]string) ([]model.ProductImportRow, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("import file is empty")
+	}
+	idx := make(map[string]int)
+	for i, h := range records[0] {
+		idx[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, col := range []string{ColumnName, ColumnItemNumber} {
+		if _, ok := idx[col]; !ok {
+			return nil, fmt.Errorf("import file has no column %q", col)
+		}
+	}
+	get := func(rec []string, col string) string {
+		if i, ok := idx[col]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	rows := make([]model.ProductImportRow, 0, len(records)-1)
+	for n, rec := range records[1:] {
+		row := model.ProductImportRow{
+			Line:         n + 2,
+			ExternalId:   get(rec, ColumnExternalId),
+			Name:         get(rec, ColumnName),
+			ItemNumber:   get(rec, ColumnItemNumber),
+			Manufacturer: get(rec, ColumnManufacturer),
+			Barcodes:     make([]string, 0),
+		}
+		if row.Name == "" && row.ItemNumber == "" && row.ExternalId == "" {
+			continue // пустая строка
+		}
+		for _, bc := range strings.FieldsFunc(get(rec, ColumnBarcodes), func(r rune) bool { return r == '|' || r == ',' }) {
+			if bc = strings.TrimSpace(bc); bc != "" {
+				row.Barcodes = append(row.Barcodes, bc)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
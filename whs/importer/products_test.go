@@ -0,0 +1,55 @@
+package importer
+
+import (
+	"bytes"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"github.com/xuri/excelize/v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadProducts_CSV(t *testing.T) {
+	data := "\xef\xbb\xbfName;Item_Number;Manufacturer;Barcodes\n" +
+		"Молоко 1л;M-001;Простоквашино;4601234567893|2000000000015\n" +
+		";;;\n" +
+		"Кефир;K-002;;\n"
+	rows, err := ReadProducts(strings.NewReader(data), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.ProductImportRow{
+		{Line: 2, Name: "Молоко 1л", ItemNumber: "M-001", Manufacturer: "Простоквашино", Barcodes: []string{"4601234567893", "2000000000015"}},
+		{Line: 4, Name: "Кефир", ItemNumber: "K-002", Barcodes: []string{}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v, want %+v", rows, want)
+	}
+}
+
+func TestReadProducts_XLSX(t *testing.T) {
+	f := excelize.NewFile()
+	sheet := f.GetSheetName(0)
+	_ = f.SetSheetRow(sheet, "A1", &[]any{"item_number", "name", "barcodes"})
+	_ = f.SetSheetRow(sheet, "A2", &[]any{"A-1", "Чай", "46012345"})
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := ReadProducts(&buf, FormatXLSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ItemNumber != "A-1" || rows[0].Name != "Чай" || !reflect.DeepEqual(rows[0].Barcodes, []string{"46012345"}) {
+		t.Errorf("rows = %+v", rows)
+	}
+}
+
+func TestReadProducts_Errors(t *testing.T) {
+	if _, err := ReadProducts(strings.NewReader("name\nx\n"), FormatCSV); err == nil {
+		t.Error("expected error for missing item_number column")
+	}
+	if _, err := ReadProducts(strings.NewReader(""), "xml"); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
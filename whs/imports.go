@@ -0,0 +1,248 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+// ImportProducts загружает продукты с производителями и штрих-кодами.
+// Производители сопоставляются по имени (FindManufacturersByName) и создаются при отсутствии,
+// продукты обновляются по внешнему идентификатору (если указана opts.System), артикулу (ItemNumber) или создаются. Строки записываются пакетами
+// в транзакциях, ошибка строки не прерывает пакет и попадает в отчет.
+// В режиме DryRun все проверки выполняются, но изменения откатываются.
+// С ключом идемпотентности контекста (WithIdempotencyKey) импорт выполняется в одной транзакции,
+// а повтор с тем же ключом возвращает отчет первого вызова; в режиме DryRun ключ не учитывается
+func (s *Storage) ImportProducts(ctx context.Context, rows []model.ProductImportRow, opts model.ImportOptions) (*model.ImportReport, error) {
+	if opts.DryRun {
+		return s.importProducts(ctx, rows, opts)
+	}
+	request := struct {
+		Rows []model.ProductImportRow `json:"rows"`
+		Opts model.ImportOptions      `json:"opts"`
+	}{rows, opts}
+	return idempotent(s, ctx, "import products", request, func(ctx context.Context, s *Storage) (*model.ImportReport, error) {
+		return s.importProducts(ctx, rows, opts)
+	})
+}
+
+func (s *Storage) importProducts(ctx context.Context, rows []model.ProductImportRow, opts model.ImportOptions) (*model.ImportReport, error) {
+	report := &model.ImportReport{DryRun: opts.DryRun, Rows: make([]model.ImportRowResult, 0, len(rows))}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = model.DefaultImportBatchSize
+	}
+
+	// проверка строк, ошибки и результаты - по индексу строки в rows (номера строк источника могут повторяться)
+	valid := make([]int, 0, len(rows))
+	errs := make(map[int]string)
+	seen := make(map[string]int)
+	external := opts.System != ""
+	for i := range rows {
+		row := &rows[i]
+		if err := validateImportRow(row, external); err != nil {
+			errs[i] = err.Error()
+			continue
+		}
+		key := "item number " + row.ItemNumber
+		if external && row.ExternalId != "" {
+			key = "external id " + row.ExternalId
+		}
+		if line, ok := seen[key]; ok {
+			errs[i] = fmt.Sprintf("%s duplicates line %d", key, line)
+			continue
+		}
+		seen[key] = row.Line
+		valid = append(valid, i)
+	}
+
+	results := make(map[int]model.ImportRowResult)
+	for start := 0; start < len(valid); start += batchSize {
+		end := min(start+batchSize, len(valid))
+		err := s.importBatch(ctx, rows, valid[start:end], opts.DryRun, results, func(s *Storage, row *model.ProductImportRow) (model.ImportRowResult, error) {
+			manufacturerId, err := s.importManufacturer(ctx, row.Manufacturer)
+			if err != nil {
+				return model.ImportRowResult{}, err
+			}
+			if !external || row.ExternalId == "" {
+				return s.importProductRow(ctx, row, 0, manufacturerId)
+			}
+			productId, err := lookupExternalId(ctx, s.db(), opts.System, model.EntityProduct, row.ExternalId)
+			if err != nil {
+				return model.ImportRowResult{}, err
+			}
+			res, err := s.importProductRow(ctx, row, productId, manufacturerId)
+			if err != nil {
+				return res, err
+			}
+			res.ExternalId = row.ExternalId
+			return res, s.setExternalId(ctx, &model.ExternalId{System: opts.System, Key: row.ExternalId, Entity: model.EntityProduct, Id: res.ProductId})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, row := range rows {
+		if msg, ok := errs[i]; ok {
+			report.Add(model.ImportRowResult{Line: row.Line, ItemNumber: row.ItemNumber, ExternalId: row.ExternalId, Action: model.ImportActionError, Error: msg})
+			continue
+		}
+		report.Add(results[i])
+	}
+	return report, nil
+}
+
+// validateImportRow проверяет строку импорта, артикул не обязателен для строк с внешним идентификатором
+func validateImportRow(row *model.ProductImportRow, external bool) error {
+	if row.ItemNumber == "" && !(external && row.ExternalId != "") {
+		return core.Validation("products", 0, "item number is empty")
+	}
+	return validateProductRow(row)
+}
+
+// validateProductRow проверяет наименование и штрих-коды строки импорта
+func validateProductRow(row *model.ProductImportRow) error {
+	if row.Name == "" {
+		return core.Validation("products", 0, "product name is empty")
+	}
+	for _, bc := range row.Barcodes {
+		typ := model.DetectBarcodeType(bc)
+		if typ == model.BarcodeTypeCode128 && isEanLength(bc) {
+			// цифровой код длины EAN с неверной контрольной цифрой - скорее всего ошибка ввода
+			return &core.Error{Kind: core.ErrValidation, Entity: tableBarcodes, Msg: fmt.Sprintf("%s: %q has wrong check digit", model.ErrBarcodeInvalid, bc), Err: model.ErrBarcodeInvalid}
+		}
+		if err := model.ValidateBarcode(bc, typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEanLength(code string) bool {
+	if len(code) != 8 && len(code) != 13 && len(code) != 14 {
+		return false
+	}
+	for _, ch := range code {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// importManufacturer возвращает id производителя по имени, создавая его при отсутствии (0 - имя не задано)
+// Выполняется в транзакции строки импорта: при ошибке строки созданный производитель откатывается вместе с ней
+func (s *Storage) importManufacturer(ctx context.Context, name string) (int64, error) {
+	if name == "" {
+		return 0, nil
+	}
+	items, err := s.FindManufacturersByName(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(items) > 0 {
+		return items[0].Id, nil
+	}
+	return s.CreateManufacturer(ctx, &model.Manufacturer{Name: name})
+}
+
+// errDryRun откатывает пакет импорта в режиме DryRun
+var errDryRun = errors.New("import dry run")
+
+// importRowFunc записывает строку импорта в транзакции пакета s
+type importRowFunc func(s *Storage, row *model.ProductImportRow) (model.ImportRowResult, error)
+
+// importBatch записывает строки rows с индексами idx в одной транзакции, ошибка строки откатывает только эту строку
+// Результаты строк записываются в results по индексу строки
+func (s *Storage) importBatch(ctx context.Context, rows []model.ProductImportRow, idx []int, dryRun bool, results map[int]model.ImportRowResult, fn importRowFunc) error {
+	err := s.unit(ctx, func(s *Storage) error {
+		for _, i := range idx {
+			row := rows[i]
+			sp, err := s.begin(ctx)
+			if err != nil {
+				return err
+			}
+			res, err := fn(s, &row)
+			if err != nil {
+				if rbErr := sp.Rollback(); rbErr != nil {
+					return rbErr
+				}
+				res = model.ImportRowResult{Line: row.Line, ItemNumber: row.ItemNumber, ExternalId: row.ExternalId, Action: model.ImportActionError, Error: err.Error()}
+			} else if err = sp.Commit(); err != nil {
+				return err
+			}
+			results[i] = res
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// importProductRow обновляет продукт productId (если не 0 и существует) или продукт с тем же артикулом,
+// либо создает новый, и добавляет ему штрих-коды. Изменения записываются в журнал аудита
+func (s *Storage) importProductRow(ctx context.Context, row *model.ProductImportRow, productId, manufacturerId int64) (model.ImportRowResult, error) {
+	tx := s.db()
+	res := model.ImportRowResult{Line: row.Line, ItemNumber: row.ItemNumber, Action: model.ImportActionUpdate}
+	var err error
+	if productId != 0 {
+		err = tx.QueryRowContext(ctx, "SELECT id FROM products WHERE id = $1"+s.wms.forUpdate(), productId).Scan(&res.ProductId)
+	}
+	if (productId == 0 || errors.Is(err, sql.ErrNoRows)) && row.ItemNumber != "" {
+		err = tx.QueryRowContext(ctx, "SELECT id FROM products WHERE item_number = $1 ORDER BY id LIMIT 1"+s.wms.forUpdate(), row.ItemNumber).Scan(&res.ProductId)
+	} else if productId == 0 {
+		err = sql.ErrNoRows
+	}
+	var before any
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		res.Action = model.ImportActionCreate
+		err = tx.QueryRowContext(ctx, "INSERT INTO products (name, item_number, manufacturer_id) VALUES ($1, $2, $3) RETURNING id",
+			row.Name, row.ItemNumber, manufacturerId).Scan(&res.ProductId)
+	case err == nil:
+		if before, err = auditReaders[model.EntityProduct](s, ctx, res.ProductId); err != nil {
+			return res, err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE products SET name = $2, manufacturer_id = $3, version = version + 1 WHERE id = $1", res.ProductId, row.Name, manufacturerId)
+	}
+	if err != nil {
+		return res, err
+	}
+	action := model.AuditUpdate
+	if res.Action == model.ImportActionCreate {
+		action = model.AuditCreate
+	}
+	if err = s.auditAfter(ctx, model.EntityProduct, action, res.ProductId, before); err != nil {
+		return res, err
+	}
+
+	sqlFind := fmt.Sprintf("SELECT owner_id, owner_ref FROM %s WHERE name = $1", tableBarcodes)
+	sqlIns := fmt.Sprintf("INSERT INTO %s (name, barcode_type, owner_id, owner_ref) VALUES ($1, $2, $3, $4) RETURNING id", tableBarcodes)
+	for _, bc := range row.Barcodes {
+		var ownerId, barcodeId int64
+		var ownerRef string
+		err = tx.QueryRowContext(ctx, sqlFind, bc).Scan(&ownerId, &ownerRef)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			err = tx.QueryRowContext(ctx, sqlIns, bc, model.DetectBarcodeType(bc), res.ProductId, "products").Scan(&barcodeId)
+			if err == nil {
+				err = s.auditAfter(ctx, model.EntityBarcode, model.AuditCreate, barcodeId, nil)
+			}
+		case err == nil && (ownerId != res.ProductId || ownerRef != "products"):
+			err = core.Conflict(tableBarcodes, 0, "barcode %q belongs to %s %d", bc, ownerRef, ownerId)
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
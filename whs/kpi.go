@@ -0,0 +1,130 @@
+package whs
+
+import (
+	"context"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"time"
+)
+
+// ReportKpi возвращает показатели работы склада за период: ряды приходов, отборов и перемещений
+// по интервалам (и зонам), производительность пользователей, время от приемки до размещения
+// и время цикла заказа. Перемещение учитывается одной строкой (по приходу в ячейку-получатель)
+func (s *Storage) ReportKpi(ctx context.Context, q *model.KpiQuery) (*model.KpiReport, error) {
+	switch q.Period {
+	case model.KpiPeriodDay, model.KpiPeriodWeek, model.KpiPeriodMonth:
+	default:
+		return nil, core.Validation("", 0, "unknown kpi period %q", q.Period)
+	}
+	if !q.To.After(q.From) {
+		return nil, core.Validation("", 0, "invalid report period")
+	}
+	report := &model.KpiReport{Query: *q, Series: make([]model.KpiPoint, 0), Users: make([]model.UserThroughput, 0)}
+
+	sqlSeries := fmt.Sprintf("SELECT %[6]s AS period, CASE WHEN $4 THEN zone_id ELSE 0 END AS zone, "+
+		"  COUNT(*) FILTER (WHERE doc_type IN (%[2]d, %[3]d) AND quantity > 0), "+
+		"  coalesce(SUM(quantity) FILTER (WHERE doc_type IN (%[2]d, %[3]d) AND quantity > 0), 0), "+
+		"  COUNT(*) FILTER (WHERE doc_type IN (%[2]d, %[4]d) AND quantity < 0), "+
+		"  coalesce(-SUM(quantity) FILTER (WHERE doc_type IN (%[2]d, %[4]d) AND quantity < 0), 0), "+
+		"  COUNT(*) FILTER (WHERE doc_type = %[5]d AND quantity > 0), "+
+		"  coalesce(SUM(quantity) FILTER (WHERE doc_type = %[5]d AND quantity > 0), 0) "+
+		"FROM storage%[1]d WHERE row_time >= $1 AND row_time < $2 AND ($3 = 0 OR zone_id = $3) "+
+		"GROUP BY 1, 2 ORDER BY 1, 2", q.WhsId, DocTypeUnknown, DocTypeInbound, DocTypeOutbound, DocTypeMove, s.wms.truncTime(q.Period, "row_time"))
+	rows, err := s.db().QueryContext(ctx, sqlSeries, s.wms.timeArg(q.From), s.wms.timeArg(q.To), q.ZoneId, q.ByZone)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		p := model.KpiPoint{}
+		err = rows.Scan(scanTime(&p.Period), &p.ZoneId, &p.InboundLines, &p.InboundQty, &p.OutboundLines, &p.OutboundQty, &p.MoveLines, &p.MoveQty)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.Series = append(report.Series, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sqlUsers := fmt.Sprintf("SELECT user_id, COUNT(*), COUNT(DISTINCT %s) "+
+		"FROM storage%d WHERE row_time >= $1 AND row_time < $2 AND ($3 = 0 OR zone_id = $3) "+
+		"AND (doc_type <> %d OR quantity > 0) GROUP BY user_id ORDER BY user_id", s.wms.truncTime("hour", "row_time"), q.WhsId, DocTypeMove)
+	rows, err = s.db().QueryContext(ctx, sqlUsers, s.wms.timeArg(q.From), s.wms.timeArg(q.To), q.ZoneId)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		u := model.UserThroughput{}
+		if err = rows.Scan(&u.UserId, &u.Lines, &u.ActiveHours); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if u.ActiveHours > 0 {
+			u.LinesPerHour = float64(u.Lines) / float64(u.ActiveHours)
+		}
+		report.Users = append(report.Users, u)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if report.DockToStock, err = s.dockToStock(ctx, q); err != nil {
+		return nil, err
+	}
+
+	var cycle float64
+	orders := s.wms.jsonArrayLen("plan", "orders")
+	sqlCycle := fmt.Sprintf("SELECT coalesce(SUM(%s * %s) / NULLIF(SUM(%s), 0), 0) "+
+		"FROM %s WHERE whs_id = $1 AND status = $2 AND updated_at >= $3 AND updated_at < $4",
+		s.wms.secondsBetween("created_at", "updated_at"), orders, orders, tableWaves)
+	err = s.db().QueryRowContext(ctx, sqlCycle, q.WhsId, model.WaveStatusCompleted, s.wms.timeArg(q.From), s.wms.timeArg(q.To)).Scan(&cycle)
+	if err != nil {
+		return nil, err
+	}
+	report.OrderCycle = time.Duration(cycle * float64(time.Second))
+	return report, nil
+}
+
+// dockToStock среднее время нахождения продуктов в зонах приемки до перемещения из них (FIFO)
+func (s *Storage) dockToStock(ctx context.Context, q *model.KpiQuery) (time.Duration, error) {
+	sqlSel := fmt.Sprintf("SELECT s.prod_id, s.row_time, s.quantity FROM storage%d s "+
+		"JOIN zones z ON z.id = s.zone_id "+
+		"WHERE z.type = $1 AND s.row_time < $2 ORDER BY s.prod_id, s.row_time", q.WhsId)
+	rows, err := s.db().QueryContext(ctx, sqlSel, model.ZoneTypeAcceptance, s.wms.timeArg(q.To))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var total int
+	var weighted float64
+	movements := make([]model.Movement, 0)
+	flush := func() {
+		qty, dwell := model.FifoDwell(movements, q.From)
+		total += qty
+		weighted += float64(qty) * float64(dwell)
+		movements = movements[:0]
+	}
+	for rows.Next() {
+		m := model.Movement{}
+		if err = rows.Scan(&m.ProductId, scanTime(&m.Time), &m.Quantity); err != nil {
+			return 0, err
+		}
+		if len(movements) > 0 && movements[0].ProductId != m.ProductId {
+			flush()
+		}
+		movements = append(movements, m)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	flush()
+	if total == 0 {
+		return 0, nil
+	}
+	return time.Duration(weighted / float64(total)), nil
+}
@@ -0,0 +1,104 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+const tableLayouts = "whs_layouts"
+
+// GetLayout возвращает планировку склада whsId
+func (s *Storage) GetLayout(ctx context.Context, whsId int64) (*model.Layout, error) {
+	var data []byte
+	sqlSel := fmt.Sprintf("SELECT layout FROM %s WHERE whs_id = $1", tableLayouts)
+	err := s.db().QueryRowContext(ctx, sqlSel, whsId).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &core.Error{Kind: core.ErrNotFound, Entity: tableLayouts, Id: whsId, Msg: "warehouse has no layout", Err: model.ErrLayoutInvalid}
+		}
+		return nil, err
+	}
+	layout := model.Layout{}
+	if err = json.Unmarshal(data, &layout); err != nil {
+		return nil, err
+	}
+	layout.WhsId = whsId
+	return &layout, nil
+}
+
+// SaveLayout проверяет и сохраняет планировку склада
+func (s *Storage) SaveLayout(ctx context.Context, layout *model.Layout) error {
+	if layout.WhsId == 0 {
+		return core.Validation(tableLayouts, 0, "unacceptable action. whs id eq 0")
+	}
+	if err := layout.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(layout)
+	if err != nil {
+		return err
+	}
+	sqlUps := fmt.Sprintf("INSERT INTO %s (whs_id, layout) VALUES ($1, $2) "+
+		"ON CONFLICT (whs_id) DO UPDATE SET layout = excluded.layout", tableLayouts)
+	return s.unit(ctx, func(s *Storage) error {
+		before, err := s.GetLayout(ctx, layout.WhsId)
+		if errors.Is(err, core.ErrNotFound) {
+			before, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = s.db().ExecContext(ctx, sqlUps, layout.WhsId, string(data)); err != nil {
+			return err
+		}
+		return s.audit(ctx, model.EntityLayout, auditAction(before != nil, true), layout.WhsId, before, layout)
+	})
+}
+
+// CellsDistance возвращает пешее расстояние (м) между ячейками одного склада
+func (s *Storage) CellsDistance(ctx context.Context, cellSrcId int64, cellDstId int64) (float64, error) {
+	cellSrc, err := s.GetCellById(ctx, cellSrcId)
+	if err != nil {
+		return 0, err
+	}
+	cellDst, err := s.GetCellById(ctx, cellDstId)
+	if err != nil {
+		return 0, err
+	}
+	if cellSrc.WhsId != cellDst.WhsId {
+		return 0, core.Validation(tableCells, cellDstId, "cells %d and %d belong to different warehouses", cellSrcId, cellDstId)
+	}
+	layout, err := s.GetLayout(ctx, cellSrc.WhsId)
+	if err != nil {
+		return 0, err
+	}
+	return layout.Distance(cellSrc, cellDst)
+}
+
+// PickRoute возвращает маршрут обхода ячеек cellIds одного склада по стратегии strategy
+func (s *Storage) PickRoute(ctx context.Context, cellIds []int64, strategy model.RouteStrategy) (*model.Route, error) {
+	cells := make([]model.Cell, 0, len(cellIds))
+	for _, id := range cellIds {
+		cell, err := s.GetCellById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if len(cells) > 0 && cell.WhsId != cells[0].WhsId {
+			return nil, core.Validation(tableCells, cell.Id, "cells %d and %d belong to different warehouses", cells[0].Id, cell.Id)
+		}
+		cells = append(cells, *cell)
+	}
+	if len(cells) == 0 {
+		return &model.Route{Strategy: strategy, Stops: make([]model.RouteStop, 0)}, nil
+	}
+	layout, err := s.GetLayout(ctx, cells[0].WhsId)
+	if err != nil {
+		return nil, err
+	}
+	return layout.Route(cells, strategy)
+}
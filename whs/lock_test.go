@@ -0,0 +1,128 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder драйвер database/sql, записывающий выполненные запросы
+// Запрос ячейки возвращает ячейку склада 1, контроль остатка - нулевые остатки, остальные запросы - пустой результат
+type recorder struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (r *recorder) Open(string) (driver.Conn, error) { return &recConn{r}, nil }
+
+func (r *recorder) log(query string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = append(r.queries, query)
+}
+
+// index номер первого запроса, содержащего substr (-1 - не выполнялся)
+func (r *recorder) index(substr string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, q := range r.queries {
+		if strings.Contains(q, substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+type recConn struct{ r *recorder }
+
+func (c *recConn) Prepare(query string) (driver.Stmt, error) { return &recStmt{c.r, query}, nil }
+func (c *recConn) Close() error                              { return nil }
+func (c *recConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *recConn) Commit() error                             { c.r.log("COMMIT"); return nil }
+func (c *recConn) Rollback() error                           { c.r.log("ROLLBACK"); return nil }
+
+type recStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s *recStmt) Close() error  { return nil }
+func (s *recStmt) NumInput() int { return -1 }
+
+func (s *recStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.r.log(s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.r.log(s.query)
+	if strings.Contains(s.query, "FROM cells") {
+		return &recRows{values: [][]driver.Value{{int64(3), "A-1", int64(1), int64(1), int64(0), int64(0), int64(0), false, false, false, false, 0.0, 0.0}}}, nil
+	}
+	if strings.Contains(s.query, balanceQuery) {
+		return &recRows{values: [][]driver.Value{{int64(0), int64(0)}}}, nil
+	}
+	return &recRows{}, nil
+}
+
+type recRows struct{ values [][]driver.Value }
+
+func (r *recRows) Columns() []string {
+	if len(r.values) == 0 {
+		return nil
+	}
+	return make([]string, len(r.values[0]))
+}
+
+func (r *recRows) Close() error { return nil }
+
+func (r *recRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// balanceQuery часть запроса контроля остатка (balanceControl)
+const balanceQuery = "SUM(CASE WHEN lot = $3"
+
+var (
+	recOnce sync.Once
+	rec     = &recorder{}
+)
+
+// TestStockLock списание в PostgreSQL блокирует остаток ячейки до записи ledger и контроля остатка
+func TestStockLock(t *testing.T) {
+	recOnce.Do(func() { sql.Register("whs-recorder", rec) })
+	db, err := sql.Open("whs-recorder", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := NewStorage(NewWms(db))
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		op   func() (int, error)
+	}{
+		{"GetItemFromCell", func() (int, error) { return s.GetItemFromCell(ctx, 7, 3, 1) }},
+		{"MoveItemToCell", func() (int, error) { return s.MoveItemToCell(ctx, 7, 3, 3, 1) }},
+	}
+	for _, tt := range tests {
+		rec.queries = nil
+		if _, err := tt.op(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		lock, insert, control := rec.index("pg_advisory_xact_lock"), rec.index("INSERT INTO storage1"), rec.index(balanceQuery)
+		if lock < 0 || insert < 0 || control < 0 || lock > insert || lock > control {
+			t.Errorf("%s: lock at %d, insert at %d, balance control at %d in %q", tt.name, lock, insert, control, rec.queries)
+		}
+	}
+}
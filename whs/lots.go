@@ -0,0 +1,33 @@
+package whs
+
+import (
+	"context"
+	"github.com/mlplabs/mwms-core/core"
+)
+
+// MaxLotLen максимальная длина номера партии (колонка lot ledger)
+const MaxLotLen = 64
+
+type lotCtx struct{}
+
+// WithLot возвращает контекст операций с партией lot
+// PutItemToCell, GetItemFromCell и MoveItemToCell записывают партию в строки ledger, остатки партии
+// выбираются QueryStocks (StockFilter.Lot). При отборе партии контролируется и остаток партии в ячейке:
+// отобрать партию, которой нет в ячейке, нельзя (core.ErrInsufficientStock)
+func WithLot(ctx context.Context, lot string) context.Context {
+	return context.WithValue(ctx, lotCtx{}, lot)
+}
+
+// Lot возвращает партию контекста ("" - партия не задана)
+func Lot(ctx context.Context) string {
+	lot, _ := ctx.Value(lotCtx{}).(string)
+	return lot
+}
+
+// CheckLot проверяет длину номера партии
+func CheckLot(lot string) error {
+	if len(lot) > MaxLotLen {
+		return core.Validation("", 0, "lot is longer than %d bytes", MaxLotLen)
+	}
+	return nil
+}
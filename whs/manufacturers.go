@@ -2,9 +2,8 @@ package whs
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"github.com/lib/pq"
+	"github.com/mlplabs/mwms-core/core"
 	"github.com/mlplabs/mwms-core/whs/model"
 )
 
@@ -12,8 +11,8 @@ const tableManufacturers = "manufacturers"
 
 func (s *Storage) GetManufacturers(ctx context.Context) ([]model.Manufacturer, error) {
 	items := make([]model.Manufacturer, 0)
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s ORDER BY name ASC", tableManufacturers)
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel)
+	sqlSel := fmt.Sprintf("SELECT id, name, version FROM %s WHERE archived_at IS NULL ORDER BY name ASC", tableManufacturers)
+	rows, err := s.db().QueryContext(ctx, sqlSel)
 	if err != nil {
 		return items, err
 	}
@@ -21,7 +20,7 @@ func (s *Storage) GetManufacturers(ctx context.Context) ([]model.Manufacturer, e
 
 	for rows.Next() {
 		mnf := model.Manufacturer{}
-		err = rows.Scan(&mnf.Id, &mnf.Name)
+		err = rows.Scan(&mnf.Id, &mnf.Name, &mnf.Version)
 		items = append(items, mnf)
 	}
 	return items, nil
@@ -31,20 +30,21 @@ func (s *Storage) GetManufacturersItems(ctx context.Context, offset int, limit i
 	var totalCount int64
 	var sqlCond string
 	items := make([]model.Manufacturer, 0)
+	sqlCond = "WHERE archived_at IS NULL"
+	args := make([]any, 0)
 	if search != "" {
-		sqlCond = "WHERE name ILIKE '" + search + "%'"
+		sqlCond += " AND " + s.wms.ilike("name", "$1")
+		args = append(args, search+"%")
 	}
-	args := make([]any, 0)
 
 	if limit == 0 {
 		limit = DefaultRowsLimit
 	}
-	args = append(args, limit)
-	args = append(args, offset)
 
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s %s ORDER BY name ASC", tableManufacturers, sqlCond)
+	sqlSel := fmt.Sprintf("SELECT id, name, version FROM %s %s ORDER BY name ASC", tableManufacturers, sqlCond)
+	sqlPage := fmt.Sprintf("%s LIMIT $%d OFFSET $%d", sqlSel, len(args)+1, len(args)+2)
 
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel+" LIMIT $1 OFFSET $2", args...)
+	rows, err := s.db().QueryContext(ctx, sqlPage, append(args, limit, offset)...)
 	if err != nil {
 		return nil, totalCount, err
 	}
@@ -52,12 +52,12 @@ func (s *Storage) GetManufacturersItems(ctx context.Context, offset int, limit i
 
 	for rows.Next() {
 		mnf := model.Manufacturer{}
-		err = rows.Scan(&mnf.Id, &mnf.Name)
+		err = rows.Scan(&mnf.Id, &mnf.Name, &mnf.Version)
 		items = append(items, mnf)
 	}
 
 	sqlCount := fmt.Sprintf("SELECT COUNT(*) as count FROM ( %s ) sub", sqlSel)
-	err = s.wms.Db.QueryRowContext(ctx, sqlCount).Scan(&totalCount)
+	err = s.db().QueryRowContext(ctx, sqlCount, args...).Scan(&totalCount)
 	if err != nil {
 		return nil, totalCount, err
 	}
@@ -65,62 +65,63 @@ func (s *Storage) GetManufacturersItems(ctx context.Context, offset int, limit i
 }
 
 func (s *Storage) CreateManufacturer(ctx context.Context, mnf *model.Manufacturer) (int64, error) {
+	return s.created(ctx, model.EntityManufacturer, mnf, func(s *Storage) (int64, error) {
+		return s.createManufacturer(ctx, mnf)
+	})
+}
+
+func (s *Storage) createManufacturer(ctx context.Context, mnf *model.Manufacturer) (int64, error) {
 	var insertId int64
 	sqlCreate := fmt.Sprintf("INSERT INTO %s (name) VALUES ($1) RETURNING id", tableManufacturers)
-	err := s.wms.Db.QueryRowContext(ctx, sqlCreate, mnf.Name).Scan(&insertId)
+	err := s.db().QueryRowContext(ctx, sqlCreate, mnf.Name).Scan(&insertId)
 	return insertId, err
 }
 
 func (s *Storage) UpdateManufacturer(ctx context.Context, mnf *model.Manufacturer) (int64, error) {
-	sqlUpd := fmt.Sprintf("UPDATE %s SET name=$2 WHERE id=$1", tableManufacturers)
-	res, err := s.wms.Db.ExecContext(ctx, sqlUpd, mnf.Id, mnf.Name)
-	if err != nil {
+	if err := CheckVersion(tableManufacturers, mnf.Id, mnf.Version); err != nil {
 		return 0, err
 	}
-	if a, err := res.RowsAffected(); a != 1 || err != nil {
+	return s.audited(ctx, model.EntityManufacturer, model.AuditUpdate, mnf.Id, func(s *Storage) (int64, error) {
+		return s.updateManufacturer(ctx, mnf)
+	})
+}
+
+func (s *Storage) updateManufacturer(ctx context.Context, mnf *model.Manufacturer) (int64, error) {
+	sqlUpd := fmt.Sprintf("UPDATE %s SET name=$2, version=version+1 WHERE id=$1 AND %s", tableManufacturers, versionCond(3))
+	res, err := s.db().ExecContext(ctx, sqlUpd, mnf.Id, mnf.Name, mnf.Version)
+	if err != nil {
 		return 0, err
 	}
-	return mnf.Id, nil
+	return s.updated(ctx, res, tableManufacturers, mnf.Id, mnf.Version)
 }
 func (s *Storage) DeleteManufacturer(ctx context.Context, itemId int64) error {
 	if itemId == 0 {
-		return fmt.Errorf("unacceptable action. item id eq 0")
-	}
-	sqlDel := fmt.Sprintf("DELETE FROM %s WHERE id=$1", tableManufacturers)
-	_, err := s.wms.Db.ExecContext(ctx, sqlDel, itemId)
-	if err != nil {
-		var pgErr *pq.Error
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == ("23503") {
-				return err
-			}
-		}
-		return err
+		return core.Validation(tableManufacturers, 0, "unacceptable action. item id eq 0")
 	}
-	return nil
+	return s.deleteEntity(ctx, model.EntityManufacturer, itemId)
 }
 func (s *Storage) GetManufacturerById(ctx context.Context, itemId int64) (*model.Manufacturer, error) {
-	sqlUsr := fmt.Sprintf("SELECT id, name FROM %s WHERE id = $1", tableManufacturers)
-	row := s.wms.Db.QueryRowContext(ctx, sqlUsr, itemId)
+	sqlUsr := fmt.Sprintf("SELECT id, name, archived_at, version FROM %s WHERE id = $1", tableManufacturers)
+	row := s.db().QueryRowContext(ctx, sqlUsr, itemId)
 	newItem := model.Manufacturer{}
-	err := row.Scan(&newItem.Id, &newItem.Name)
+	err := row.Scan(&newItem.Id, &newItem.Name, scanNullTime(&newItem.ArchivedAt), &newItem.Version)
 	if err != nil {
-		return nil, err
+		return nil, core.Translate(tableManufacturers, itemId, err)
 	}
 	return &newItem, nil
 }
 
 func (s *Storage) FindManufacturersByName(ctx context.Context, itemName string) ([]model.Manufacturer, error) {
 	items := make([]model.Manufacturer, 0)
-	sql := fmt.Sprintf("SELECT id, name FROM %s WHERE name = $1", tableManufacturers)
-	rows, err := s.wms.Db.QueryContext(ctx, sql, itemName)
+	sql := fmt.Sprintf("SELECT id, name, version FROM %s WHERE name = $1", tableManufacturers)
+	rows, err := s.db().QueryContext(ctx, sql, itemName)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		mnf := model.Manufacturer{}
-		err = rows.Scan(&mnf.Id, &mnf.Name)
+		err = rows.Scan(&mnf.Id, &mnf.Name, &mnf.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -135,8 +136,8 @@ func (s *Storage) ManufacturersSuggest(ctx context.Context, text string, limit i
 		limit = DefaultSuggestionLimit
 	}
 
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE name ILIKE $1 LIMIT $2", tableManufacturers)
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel, text+"%", limit)
+	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE %s AND archived_at IS NULL LIMIT $2", tableManufacturers, s.wms.ilike("name", "$1"))
+	rows, err := s.db().QueryContext(ctx, sqlSel, text+"%", limit)
 	if err != nil {
 		return retVal, err
 	}
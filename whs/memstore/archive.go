@@ -0,0 +1,232 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"sort"
+	"time"
+)
+
+// archiveRef запись архивируемого справочника
+type archiveRef struct {
+	name       string
+	archivedAt *time.Time
+	set        func(at *time.Time) // устанавливает признак архива записи
+	remove     func()              // удаляет запись
+}
+
+// archiveRefs возвращает таблицу и записи справочника entity (model.Entity*)
+func (st *state) archiveRefs(entity string) (string, map[int64]archiveRef, error) {
+	refs := make(map[int64]archiveRef)
+	switch entity {
+	case model.EntityProduct:
+		for id, p := range st.products {
+			refs[id] = archiveRef{name: p.Name, archivedAt: p.ArchivedAt,
+				set:    func(at *time.Time) { p.ArchivedAt, p.Version = at, p.Version+1; st.products[id] = p },
+				remove: func() { delete(st.products, id) }}
+		}
+		return "products", refs, nil
+	case model.EntityManufacturer:
+		for id, mnf := range st.manufacturers {
+			refs[id] = archiveRef{name: mnf.Name, archivedAt: mnf.ArchivedAt,
+				set:    func(at *time.Time) { mnf.ArchivedAt, mnf.Version = at, mnf.Version+1; st.manufacturers[id] = mnf },
+				remove: func() { delete(st.manufacturers, id) }}
+		}
+		return "manufacturers", refs, nil
+	case model.EntityWarehouse:
+		for id, whs := range st.warehouses {
+			refs[id] = archiveRef{name: whs.Name, archivedAt: whs.ArchivedAt,
+				set:    func(at *time.Time) { whs.ArchivedAt, whs.Version = at, whs.Version+1; st.warehouses[id] = whs },
+				remove: func() { delete(st.warehouses, id); delete(st.ledger, id) }}
+		}
+		return "warehouses", refs, nil
+	case model.EntityUser:
+		for id, usr := range st.users {
+			refs[id] = archiveRef{name: usr.Name, archivedAt: usr.ArchivedAt,
+				set:    func(at *time.Time) { usr.ArchivedAt, usr.Version = at, usr.Version+1; st.users[id] = usr },
+				remove: func() { delete(st.users, id) }}
+		}
+		return "users", refs, nil
+	}
+	return "", nil, core.Validation("", 0, "entity %q can not be archived", entity)
+}
+
+func (s *Store) Archive(ctx context.Context, entity string, id int64) error {
+	return s.setArchived(ctx, entity, id, true)
+}
+
+func (s *Store) Restore(ctx context.Context, entity string, id int64) error {
+	return s.setArchived(ctx, entity, id, false)
+}
+
+func (s *Store) setArchived(ctx context.Context, entity string, id int64, archived bool) error {
+	return s.write(ctx, func(st *state) error {
+		table, refs, err := st.archiveRefs(entity)
+		if err != nil {
+			return err
+		}
+		ref, ok := refs[id]
+		switch {
+		case !ok:
+			return core.NotFound(table, id)
+		case !archived:
+			ref.set(nil)
+		case ref.archivedAt == nil:
+			now := time.Now()
+			ref.set(&now)
+		}
+		return nil
+	})
+}
+
+func (s *Store) GetArchived(ctx context.Context, entity string) ([]model.ArchivedItem, error) {
+	items := make([]model.ArchivedItem, 0)
+	err := s.read(ctx, func(st *state) error {
+		_, refs, err := st.archiveRefs(entity)
+		if err != nil {
+			return err
+		}
+		for id, ref := range refs {
+			if ref.archivedAt != nil {
+				items = append(items, model.ArchivedItem{Entity: entity, Id: id, Name: ref.name, ArchivedAt: *ref.archivedAt})
+			}
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].Name < items[j].Name || items[i].Name == items[j].Name && items[i].Id < items[j].Id
+		})
+		return nil
+	})
+	return items, err
+}
+
+// GetDependencies возвращает записи, ссылающиеся на запись справочника, см. whs.Storage
+// Хранилище не ведет волны и ячейки отбора, эти зависимости не возвращаются
+func (s *Store) GetDependencies(ctx context.Context, entity string, id int64) (*model.DependencyReport, error) {
+	var report *model.DependencyReport
+	err := s.read(ctx, func(st *state) (err error) {
+		report, err = st.dependencies(entity, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (st *state) dependencies(entity string, id int64) (*model.DependencyReport, error) {
+	table, refs, err := st.archiveRefs(entity)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := refs[id]; !ok {
+		return nil, core.NotFound(table, id)
+	}
+	report := &model.DependencyReport{Entity: entity, Id: id, Dependencies: make([]model.Dependency, 0)}
+	add := func(kind string, whsId int64, ids []int64) {
+		report.Add(model.Dependency{Kind: kind, WhsId: whsId, Count: int64(len(ids)), Ids: ids})
+	}
+	switch entity {
+	case model.EntityProduct:
+		add(model.DependencyBarcodes, 0, st.barcodeIds("products", id))
+		for _, whsId := range sortedKeys(st.warehouses) {
+			add(model.DependencyStock, whsId, st.stockCells(whsId, func(r ledgerRow) bool { return r.prodId == id }))
+			var docs int64
+			for _, r := range st.ledger[whsId] {
+				if r.prodId == id {
+					docs++
+				}
+			}
+			report.Add(model.Dependency{Kind: model.DependencyDocuments, WhsId: whsId, Count: docs})
+		}
+	case model.EntityManufacturer:
+		prodIds := make([]int64, 0)
+		for _, prodId := range sortedKeys(st.products) {
+			if st.products[prodId].manufacturerId == id {
+				prodIds = append(prodIds, prodId)
+			}
+		}
+		add(model.DependencyProducts, 0, prodIds)
+		add(model.DependencyBarcodes, 0, st.barcodeIds("manufacturers", id))
+	case model.EntityWarehouse:
+		cellIds := make([]int64, 0)
+		for _, cellId := range sortedKeys(st.cells) {
+			if st.cells[cellId].WhsId == id {
+				cellIds = append(cellIds, cellId)
+			}
+		}
+		add(model.DependencyCells, id, cellIds)
+		add(model.DependencyStock, id, st.stockCells(id, func(r ledgerRow) bool { return true }))
+		report.Add(model.Dependency{Kind: model.DependencyDocuments, WhsId: id, Count: int64(len(st.ledger[id]))})
+	case model.EntityUser:
+		for _, whsId := range sortedKeys(st.warehouses) {
+			var docs int64
+			for _, r := range st.ledger[whsId] {
+				if r.userId == id {
+					docs++
+				}
+			}
+			report.Add(model.Dependency{Kind: model.DependencyDocuments, WhsId: whsId, Count: docs})
+		}
+	}
+	return report, nil
+}
+
+// barcodeIds возвращает штрих-коды владельца ownerId из справочника ownerRef
+func (st *state) barcodeIds(ownerRef string, ownerId int64) []int64 {
+	ids := make([]int64, 0)
+	for _, bcId := range sortedKeys(st.barcodes) {
+		if bc := st.barcodes[bcId]; bc.OwnerRef == ownerRef && bc.OwnerId == ownerId {
+			ids = append(ids, bcId)
+		}
+	}
+	return ids
+}
+
+// stockCells возвращает ячейки склада whsId с ненулевым остатком продуктов строк ledger, отобранных match
+func (st *state) stockCells(whsId int64, match func(r ledgerRow) bool) []int64 {
+	type key struct{ cellId, prodId int64 }
+	balances := make(map[key]int)
+	for _, r := range st.ledger[whsId] {
+		if match(r) {
+			balances[key{r.cellId, r.prodId}] += r.quantity
+		}
+	}
+	cells := make(map[int64]bool)
+	for k, qty := range balances {
+		if qty != 0 {
+			cells[k.cellId] = true
+		}
+	}
+	return sortedKeys(cells)
+}
+
+// deleteEntity удаляет запись справочника, если на нее ничего не ссылается, см. whs.Storage
+func (s *Store) deleteEntity(ctx context.Context, entity string, id int64) error {
+	return s.write(ctx, func(st *state) error {
+		report, err := st.dependencies(entity, id)
+		if errors.Is(err, core.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		table, refs, _ := st.archiveRefs(entity)
+		if !report.Empty() {
+			return &core.Error{Kind: core.ErrReferenced, Entity: table, Id: id, Msg: "referenced by " + report.String()}
+		}
+		refs[id].remove()
+		return nil
+	})
+}
+
+// sortedKeys возвращает ключи map по возрастанию
+func sortedKeys[V any](m map[int64]V) []int64 {
+	keys := make([]int64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
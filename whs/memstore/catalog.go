@@ -0,0 +1,456 @@
+package memstore
+
+import (
+	"context"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+func (st *state) productView(p product) model.Product {
+	item := p.Product
+	item.Manufacturer = model.Manufacturer{Id: p.manufacturerId}
+	if mnf, ok := st.manufacturers[p.manufacturerId]; ok {
+		item.Manufacturer.Name = mnf.Name
+	}
+	return item
+}
+
+func (st *state) findProducts(match func(p product) bool) []model.Product {
+	items := make([]model.Product, 0)
+	for _, p := range sorted(st.products, func(a, b product) bool { return a.Id < b.Id }) {
+		if match(p) {
+			items = append(items, st.productView(p))
+		}
+	}
+	return items
+}
+
+func (s *Store) GetProducts(ctx context.Context) ([]model.Product, error) {
+	var items []model.Product
+	err := s.read(ctx, func(st *state) error {
+		items = make([]model.Product, 0, len(st.products))
+		for _, p := range sorted(st.products, func(a, b product) bool { return a.Name < b.Name || a.Name == b.Name && a.Id < b.Id }) {
+			if p.ArchivedAt == nil {
+				items = append(items, st.productView(p))
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) GetProductById(ctx context.Context, itemId int64) (*model.Product, error) {
+	var item model.Product
+	err := s.read(ctx, func(st *state) error {
+		p, ok := st.products[itemId]
+		if !ok {
+			return core.NotFound("products", itemId)
+		}
+		item = st.productView(p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *Store) CreateProduct(ctx context.Context, product *model.Product) (int64, error) {
+	var insertId int64
+	err := s.write(ctx, func(st *state) (err error) {
+		insertId, err = idempotent(ctx, st, s.KeyRetention, "create "+model.EntityProduct, product, func() (int64, error) {
+			id := st.nextId("products")
+			st.products[id] = newProduct(id, product)
+			return id, nil
+		})
+		return err
+	})
+	return insertId, err
+}
+
+func newProduct(id int64, src *model.Product) product {
+	return product{Product: model.Product{Id: id, Name: src.Name, ItemNumber: src.ItemNumber, Weight: src.Weight, Volume: src.Volume, Version: 1},
+		manufacturerId: src.Manufacturer.Id}
+}
+
+func (s *Store) UpdateProduct(ctx context.Context, product *model.Product) (int64, error) {
+	if err := checkVersionArg("products", product.Id, product.Version); err != nil {
+		return 0, err
+	}
+	var updated bool
+	err := s.write(ctx, func(st *state) error {
+		p, ok := st.products[product.Id]
+		if !ok {
+			return nil
+		}
+		if err := checkVersion("products", product.Id, product.Version, p.Version); err != nil {
+			return err
+		}
+		upd := newProduct(product.Id, product)
+		upd.ArchivedAt, upd.Version = p.ArchivedAt, p.Version+1
+		st.products[product.Id] = upd
+		updated = true
+		return nil
+	})
+	if err != nil || !updated {
+		return 0, err
+	}
+	return product.Id, nil
+}
+
+func (s *Store) DeleteProduct(ctx context.Context, itemId int64) error {
+	if itemId == 0 {
+		return errIdZero("products")
+	}
+	return s.deleteEntity(ctx, model.EntityProduct, itemId)
+}
+
+func (s *Store) FindProductsByName(ctx context.Context, itemName string) ([]model.Product, error) {
+	var items []model.Product
+	err := s.read(ctx, func(st *state) error {
+		items = st.findProducts(func(p product) bool { return p.Name == itemName })
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) FindProductsByBarcode(ctx context.Context, itemName string) ([]model.Product, error) {
+	var items []model.Product
+	err := s.read(ctx, func(st *state) error {
+		owners := make(map[int64]bool)
+		for _, bc := range st.barcodes {
+			if bc.OwnerRef == "products" && bc.Name == itemName {
+				owners[bc.OwnerId] = true
+			}
+		}
+		items = st.findProducts(func(p product) bool { return owners[p.Id] })
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) GetManufacturers(ctx context.Context) ([]model.Manufacturer, error) {
+	var items []model.Manufacturer
+	err := s.read(ctx, func(st *state) error {
+		items = active(sorted(st.manufacturers, func(a, b model.Manufacturer) bool { return a.Name < b.Name || a.Name == b.Name && a.Id < b.Id }),
+			func(mnf model.Manufacturer) bool { return mnf.ArchivedAt == nil })
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) GetManufacturerById(ctx context.Context, itemId int64) (*model.Manufacturer, error) {
+	var item model.Manufacturer
+	err := s.read(ctx, func(st *state) error {
+		var ok bool
+		if item, ok = st.manufacturers[itemId]; !ok {
+			return core.NotFound("manufacturers", itemId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *Store) CreateManufacturer(ctx context.Context, mnf *model.Manufacturer) (int64, error) {
+	var insertId int64
+	err := s.write(ctx, func(st *state) (err error) {
+		insertId, err = idempotent(ctx, st, s.KeyRetention, "create "+model.EntityManufacturer, mnf, func() (int64, error) {
+			id := st.nextId("manufacturers")
+			st.manufacturers[id] = model.Manufacturer{Id: id, Name: mnf.Name, Version: 1}
+			return id, nil
+		})
+		return err
+	})
+	return insertId, err
+}
+
+func (s *Store) UpdateManufacturer(ctx context.Context, mnf *model.Manufacturer) (int64, error) {
+	if err := checkVersionArg("manufacturers", mnf.Id, mnf.Version); err != nil {
+		return 0, err
+	}
+	var updated bool
+	err := s.write(ctx, func(st *state) error {
+		var item model.Manufacturer
+		if item, updated = st.manufacturers[mnf.Id]; !updated {
+			return nil
+		}
+		if err := checkVersion("manufacturers", mnf.Id, mnf.Version, item.Version); err != nil {
+			return err
+		}
+		item.Name, item.Version = mnf.Name, item.Version+1
+		st.manufacturers[mnf.Id] = item
+		return nil
+	})
+	if err != nil || !updated {
+		return 0, err
+	}
+	return mnf.Id, nil
+}
+
+func (s *Store) DeleteManufacturer(ctx context.Context, itemId int64) error {
+	if itemId == 0 {
+		return errIdZero("manufacturers")
+	}
+	return s.deleteEntity(ctx, model.EntityManufacturer, itemId)
+}
+
+func (s *Store) FindManufacturersByName(ctx context.Context, itemName string) ([]model.Manufacturer, error) {
+	items := make([]model.Manufacturer, 0)
+	err := s.read(ctx, func(st *state) error {
+		for _, mnf := range sorted(st.manufacturers, func(a, b model.Manufacturer) bool { return a.Id < b.Id }) {
+			if mnf.Name == itemName {
+				items = append(items, mnf)
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) GetBarcodeById(ctx context.Context, itemId int64) (*model.Barcode, error) {
+	var item model.Barcode
+	err := s.read(ctx, func(st *state) error {
+		var ok bool
+		if item, ok = st.barcodes[itemId]; !ok {
+			return core.NotFound("barcodes", itemId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *Store) CreateBarcode(ctx context.Context, bc *model.Barcode) (int64, error) {
+	var insertId int64
+	err := s.write(ctx, func(st *state) (err error) {
+		insertId, err = idempotent(ctx, st, s.KeyRetention, "create "+model.EntityBarcode, bc, func() (int64, error) {
+			id := st.nextId("barcodes")
+			st.barcodes[id] = model.Barcode{Id: id, Name: bc.Name, Type: bc.Type, OwnerId: bc.OwnerId, OwnerRef: bc.OwnerRef, Version: 1}
+			return id, nil
+		})
+		return err
+	})
+	return insertId, err
+}
+
+func (s *Store) UpdateBarcode(ctx context.Context, bc *model.Barcode) (int64, error) {
+	if err := checkVersionArg("barcodes", bc.Id, bc.Version); err != nil {
+		return 0, err
+	}
+	var updated bool
+	err := s.write(ctx, func(st *state) error {
+		var item model.Barcode
+		if item, updated = st.barcodes[bc.Id]; !updated {
+			return nil
+		}
+		if err := checkVersion("barcodes", bc.Id, bc.Version, item.Version); err != nil {
+			return err
+		}
+		st.barcodes[bc.Id] = model.Barcode{Id: bc.Id, Name: bc.Name, Type: bc.Type, OwnerId: bc.OwnerId, OwnerRef: bc.OwnerRef, Version: item.Version + 1}
+		return nil
+	})
+	if err != nil || !updated {
+		return 0, err
+	}
+	return bc.Id, nil
+}
+
+func (s *Store) DeleteBarcode(ctx context.Context, itemId int64) error {
+	if itemId == 0 {
+		return errIdZero("barcodes")
+	}
+	return s.write(ctx, func(st *state) error {
+		delete(st.barcodes, itemId)
+		return nil
+	})
+}
+
+func (s *Store) findBarcodes(ctx context.Context, match func(bc model.Barcode) bool) ([]model.Barcode, error) {
+	items := make([]model.Barcode, 0)
+	err := s.read(ctx, func(st *state) error {
+		for _, bc := range sorted(st.barcodes, func(a, b model.Barcode) bool { return a.Id < b.Id }) {
+			if match(bc) {
+				items = append(items, bc)
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) FindBarcodesByName(ctx context.Context, itemName string) ([]model.Barcode, error) {
+	return s.findBarcodes(ctx, func(bc model.Barcode) bool { return bc.Name == itemName })
+}
+
+func (s *Store) FindBarcodesByOwnerId(ctx context.Context, ownerId int64, ownerRef string) ([]model.Barcode, error) {
+	return s.findBarcodes(ctx, func(bc model.Barcode) bool { return bc.OwnerId == ownerId && bc.OwnerRef == ownerRef })
+}
+
+func (s *Store) GetWarehouses(ctx context.Context) ([]model.Warehouse, error) {
+	var items []model.Warehouse
+	err := s.read(ctx, func(st *state) error {
+		items = active(sorted(st.warehouses, func(a, b model.Warehouse) bool { return a.Name < b.Name || a.Name == b.Name && a.Id < b.Id }),
+			func(whs model.Warehouse) bool { return whs.ArchivedAt == nil })
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) GetWarehouseById(ctx context.Context, itemId int64) (*model.Warehouse, error) {
+	var item model.Warehouse
+	err := s.read(ctx, func(st *state) error {
+		var ok bool
+		if item, ok = st.warehouses[itemId]; !ok {
+			return core.NotFound("warehouses", itemId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CreateWarehouse создает склад и его (пустой) ledger
+func (s *Store) CreateWarehouse(ctx context.Context, whs *model.Warehouse) (int64, error) {
+	var insertId int64
+	err := s.write(ctx, func(st *state) (err error) {
+		insertId, err = idempotent(ctx, st, s.KeyRetention, "create "+model.EntityWarehouse, whs, func() (int64, error) {
+			id := st.nextId("warehouses")
+			st.warehouses[id] = model.Warehouse{Id: id, Name: whs.Name, Version: 1}
+			st.ledger[id] = make([]ledgerRow, 0)
+			return id, nil
+		})
+		return err
+	})
+	return insertId, err
+}
+
+func (s *Store) UpdateWarehouse(ctx context.Context, whs *model.Warehouse) (int64, error) {
+	if err := checkVersionArg("warehouses", whs.Id, whs.Version); err != nil {
+		return 0, err
+	}
+	var updated bool
+	err := s.write(ctx, func(st *state) error {
+		var item model.Warehouse
+		if item, updated = st.warehouses[whs.Id]; !updated {
+			return nil
+		}
+		if err := checkVersion("warehouses", whs.Id, whs.Version, item.Version); err != nil {
+			return err
+		}
+		item.Name, item.Version = whs.Name, item.Version+1
+		st.warehouses[whs.Id] = item
+		return nil
+	})
+	if err != nil || !updated {
+		return 0, err
+	}
+	return whs.Id, nil
+}
+
+func (s *Store) DeleteWarehouse(ctx context.Context, itemId int64) error {
+	if itemId == 0 {
+		return errIdZero("warehouses")
+	}
+	return s.deleteEntity(ctx, model.EntityWarehouse, itemId)
+}
+
+func (s *Store) FindWarehousesByName(ctx context.Context, itemName string) ([]model.Warehouse, error) {
+	items := make([]model.Warehouse, 0)
+	err := s.read(ctx, func(st *state) error {
+		for _, whs := range sorted(st.warehouses, func(a, b model.Warehouse) bool { return a.Id < b.Id }) {
+			if whs.Name == itemName {
+				items = append(items, model.Warehouse{Id: whs.Id, Name: whs.Name})
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]model.User, error) {
+	var items []model.User
+	err := s.read(ctx, func(st *state) error {
+		items = active(sorted(st.users, func(a, b model.User) bool { return a.Name < b.Name || a.Name == b.Name && a.Id < b.Id }),
+			func(usr model.User) bool { return usr.ArchivedAt == nil })
+		return nil
+	})
+	return items, err
+}
+
+func (s *Store) GetUserById(ctx context.Context, itemId int64) (*model.User, error) {
+	var item model.User
+	err := s.read(ctx, func(st *state) error {
+		var ok bool
+		if item, ok = st.users[itemId]; !ok {
+			return core.NotFound("users", itemId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, user *model.User) (int64, error) {
+	var insertId int64
+	err := s.write(ctx, func(st *state) (err error) {
+		insertId, err = idempotent(ctx, st, s.KeyRetention, "create "+model.EntityUser, user, func() (int64, error) {
+			id := st.nextId("users")
+			st.users[id] = model.User{Id: id, Name: user.Name, Version: 1}
+			return id, nil
+		})
+		return err
+	})
+	return insertId, err
+}
+
+func (s *Store) UpdateUser(ctx context.Context, user *model.User) (int64, error) {
+	if err := checkVersionArg("users", user.Id, user.Version); err != nil {
+		return 0, err
+	}
+	var updated bool
+	err := s.write(ctx, func(st *state) error {
+		var item model.User
+		if item, updated = st.users[user.Id]; !updated {
+			return nil
+		}
+		if err := checkVersion("users", user.Id, user.Version, item.Version); err != nil {
+			return err
+		}
+		item.Name, item.Version = user.Name, item.Version+1
+		st.users[user.Id] = item
+		return nil
+	})
+	if err != nil || !updated {
+		return 0, err
+	}
+	return user.Id, nil
+}
+
+func (s *Store) DeleteUser(ctx context.Context, itemId int64) error {
+	if itemId == 0 {
+		return errIdZero("users")
+	}
+	return s.deleteEntity(ctx, model.EntityUser, itemId)
+}
+
+func (s *Store) FindUsersByName(ctx context.Context, itemName string) ([]model.User, error) {
+	items := make([]model.User, 0)
+	err := s.read(ctx, func(st *state) error {
+		for _, usr := range sorted(st.users, func(a, b model.User) bool { return a.Id < b.Id }) {
+			if usr.Name == itemName {
+				items = append(items, usr)
+			}
+		}
+		return nil
+	})
+	return items, err
+}
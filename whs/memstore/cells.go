@@ -0,0 +1,167 @@
+package memstore
+
+import (
+	"context"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+func (s *Store) GetCellById(ctx context.Context, cellId int64) (*model.Cell, error) {
+	var c model.Cell
+	err := s.read(ctx, func(st *state) error {
+		var ok bool
+		if c, ok = st.cells[cellId]; !ok {
+			return core.NotFound("cells", cellId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CreateCell создает ячейку. Если имя не задано, оно формируется по шаблону склада/зоны
+func (s *Store) CreateCell(ctx context.Context, cell *model.Cell) (int64, error) {
+	var insertId int64
+	err := s.write(ctx, func(st *state) (err error) {
+		insertId, err = idempotent(ctx, st, s.KeyRetention, "create "+model.EntityCell, cell, func() (int64, error) {
+			c := *cell
+			c.Number = st.nextCellNum(&c.CellAddr)
+			if c.Name == "" {
+				if err := c.SetName(st.cellNameFormat(c.WhsId, c.ZoneId)); err != nil {
+					return 0, err
+				}
+			}
+			c.Id, c.Version = st.nextId("cells"), 1
+			st.cells[c.Id] = c
+			return c.Id, nil
+		})
+		if err == nil {
+			*cell = st.cells[insertId]
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return insertId, nil
+}
+
+// UpdateCell изменяет имя ячейки. Пустое имя формируется заново по шаблону склада/зоны
+func (s *Store) UpdateCell(ctx context.Context, cell *model.Cell) (int64, error) {
+	if err := checkVersionArg("cells", cell.Id, cell.Version); err != nil {
+		return 0, err
+	}
+	var updated bool
+	err := s.write(ctx, func(st *state) error {
+		var stored model.Cell
+		if stored, updated = st.cells[cell.Id]; !updated {
+			if cell.Name == "" {
+				return core.NotFound("cells", cell.Id)
+			}
+			return nil
+		}
+		if err := checkVersion("cells", cell.Id, cell.Version, stored.Version); err != nil {
+			return err
+		}
+		if cell.Name == "" {
+			if err := stored.SetName(st.cellNameFormat(stored.WhsId, stored.ZoneId)); err != nil {
+				return err
+			}
+			cell.Name = stored.Name
+		}
+		stored.Name, stored.Version = cell.Name, stored.Version+1
+		st.cells[cell.Id] = stored
+		return nil
+	})
+	if err != nil || !updated {
+		return 0, err
+	}
+	return cell.Id, nil
+}
+
+// GenerateCells массово создает ячейки по диапазону адресов rng
+func (s *Store) GenerateCells(ctx context.Context, rng *model.CellsRange) ([]int64, error) {
+	if rng.CellsPerFloor <= 0 || rng.PassageFrom > rng.PassageTo || rng.RackFrom > rng.RackTo || rng.FloorFrom > rng.FloorTo {
+		return nil, core.Validation("cells", 0, "invalid cells range")
+	}
+	var ids []int64
+	err := s.write(ctx, func(st *state) (err error) {
+		ids, err = idempotent(ctx, st, s.KeyRetention, "generate cells", rng, func() ([]int64, error) {
+			ids := make([]int64, 0)
+			format := st.cellNameFormat(rng.WhsId, rng.ZoneId)
+			for p := rng.PassageFrom; p <= rng.PassageTo; p++ {
+				for r := rng.RackFrom; r <= rng.RackTo; r++ {
+					for f := rng.FloorFrom; f <= rng.FloorTo; f++ {
+						cell := rng.Props
+						cell.CellAddr = model.CellAddr{WhsId: rng.WhsId, ZoneId: rng.ZoneId, SectionId: rng.SectionId, PassageId: p, RackId: r, Floor: f}
+						firstNum := st.nextCellNum(&cell.CellAddr)
+						for n := firstNum; n < firstNum+rng.CellsPerFloor; n++ {
+							cell.Number = n
+							if err := cell.SetName(format); err != nil {
+								return nil, err
+							}
+							cell.Id, cell.Version = st.nextId("cells"), 1
+							st.cells[cell.Id] = cell
+							ids = append(ids, cell.Id)
+						}
+					}
+				}
+			}
+			return ids, nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetCellNameFormat возвращает шаблон имени ячеек зоны zoneId склада whsId (или склада, если для зоны не задан)
+func (s *Store) GetCellNameFormat(ctx context.Context, whsId int64, zoneId int64) (model.CellNameFormat, error) {
+	var format model.CellNameFormat
+	err := s.read(ctx, func(st *state) error {
+		format = st.cellNameFormat(whsId, zoneId)
+		return nil
+	})
+	return format, err
+}
+
+// SetCellNameFormat сохраняет шаблон имени ячеек склада (zoneId = 0) или зоны, пустой шаблон удаляет настройку
+func (s *Store) SetCellNameFormat(ctx context.Context, whsId int64, zoneId int64, format model.CellNameFormat) error {
+	if whsId == 0 {
+		return core.Validation("cell_name_formats", 0, "unacceptable action. whs id eq 0")
+	}
+	if err := format.Validate(); err != nil {
+		return err
+	}
+	return s.write(ctx, func(st *state) error {
+		if format == "" {
+			delete(st.formats, formatKey{whsId, zoneId})
+		} else {
+			st.formats[formatKey{whsId, zoneId}] = format
+		}
+		return nil
+	})
+}
+
+func (st *state) cellNameFormat(whsId, zoneId int64) model.CellNameFormat {
+	if f, ok := st.formats[formatKey{whsId, zoneId}]; ok {
+		return f
+	}
+	return st.formats[formatKey{whsId, 0}]
+}
+
+// nextCellNum следующий порядковый номер ячейки по адресу addr
+func (st *state) nextCellNum(addr *model.CellAddr) int {
+	n := 1
+	for _, c := range st.cells {
+		if c.WhsId == addr.WhsId && c.ZoneId == addr.ZoneId && c.SectionId == addr.SectionId &&
+			c.PassageId == addr.PassageId && c.RackId == addr.RackId && c.Floor == addr.Floor {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,257 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"sort"
+	"time"
+)
+
+// Направления движения продукта для cellInfo
+const (
+	cellIn  = iota // размещение в ячейку
+	cellOut        // отбор из ячейки
+)
+
+// cellInfo возвращает ячейку, в которую пишется ledger, открытую для движения dir
+func (st *state) cellInfo(cellId int64, dir int) (model.Cell, error) {
+	c, ok := st.cells[cellId]
+	switch {
+	case !ok:
+		return c, core.NotFound("cells", cellId)
+	case dir == cellIn && c.NotAllowedIn:
+		return c, core.CellBlocked(cellId, "placement into cell %s is not allowed", c.Name)
+	case dir == cellOut && c.NotAllowedOut:
+		return c, core.CellBlocked(cellId, "picking from cell %s is not allowed", c.Name)
+	}
+	if _, ok = st.ledger[c.WhsId]; !ok {
+		return c, core.NotFound("warehouses", c.WhsId)
+	}
+	return c, nil
+}
+
+func (st *state) insert(cell model.Cell, itemId int64, quantity int, docType int, rowId string, actor model.Actor) {
+	st.ledger[cell.WhsId] = append(st.ledger[cell.WhsId], ledgerRow{rowId: rowId, docType: docType, rowTime: time.Now(),
+		zoneId: cell.ZoneId, cellId: cell.Id, prodId: itemId, quantity: quantity, userId: actor.User.Id, terminal: actor.Terminal})
+}
+
+// actorOf возвращает пользователя и терминал операции, см. whs.WithActor
+func actorOf(ctx context.Context) (model.Actor, error) {
+	actor, _ := whs.ActorFrom(ctx)
+	return actor, whs.CheckActor(actor)
+}
+
+// replay ищет операцию с ключом идемпотентности key, см. whs.Storage
+// Возвращает количество найденной операции и true
+func (st *state) replay(whsId int64, key string, retention time.Duration, docType int, itemId int64, cellId int64, cellDstId int64, quantity int) (int, bool, error) {
+	if err := whs.CheckIdempotencyKey(key); err != nil {
+		return 0, false, err
+	}
+	if retention <= 0 {
+		retention = whs.DefaultKeyRetention
+	}
+	since := time.Now().Add(-retention)
+	// found - списание (источник), dst - поступление (получатель перемещения)
+	var found, dst *ledgerRow
+	for i, r := range st.ledger[whsId] {
+		if r.rowId != key || r.rowTime.Before(since) {
+			continue
+		}
+		if found == nil || r.quantity < found.quantity {
+			found = &st.ledger[whsId][i]
+		}
+		if dst == nil || r.quantity > dst.quantity {
+			dst = &st.ledger[whsId][i]
+		}
+	}
+	if found == nil {
+		return 0, false, nil
+	}
+	qty := found.quantity
+	if qty < 0 {
+		qty = -qty
+	}
+	storedDst := dst.cellId
+	if cellDstId == 0 {
+		storedDst = 0
+	}
+	if found.docType != docType || found.prodId != itemId || found.cellId != cellId || storedDst != cellDstId || qty != quantity {
+		return 0, false, &core.Error{Kind: core.ErrConflict, Entity: fmt.Sprintf("storage%d", whsId),
+			Msg: fmt.Sprintf("%s: %q", whs.ErrIdempotencyKeyReused, key), Err: whs.ErrIdempotencyKeyReused}
+	}
+	return qty, true, nil
+}
+
+// balanceControl проверяет, что остаток продукта itemId в ячейке cellId не отрицательный
+func (st *state) balanceControl(whsId int64, itemId int64, cellId int64) error {
+	balance := 0
+	for _, r := range st.ledger[whsId] {
+		if r.cellId == cellId && r.prodId == itemId {
+			balance += r.quantity
+		}
+	}
+	if balance < 0 {
+		return &core.StockError{WhsId: whsId, CellId: cellId, ProductId: itemId, Balance: balance}
+	}
+	return nil
+}
+
+// capacityControl проверяет, что вес и объем продуктов в ячейке cell не превышают ее ограничений, см. whs.Storage
+func (st *state) capacityControl(cell model.Cell) error {
+	checkWeight, checkVolume := cell.MaxWeight > 0 && !cell.IsWeightFree, cell.MaxVolume > 0 && !cell.IsSizeFree
+	if !checkWeight && !checkVolume {
+		return nil
+	}
+	var weight, volume float64
+	for _, r := range st.ledger[cell.WhsId] {
+		if r.cellId == cell.Id {
+			p := st.products[r.prodId]
+			weight += float64(r.quantity) * p.Weight
+			volume += float64(r.quantity) * p.Volume
+		}
+	}
+	if checkWeight && weight > cell.MaxWeight+capacityTolerance {
+		return core.CapacityExceeded(cell.Id, "weight %g kg exceeds cell %s limit %g kg", weight, cell.Name, cell.MaxWeight)
+	}
+	if checkVolume && volume > cell.MaxVolume+capacityTolerance {
+		return core.CapacityExceeded(cell.Id, "volume %g cm3 exceeds cell %s limit %g cm3", volume, cell.Name, cell.MaxVolume)
+	}
+	return nil
+}
+
+// capacityTolerance допустимая погрешность суммирования веса и объема продуктов ячейки
+const capacityTolerance = 1e-6
+
+// GetItemFromCell отбирает из ячейки (cellId) продукт (itemId) в количестве (quantity)
+func (s *Store) GetItemFromCell(ctx context.Context, itemId int64, cellId int64, quantity int) (int, error) {
+	key := whs.IdempotencyKey(ctx)
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+	err = s.write(ctx, func(st *state) error {
+		cell, err := st.cellInfo(cellId, cellOut)
+		if err != nil {
+			return err
+		}
+		if key != "" {
+			if q, ok, err := st.replay(cell.WhsId, key, s.KeyRetention, whs.DocTypeOutbound, itemId, cellId, 0, quantity); err != nil || ok {
+				quantity = q
+				return err
+			}
+		}
+		st.insert(cell, itemId, -1*quantity, whs.DocTypeOutbound, key, actor)
+		return st.balanceControl(cell.WhsId, itemId, cellId)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return quantity, nil
+}
+
+// PutItemToCell размещает в ячейку (cellId) продукт (itemId) в количестве (quantity)
+func (s *Store) PutItemToCell(ctx context.Context, itemId int64, cellId int64, quantity int) (int, error) {
+	key := whs.IdempotencyKey(ctx)
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+	err = s.write(ctx, func(st *state) error {
+		cell, err := st.cellInfo(cellId, cellIn)
+		if err != nil {
+			return err
+		}
+		if key != "" {
+			if q, ok, err := st.replay(cell.WhsId, key, s.KeyRetention, whs.DocTypeInbound, itemId, cellId, 0, quantity); err != nil || ok {
+				quantity = q
+				return err
+			}
+		}
+		st.insert(cell, itemId, quantity, whs.DocTypeInbound, key, actor)
+		return st.capacityControl(cell)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return quantity, nil
+}
+
+// MoveItemToCell перемещает продукт (itemId) из ячейки cellSrcId в ячейку cellDstId того же склада
+func (s *Store) MoveItemToCell(ctx context.Context, itemId int64, cellSrcId int64, cellDstId int64, quantity int) (int, error) {
+	key := whs.IdempotencyKey(ctx)
+	actor, err := actorOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+	err = s.write(ctx, func(st *state) error {
+		cellSrc, err := st.cellInfo(cellSrcId, cellOut)
+		if err != nil {
+			return err
+		}
+		cellDst, err := st.cellInfo(cellDstId, cellIn)
+		if err != nil {
+			return err
+		}
+		if cellDst.WhsId != cellSrc.WhsId {
+			return core.Validation("cells", cellDstId, "межскладское перемещение пока не реализовано(")
+		}
+		if key != "" {
+			if q, ok, err := st.replay(cellSrc.WhsId, key, s.KeyRetention, whs.DocTypeMove, itemId, cellSrcId, cellDstId, quantity); err != nil || ok {
+				quantity = q
+				return err
+			}
+		}
+		st.insert(cellSrc, itemId, -1*quantity, whs.DocTypeMove, key, actor)
+		st.insert(cellDst, itemId, quantity, whs.DocTypeMove, key, actor)
+		if err = st.balanceControl(cellSrc.WhsId, itemId, cellSrcId); err != nil {
+			return err
+		}
+		return st.capacityControl(cellDst)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return quantity, nil
+}
+
+// GetCellStocks возвращает положительные остатки продуктов productIds по ячейкам склада whsId
+// Пустой productIds - все продукты склада
+func (s *Store) GetCellStocks(ctx context.Context, whsId int64, productIds []int64) ([]model.CellStock, error) {
+	items := make([]model.CellStock, 0)
+	err := s.read(ctx, func(st *state) error {
+		rows, ok := st.ledger[whsId]
+		if !ok {
+			return core.NotFound("warehouses", whsId)
+		}
+		filter := make(map[int64]bool, len(productIds))
+		for _, id := range productIds {
+			filter[id] = true
+		}
+		type key struct{ cellId, prodId int64 }
+		balances := make(map[key]int)
+		for _, r := range rows {
+			if len(filter) == 0 || filter[r.prodId] {
+				balances[key{r.cellId, r.prodId}] += r.quantity
+			}
+		}
+		for k, qty := range balances {
+			if qty > 0 {
+				items = append(items, model.CellStock{Cell: st.cells[k.cellId], ProductId: k.prodId, Quantity: qty})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ProductId != items[j].ProductId {
+			return items[i].ProductId < items[j].ProductId
+		}
+		return items[i].Cell.Id < items[j].Cell.Id
+	})
+	return items, nil
+}
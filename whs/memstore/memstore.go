@@ -0,0 +1,249 @@
+// Package memstore реализация whs.Repository в памяти процесса
+// Предназначена для unit-тестов сервисов, использующих модуль, без запущенного PostgreSQL.
+// Семантика операций и ошибки совпадают с whs.Storage: отсутствующие записи - core.ErrNotFound (sql.ErrNoRows),
+// обновление отсутствующей записи - (0, nil), устаревшей версии записи - core.ErrConflict, отбор и перемещение - с контролем остатка
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"sort"
+	"sync"
+	"time"
+)
+
+type product struct {
+	model.Product
+	manufacturerId int64
+}
+
+// ledgerRow строка ledger склада
+type ledgerRow struct {
+	rowId    string
+	docType  int
+	rowTime  time.Time
+	zoneId   int64
+	cellId   int64
+	prodId   int64
+	quantity int
+	userId   int64
+	terminal string
+}
+
+// opKey операция, выполненная с ключом идемпотентности, см. whs.WithIdempotencyKey
+type opKey struct {
+	operation string
+	request   string
+	result    any
+	created   time.Time
+}
+
+type formatKey struct {
+	whsId  int64
+	zoneId int64
+}
+
+// state данные хранилища, копируются при открытии транзакции
+type state struct {
+	seq           map[string]int64
+	products      map[int64]product
+	manufacturers map[int64]model.Manufacturer
+	barcodes      map[int64]model.Barcode
+	warehouses    map[int64]model.Warehouse
+	users         map[int64]model.User
+	cells         map[int64]model.Cell
+	formats       map[formatKey]model.CellNameFormat
+	ledger        map[int64][]ledgerRow
+	opKeys        map[string]opKey
+}
+
+func newState() *state {
+	return &state{
+		seq:           make(map[string]int64),
+		products:      make(map[int64]product),
+		manufacturers: make(map[int64]model.Manufacturer),
+		barcodes:      make(map[int64]model.Barcode),
+		warehouses:    make(map[int64]model.Warehouse),
+		users:         make(map[int64]model.User),
+		cells:         make(map[int64]model.Cell),
+		formats:       make(map[formatKey]model.CellNameFormat),
+		ledger:        make(map[int64][]ledgerRow),
+		opKeys:        make(map[string]opKey),
+	}
+}
+
+func (st *state) clone() *state {
+	c := newState()
+	copyMap(c.seq, st.seq)
+	copyMap(c.products, st.products)
+	copyMap(c.manufacturers, st.manufacturers)
+	copyMap(c.barcodes, st.barcodes)
+	copyMap(c.warehouses, st.warehouses)
+	copyMap(c.users, st.users)
+	copyMap(c.cells, st.cells)
+	copyMap(c.formats, st.formats)
+	copyMap(c.opKeys, st.opKeys)
+	for whsId, rows := range st.ledger {
+		c.ledger[whsId] = append(make([]ledgerRow, 0, len(rows)), rows...)
+	}
+	return c
+}
+
+func copyMap[K comparable, V any](dst, src map[K]V) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// nextId возвращает следующее значение последовательности таблицы table
+func (st *state) nextId(table string) int64 {
+	st.seq[table]++
+	return st.seq[table]
+}
+
+// Store хранилище в памяти, безопасно для конкурентного использования
+type Store struct {
+	KeyRetention time.Duration // срок хранения ключей идемпотентности, 0 - whs.DefaultKeyRetention
+	mu           *sync.Mutex
+	data         *state
+	done         bool // транзакция завершена
+}
+
+var _ whs.Repository = (*Store)(nil)
+
+// New создает пустое хранилище
+func New() *Store {
+	return &Store{mu: &sync.Mutex{}, data: newState()}
+}
+
+// WithTx выполняет fn в транзакции: fn получает хранилище, изменения которого применяются
+// только при успешном завершении fn. При ошибке, панике (повторно возбуждается после отката)
+// или отмене ctx изменения отбрасываются. Транзакции выполняются последовательно
+func (s *Store) WithTx(ctx context.Context, fn func(tx *Store) error) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = s.check(ctx); err != nil {
+		return err
+	}
+	tx := &Store{KeyRetention: s.KeyRetention, mu: &sync.Mutex{}, data: s.data.clone()}
+	defer func() {
+		tx.mu.Lock()
+		tx.done = true
+		tx.mu.Unlock()
+	}()
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	s.data = tx.data
+	return nil
+}
+
+// read выполняет fn над данными хранилища
+func (s *Store) read(ctx context.Context, fn func(st *state) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	return fn(s.data)
+}
+
+// write выполняет fn над копией данных и применяет ее только при успешном завершении fn
+func (s *Store) write(ctx context.Context, fn func(st *state) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	data := s.data.clone()
+	if err := fn(data); err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+func (s *Store) check(ctx context.Context) error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	return ctx.Err()
+}
+
+// checkVersionArg проверяет версию version, переданную в Update*, см. whs.CheckVersion
+func checkVersionArg(entity string, id int64, version int64) error {
+	return whs.CheckVersion(entity, id, version)
+}
+
+// checkVersion проверяет версию version изменяемой записи по ее текущей версии stored, см. whs.Storage
+func checkVersion(entity string, id int64, version int64, stored int64) error {
+	if version != whs.VersionAny && version != stored {
+		return core.Conflict(entity, id, "version %d is stale, current version is %d", version, stored)
+	}
+	return nil
+}
+
+// idempotent выполняет op операции operation с параметрами request однократно для ключа идемпотентности ctx, см. whs.Storage
+// Повтор с тем же ключом в течение срока хранения retention возвращает результат первого вызова
+func idempotent[T any](ctx context.Context, st *state, retention time.Duration, operation string, request any, op func() (T, error)) (T, error) {
+	var res T
+	key := whs.IdempotencyKey(ctx)
+	if key == "" {
+		return op()
+	}
+	if err := whs.CheckIdempotencyKey(key); err != nil {
+		return res, err
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return res, err
+	}
+	if retention <= 0 {
+		retention = whs.DefaultKeyRetention
+	}
+	if stored, ok := st.opKeys[key]; ok && !stored.created.Before(time.Now().Add(-retention)) {
+		if stored.operation != operation || stored.request != string(data) {
+			return res, &core.Error{Kind: core.ErrConflict, Entity: "operation_keys",
+				Msg: fmt.Sprintf("%s: %q", whs.ErrIdempotencyKeyReused, key), Err: whs.ErrIdempotencyKeyReused}
+		}
+		return stored.result.(T), nil
+	}
+	if res, err = op(); err != nil {
+		return res, err
+	}
+	st.opKeys[key] = opKey{operation: operation, request: string(data), result: res, created: time.Now()}
+	return res, nil
+}
+
+func errIdZero(entity string) error {
+	return core.Validation(entity, 0, "unacceptable action. item id eq 0")
+}
+
+// active возвращает элементы items, не находящиеся в архиве
+func active[V any](items []V, notArchived func(v V) bool) []V {
+	res := make([]V, 0, len(items))
+	for _, v := range items {
+		if notArchived(v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// sorted возвращает значения map, упорядоченные less
+func sorted[V any](m map[int64]V, less func(a, b V) bool) []V {
+	items := make([]V, 0, len(m))
+	for _, v := range m {
+		items = append(items, v)
+	}
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+	return items
+}
@@ -0,0 +1,106 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"github.com/mlplabs/mwms-core/whs/repotest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) whs.Repository { return New() })
+}
+
+func TestStore_WithTx(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	whsId, _ := s.CreateWarehouse(ctx, &model.Warehouse{Name: "main"})
+	cellId, _ := s.CreateCell(ctx, &model.Cell{CellAddr: model.CellAddr{WhsId: whsId}})
+
+	errAbort := errors.New("abort")
+	err := s.WithTx(ctx, func(tx *Store) error {
+		prodId, err := tx.CreateProduct(ctx, &model.Product{Name: "milk"})
+		if err != nil {
+			return err
+		}
+		if _, err = tx.PutItemToCell(ctx, prodId, cellId, 5); err != nil {
+			return err
+		}
+		if p, err := tx.GetProductById(ctx, prodId); err != nil || p.Name != "milk" {
+			t.Errorf("product inside tx = %+v, %v", p, err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx err = %v", err)
+	}
+	if items, _ := s.GetProducts(ctx); len(items) != 0 {
+		t.Errorf("products after rollback = %+v", items)
+	}
+	if stocks, _ := s.GetCellStocks(ctx, whsId, nil); len(stocks) != 0 {
+		t.Errorf("stocks after rollback = %+v", stocks)
+	}
+
+	var leaked *Store
+	err = s.WithTx(ctx, func(tx *Store) error {
+		leaked = tx
+		prodId, err := tx.CreateProduct(ctx, &model.Product{Name: "kefir"})
+		if err != nil {
+			return err
+		}
+		_, err = tx.PutItemToCell(ctx, prodId, cellId, 2)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stocks, _ := s.GetCellStocks(ctx, whsId, nil); len(stocks) != 1 || stocks[0].Quantity != 2 {
+		t.Errorf("stocks after commit = %+v", stocks)
+	}
+	if _, err = leaked.GetProducts(ctx); err == nil {
+		t.Error("use of finished tx: expected error")
+	}
+}
+
+func TestStore_WithTxPanic(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic to be propagated")
+			}
+		}()
+		_ = s.WithTx(ctx, func(tx *Store) error {
+			_, _ = tx.CreateUser(ctx, &model.User{Name: "operator"})
+			panic("boom")
+		})
+	}()
+	if users, err := s.GetUsers(ctx); err != nil || len(users) != 0 {
+		t.Errorf("users after panic = %+v, %v", users, err)
+	}
+}
+
+func TestStore_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New().CreateUser(ctx, &model.User{Name: "operator"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestStore_UnknownWarehouse(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	if _, err := s.GetCellStocks(ctx, 42, nil); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("GetCellStocks of unknown warehouse: err = %v, want ErrNotFound", err)
+	}
+	// ячейка склада, для которого нет ledger
+	cellId, _ := s.CreateCell(ctx, &model.Cell{CellAddr: model.CellAddr{WhsId: 42}})
+	if _, err := s.PutItemToCell(ctx, 1, cellId, 1); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("PutItemToCell into cell of unknown warehouse: err = %v, want ErrNotFound", err)
+	}
+}
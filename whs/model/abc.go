@@ -0,0 +1,45 @@
+package model
+
+import "sort"
+
+// Классы ABC
+const (
+	ClassA = "A"
+	ClassB = "B"
+	ClassC = "C"
+)
+
+// ClassifyABC относит ключи к классам по накопленной доле значения:
+// класс A - первые shareA суммы (по убыванию значений), B - до shareA+shareB, остальные - C.
+// Ключи с нулевым значением всегда относятся к классу C
+func ClassifyABC(values map[int64]float64, shareA, shareB float64) map[int64]string {
+	keys := make([]int64, 0, len(values))
+	total := 0.0
+	for k, v := range values {
+		keys = append(keys, k)
+		total += v
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if values[keys[i]] != values[keys[j]] {
+			return values[keys[i]] > values[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	classes := make(map[int64]string, len(keys))
+	acc := 0.0
+	for _, k := range keys {
+		v := values[k]
+		switch {
+		case v <= 0 || total <= 0:
+			classes[k] = ClassC
+		case acc < shareA*total:
+			classes[k] = ClassA
+		case acc < (shareA+shareB)*total:
+			classes[k] = ClassB
+		default:
+			classes[k] = ClassC
+		}
+		acc += v
+	}
+	return classes
+}
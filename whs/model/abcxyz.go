@@ -0,0 +1,122 @@
+package model
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// База расчета ABC
+const (
+	AbcByQuantity = iota // количество отгруженного
+	AbcByValue           // стоимость отгруженного (количество * цена)
+)
+
+// Классы XYZ
+const (
+	ClassX = "X"
+	ClassY = "Y"
+	ClassZ = "Z"
+)
+
+// AbcXyzOptions параметры ABC/XYZ анализа
+type AbcXyzOptions struct {
+	Basis  int               `json:"basis"`   // AbcByQuantity, AbcByValue
+	Prices map[int64]float64 `json:"prices"`  // цены продуктов для AbcByValue
+	ShareA float64           `json:"share_a"` // доля класса A
+	ShareB float64           `json:"share_b"` // доля класса B
+	Bucket time.Duration     `json:"bucket"`  // интервал ряда спроса для XYZ
+	LimitX float64           `json:"limit_x"` // предельный коэффициент вариации класса X
+	LimitY float64           `json:"limit_y"` // предельный коэффициент вариации класса Y
+}
+
+// DefaultAbcXyzOptions параметры ABC/XYZ анализа по умолчанию: 80/15/5, недельный спрос, X до 10%, Y до 25%
+var DefaultAbcXyzOptions = AbcXyzOptions{Basis: AbcByQuantity, ShareA: 0.8, ShareB: 0.15, Bucket: 7 * 24 * time.Hour, LimitX: 0.1, LimitY: 0.25}
+
+// AbcXyzRow классы продукта
+type AbcXyzRow struct {
+	Product   Product `json:"product"`
+	Quantity  int     `json:"quantity"`  // отгружено за период
+	Value     float64 `json:"value"`     // значение базы ABC
+	Variation float64 `json:"variation"` // коэффициент вариации спроса
+	Abc       string  `json:"abc"`
+	Xyz       string  `json:"xyz"`
+}
+
+// ProductClass классы продукта по последнему ABC/XYZ анализу склада
+type ProductClass struct {
+	WhsId     int64  `json:"whs_id"`
+	ProductId int64  `json:"product_id"`
+	Abc       string `json:"abc"`
+	Xyz       string `json:"xyz"`
+}
+
+// AbcXyzReport отчет ABC/XYZ анализа
+type AbcXyzReport struct {
+	WhsId int64       `json:"whs_id"`
+	From  time.Time   `json:"from"`
+	To    time.Time   `json:"to"`
+	Rows  []AbcXyzRow `json:"rows"`
+}
+
+// AnalyzeAbcXyz классифицирует продукты по рядам отгрузок demand (одинаковой длины, по интервалам периода)
+// Строки упорядочены по убыванию значения базы ABC
+func AnalyzeAbcXyz(demand map[int64][]float64, opts AbcXyzOptions) []AbcXyzRow {
+	values := make(map[int64]float64, len(demand))
+	rows := make([]AbcXyzRow, 0, len(demand))
+	for productId, series := range demand {
+		row := AbcXyzRow{Product: Product{Id: productId}}
+		sum := 0.0
+		for _, q := range series {
+			sum += q
+		}
+		row.Quantity = int(sum)
+		row.Value = sum
+		if opts.Basis == AbcByValue {
+			row.Value = sum * opts.Prices[productId]
+		}
+		row.Variation = variation(series)
+		switch {
+		case row.Variation <= opts.LimitX:
+			row.Xyz = ClassX
+		case row.Variation <= opts.LimitY:
+			row.Xyz = ClassY
+		default:
+			row.Xyz = ClassZ
+		}
+		values[productId] = row.Value
+		rows = append(rows, row)
+	}
+	classes := ClassifyABC(values, opts.ShareA, opts.ShareB)
+	for i := range rows {
+		rows[i].Abc = classes[rows[i].Product.Id]
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Value != rows[j].Value {
+			return rows[i].Value > rows[j].Value
+		}
+		return rows[i].Product.Id < rows[j].Product.Id
+	})
+	return rows
+}
+
+// variation коэффициент вариации ряда (отношение стандартного отклонения к среднему)
+// Для ряда без спроса возвращается +Inf
+func variation(series []float64) float64 {
+	if len(series) == 0 {
+		return math.Inf(1)
+	}
+	mean := 0.0
+	for _, q := range series {
+		mean += q
+	}
+	mean /= float64(len(series))
+	if mean == 0 {
+		return math.Inf(1)
+	}
+	dev := 0.0
+	for _, q := range series {
+		dev += (q - mean) * (q - mean)
+	}
+	return math.Sqrt(dev/float64(len(series))) / mean
+}
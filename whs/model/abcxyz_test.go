@@ -0,0 +1,35 @@
+package model
+
+import "testing"
+
+func TestAnalyzeAbcXyz(t *testing.T) {
+	demand := map[int64][]float64{
+		1: {100, 100, 100, 100}, // стабильный, основной объем
+		2: {10, 12, 8, 10},      // умеренные колебания
+		3: {0, 0, 20, 0},        // эпизодический
+		4: {0, 0, 0, 0},
+	}
+	rows := AnalyzeAbcXyz(demand, DefaultAbcXyzOptions)
+	want := map[int64][2]string{
+		1: {ClassA, ClassX},
+		2: {ClassB, ClassY},
+		3: {ClassC, ClassZ},
+		4: {ClassC, ClassZ},
+	}
+	if len(rows) != len(want) || rows[0].Product.Id != 1 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	for _, r := range rows {
+		if w := want[r.Product.Id]; r.Abc != w[0] || r.Xyz != w[1] {
+			t.Errorf("product %d = %s%s, want %s%s", r.Product.Id, r.Abc, r.Xyz, w[0], w[1])
+		}
+	}
+
+	opts := DefaultAbcXyzOptions
+	opts.Basis = AbcByValue
+	opts.Prices = map[int64]float64{1: 1, 2: 100, 3: 1}
+	rows = AnalyzeAbcXyz(demand, opts)
+	if rows[0].Product.Id != 2 || rows[0].Abc != ClassA {
+		t.Errorf("by value first row = %+v", rows[0])
+	}
+}
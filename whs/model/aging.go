@@ -0,0 +1,188 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// Movement движение продукта по ячейке (строка ledger)
+type Movement struct {
+	CellId    int64     `json:"cell_id"`
+	ProductId int64     `json:"product_id"`
+	Time      time.Time `json:"time"`
+	Quantity  int       `json:"quantity"` // приход > 0, расход < 0
+	Move      bool      `json:"move"`     // строка перемещения между ячейками
+}
+
+// AgingBuckets остаток по возрасту (дней с момента поступления)
+type AgingBuckets struct {
+	Days0To30   int `json:"days_0_30"`
+	Days31To90  int `json:"days_31_90"`
+	Days91To180 int `json:"days_91_180"`
+	Days180Plus int `json:"days_180_plus"`
+}
+
+// Add добавляет количество quantity возрастом days дней
+func (b *AgingBuckets) Add(days int, quantity int) {
+	switch {
+	case days <= 30:
+		b.Days0To30 += quantity
+	case days <= 90:
+		b.Days31To90 += quantity
+	case days <= 180:
+		b.Days91To180 += quantity
+	default:
+		b.Days180Plus += quantity
+	}
+}
+
+// Merge суммирует остатки по возрасту
+func (b *AgingBuckets) Merge(o AgingBuckets) {
+	b.Days0To30 += o.Days0To30
+	b.Days31To90 += o.Days31To90
+	b.Days91To180 += o.Days91To180
+	b.Days180Plus += o.Days180Plus
+}
+
+// AgingRow возраст остатка продукта в ячейке (для сводных строк ячейка или продукт не заполнены)
+type AgingRow struct {
+	Product    Product      `json:"product"`
+	Cell       Cell         `json:"cell"`
+	Quantity   int          `json:"quantity"`
+	OldestDays int          `json:"oldest_days"`
+	Buckets    AgingBuckets `json:"buckets"`
+}
+
+// AgingReport отчет о возрасте остатков склада по ячейкам, продуктам и складу в целом
+type AgingReport struct {
+	WhsId    int64      `json:"whs_id"`
+	At       time.Time  `json:"at"`
+	Rows     []AgingRow `json:"rows"`     // продукт + ячейка
+	Products []AgingRow `json:"products"` // продукт
+	Total    AgingRow   `json:"total"`    // склад
+}
+
+// AgeFIFO рассчитывает возраст остатка по движениям одного продукта в одной ячейке, упорядоченным по времени.
+// Расход списывает самые ранние приходы (FIFO), оставшиеся приходы распределяются по возрасту на момент at
+func AgeFIFO(movements []Movement, at time.Time) AgingRow {
+	c := ageCell{}
+	for _, m := range movements {
+		if m.Quantity > 0 {
+			c.put(ageLayer{m.Time, m.Quantity})
+		} else {
+			c.consume(-m.Quantity)
+		}
+	}
+	return c.row(at)
+}
+
+// AgeProductFIFO рассчитывает возраст остатков одного продукта по ячейкам (как AgeFIFO) по его движениям
+// на складе, упорядоченным по времени (при равном времени расход раньше прихода). Расход перемещения
+// передает списанные приходы приходу перемещения со временем их поступления на склад, поэтому
+// перемещение не омолаживает остаток. Строки с положительным остатком упорядочены по ячейке
+func AgeProductFIFO(movements []Movement, at time.Time) []AgingRow {
+	cells := make(map[int64]*ageCell)
+	transit := make([]ageLayer, 0) // списано расходом перемещения, еще не поступило в ячейку
+	for _, m := range movements {
+		c := cells[m.CellId]
+		if c == nil {
+			c = &ageCell{}
+			cells[m.CellId] = c
+		}
+		switch {
+		case m.Quantity < 0:
+			taken := c.consume(-m.Quantity)
+			if m.Move {
+				transit = append(transit, taken...)
+			}
+		case m.Move:
+			q := m.Quantity
+			for q > 0 && len(transit) > 0 {
+				n := min(q, transit[0].quantity)
+				c.put(ageLayer{transit[0].time, n})
+				transit[0].quantity -= n
+				q -= n
+				if transit[0].quantity == 0 {
+					transit = transit[1:]
+				}
+			}
+			if q > 0 {
+				c.put(ageLayer{m.Time, q})
+			}
+		default:
+			c.put(ageLayer{m.Time, m.Quantity})
+		}
+	}
+	rows := make([]AgingRow, 0, len(cells))
+	for cellId, c := range cells {
+		if row := c.row(at); row.Quantity > 0 {
+			row.Cell.Id = cellId
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Cell.Id < rows[j].Cell.Id })
+	return rows
+}
+
+// ageLayer приход, еще не списанный расходом
+type ageLayer struct {
+	time     time.Time // время поступления на склад
+	quantity int
+}
+
+// ageCell остаток продукта в ячейке: приходы по времени поступления и не покрытый ими расход
+type ageCell struct {
+	layers []ageLayer
+	debt   int
+}
+
+// put добавляет приход l (по времени поступления) и погашает им долг расхода
+func (c *ageCell) put(l ageLayer) {
+	i := sort.Search(len(c.layers), func(i int) bool { return c.layers[i].time.After(l.time) })
+	c.layers = append(c.layers, ageLayer{})
+	copy(c.layers[i+1:], c.layers[i:])
+	c.layers[i] = l
+	c.settle()
+}
+
+// consume списывает quantity с самых ранних приходов и возвращает списанное
+func (c *ageCell) consume(quantity int) []ageLayer {
+	c.debt += quantity
+	return c.settle()
+}
+
+func (c *ageCell) settle() []ageLayer {
+	taken := make([]ageLayer, 0)
+	for c.debt > 0 && len(c.layers) > 0 {
+		q := min(c.debt, c.layers[0].quantity)
+		taken = append(taken, ageLayer{c.layers[0].time, q})
+		c.layers[0].quantity -= q
+		c.debt -= q
+		if c.layers[0].quantity == 0 {
+			c.layers = c.layers[1:]
+		}
+	}
+	return taken
+}
+
+// row распределяет остаток по возрасту на момент at
+func (c *ageCell) row(at time.Time) AgingRow {
+	row := AgingRow{}
+	for _, l := range c.layers {
+		days := int(at.Sub(l.time).Hours() / 24)
+		if row.Quantity == 0 {
+			row.OldestDays = days
+		}
+		row.Quantity += l.quantity
+		row.Buckets.Add(days, l.quantity)
+	}
+	return row
+}
+
+// SlowMover продукт, не отгружавшийся заданное количество дней
+type SlowMover struct {
+	Product      Product   `json:"product"`
+	Quantity     int       `json:"quantity"`
+	LastOutbound time.Time `json:"last_outbound"` // нулевое, если отгрузок не было
+	IdleDays     int       `json:"idle_days"`     // дней без отгрузки (с первого поступления, если отгрузок не было)
+}
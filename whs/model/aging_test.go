@@ -0,0 +1,57 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgeFIFO(t *testing.T) {
+	at := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	days := func(d int) time.Time { return at.AddDate(0, 0, -d) }
+	row := AgeFIFO([]Movement{
+		{Time: days(200), Quantity: 10},
+		{Time: days(100), Quantity: 5},
+		{Time: days(60), Quantity: -12}, // списывает 10 самых старых и 2 следующих
+		{Time: days(40), Quantity: 4},
+		{Time: days(10), Quantity: 6},
+	}, at)
+
+	if row.Quantity != 13 {
+		t.Errorf("quantity = %d, want 13", row.Quantity)
+	}
+	if row.OldestDays != 100 {
+		t.Errorf("oldest = %d, want 100", row.OldestDays)
+	}
+	want := AgingBuckets{Days0To30: 6, Days31To90: 4, Days91To180: 3}
+	if row.Buckets != want {
+		t.Errorf("buckets = %+v, want %+v", row.Buckets, want)
+	}
+
+	if empty := AgeFIFO([]Movement{{Time: days(5), Quantity: 3}, {Time: days(1), Quantity: -3}}, at); empty.Quantity != 0 {
+		t.Errorf("fully consumed stock quantity = %d", empty.Quantity)
+	}
+}
+
+func TestAgeProductFIFO(t *testing.T) {
+	at := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	days := func(d int) time.Time { return at.AddDate(0, 0, -d) }
+	rows := AgeProductFIFO([]Movement{
+		{CellId: 1, Time: days(100), Quantity: 10},
+		{CellId: 1, Time: days(50), Quantity: 5},
+		{CellId: 1, Time: days(5), Quantity: -12, Move: true}, // 10 возрастом 100 дней и 2 возрастом 50
+		{CellId: 2, Time: days(5), Quantity: 12, Move: true},
+		{CellId: 2, Time: days(2), Quantity: -4},
+	}, at)
+
+	if len(rows) != 2 || rows[0].Cell.Id != 1 || rows[1].Cell.Id != 2 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if rows[0].Quantity != 3 || rows[0].OldestDays != 50 {
+		t.Errorf("source cell = %+v, want 3 aged 50 days", rows[0])
+	}
+	// перемещенный остаток сохраняет возраст поступления на склад
+	want := AgingBuckets{Days31To90: 2, Days91To180: 6}
+	if rows[1].Quantity != 8 || rows[1].OldestDays != 100 || rows[1].Buckets != want {
+		t.Errorf("destination cell = %+v, want 8 aged 100 days, %+v", rows[1], want)
+	}
+}
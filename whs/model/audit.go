@@ -0,0 +1,94 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Типы сущностей журнала аудита, дополнительно к EntityProduct, EntityManufacturer, EntityWarehouse и EntityUser
+const (
+	EntityBarcode        = "barcode"
+	EntityCell           = "cell"
+	EntityCellNameFormat = "cell_name_format" // шаблон имени ячеек, id записи журнала - id склада
+	EntityLayout         = "layout"           // планировка склада, id записи журнала - id склада
+	EntityPickFace       = "pick_face"        // ячейка отбора продукта, id записи журнала - id ячейки
+	EntityExternalId     = "external_id"      // внешний идентификатор, id записи журнала - id сопоставленной сущности
+	EntityProductClass   = "product_class"    // классы ABC/XYZ продукта на складе, id записи журнала - id продукта
+)
+
+// Действия журнала аудита (AuditEntry.Action)
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditArchive = "archive"
+	AuditRestore = "restore"
+)
+
+// AuditChange значения поля до и после изменения в JSON, nil - поле отсутствует
+type AuditChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditEntry запись журнала аудита: действие Action над сущностью Entity с идентификатором EntityId
+type AuditEntry struct {
+	Id        int64                  `json:"id"`
+	Entity    string                 `json:"entity"`
+	EntityId  int64                  `json:"entity_id"`
+	Action    string                 `json:"action"`
+	Changes   map[string]AuditChange `json:"changes"`  // измененные поля по именам JSON
+	UserId    int64                  `json:"user_id"`  // пользователь, выполнивший изменение (0 - не известен), см. whs.WithActor
+	Terminal  string                 `json:"terminal"` // терминал пользователя
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditFilter отбор записей журнала аудита, незаполненные поля не ограничивают отбор
+type AuditFilter struct {
+	Entity   string    `json:"entity"`
+	EntityId int64     `json:"entity_id"`
+	UserId   int64     `json:"user_id"`
+	From     time.Time `json:"from"` // начало периода (включительно)
+	To       time.Time `json:"to"`   // конец периода (не включительно)
+	Limit    int       `json:"limit"`
+	BeforeId int64     `json:"before_id"` // записи с id меньше BeforeId: для следующей страницы - id последней записи предыдущей
+}
+
+// AuditDiff возвращает поля JSON-представлений записи до (before) и после (after) изменения,
+// значения которых различаются. nil - запись отсутствует (создание или удаление)
+func AuditDiff(before, after any) (map[string]AuditChange, error) {
+	b, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(map[string]AuditChange)
+	for name, val := range b {
+		if !bytes.Equal(val, a[name]) {
+			changes[name] = AuditChange{Before: val, After: a[name]}
+		}
+	}
+	for name, val := range a {
+		if _, ok := b[name]; !ok {
+			changes[name] = AuditChange{After: val}
+		}
+	}
+	return changes, nil
+}
+
+// jsonFields возвращает поля JSON-объекта v
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if v == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return fields, err
+	}
+	return fields, json.Unmarshal(data, &fields)
+}
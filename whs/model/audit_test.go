@@ -0,0 +1,30 @@
+package model
+
+import "testing"
+
+func TestAuditDiff(t *testing.T) {
+	before := &User{Id: 1, Name: "ivan", Version: 1}
+	after := &User{Id: 1, Name: "petr", Version: 2}
+	changes, err := AuditDiff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || string(changes["name"].Before) != `"ivan"` || string(changes["name"].After) != `"petr"` {
+		t.Errorf("update changes = %+v", changes)
+	}
+
+	var missing *User
+	changes, err = AuditDiff(missing, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := changes["id"]; len(changes) != 3 || c.Before != nil || string(c.After) != "1" {
+		t.Errorf("create changes = %+v", changes)
+	}
+	if changes, _ = AuditDiff(before, nil); len(changes) != 3 || changes["name"].After != nil {
+		t.Errorf("delete changes = %+v", changes)
+	}
+	if changes, _ = AuditDiff(before, before); len(changes) != 0 {
+		t.Errorf("changes of equal records = %+v", changes)
+	}
+}
@@ -1,5 +1,10 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+)
+
 const (
 	BarcodeTypeUnknown = iota
 	BarcodeTypeEAN13
@@ -19,4 +24,69 @@ type Barcode struct {
 	Type     int    `json:"type"`      // Тип ШК
 	OwnerId  int64  `json:"owner_id"`  // ID владельца ШК
 	OwnerRef string `json:"owner_ref"` // Таблица владельца
+	Version  int64  `json:"version"`   // версия записи, см. UpdateBarcode
+}
+
+var ErrBarcodeInvalid = errors.New("invalid barcode")
+
+// DetectBarcodeType определяет тип штрих-кода по его значению
+// Цифровые коды длиной 8, 13 и 14 с верной контрольной цифрой - EAN8, EAN13, EAN14, прочие - CODE128
+func DetectBarcodeType(code string) int {
+	if isDigits(code) && eanCheck(code) {
+		switch len(code) {
+		case 8:
+			return BarcodeTypeEAN8
+		case 13:
+			return BarcodeTypeEAN13
+		case 14:
+			return BarcodeTypeEAN14
+		}
+	}
+	return BarcodeTypeCode128
+}
+
+// ValidateBarcode проверяет значение штрих-кода типа barcodeType
+func ValidateBarcode(code string, barcodeType int) error {
+	if code == "" {
+		return fmt.Errorf("%w: empty value", ErrBarcodeInvalid)
+	}
+	length := map[int]int{BarcodeTypeEAN8: 8, BarcodeTypeEAN13: 13, BarcodeTypeEAN14: 14}
+	switch barcodeType {
+	case BarcodeTypeEAN8, BarcodeTypeEAN13, BarcodeTypeEAN14:
+		if len(code) != length[barcodeType] || !isDigits(code) {
+			return fmt.Errorf("%w: %q must contain %d digits", ErrBarcodeInvalid, code, length[barcodeType])
+		}
+		if !eanCheck(code) {
+			return fmt.Errorf("%w: %q has wrong check digit", ErrBarcodeInvalid, code)
+		}
+	case BarcodeTypeCode128:
+		for _, ch := range code {
+			if ch < 32 || ch > 126 {
+				return fmt.Errorf("%w: %q contains non-ASCII characters", ErrBarcodeInvalid, code)
+			}
+		}
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// eanCheck проверяет контрольную цифру кода семейства EAN/GTIN
+func eanCheck(code string) bool {
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		d := int(code[i] - '0')
+		if (len(code)-2-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10-sum%10)%10 == int(code[len(code)-1]-'0')
 }
@@ -0,0 +1,37 @@
+package model
+
+import "testing"
+
+func TestDetectBarcodeType(t *testing.T) {
+	tests := map[string]int{
+		"4006381333931":  BarcodeTypeEAN13,
+		"4006381333932":  BarcodeTypeCode128, // неверная контрольная цифра
+		"96385074":       BarcodeTypeEAN8,
+		"14006381333938": BarcodeTypeEAN14,
+		"ABC-123":        BarcodeTypeCode128,
+	}
+	for code, want := range tests {
+		if got := DetectBarcodeType(code); got != want {
+			t.Errorf("DetectBarcodeType(%q) = %d, want %d", code, got, want)
+		}
+	}
+}
+
+func TestValidateBarcode(t *testing.T) {
+	if err := ValidateBarcode("4006381333931", BarcodeTypeEAN13); err != nil {
+		t.Errorf("valid EAN13: %v", err)
+	}
+	for _, tt := range []struct {
+		code string
+		typ  int
+	}{
+		{"4006381333932", BarcodeTypeEAN13},
+		{"400638133393", BarcodeTypeEAN13},
+		{"", BarcodeTypeCode128},
+		{"код", BarcodeTypeCode128},
+	} {
+		if err := ValidateBarcode(tt.code, tt.typ); err == nil {
+			t.Errorf("ValidateBarcode(%q, %d) must fail", tt.code, tt.typ)
+		}
+	}
+}
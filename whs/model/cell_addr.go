@@ -0,0 +1,166 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCellAddrInvalid     = errors.New("invalid cell address")
+	ErrCellFormatNotParsed = errors.New("cell name format can not be parsed")
+)
+
+// cellFormatVars переменные шаблона имени, которые могут быть разобраны обратно в адрес
+var cellFormatVars = map[string]func(a *CellAddr, v int){
+	"w": func(a *CellAddr, v int) { a.WhsId = int64(v) },
+	"z": func(a *CellAddr, v int) { a.ZoneId = int64(v) },
+	"s": func(a *CellAddr, v int) { a.SectionId = v },
+	"p": func(a *CellAddr, v int) { a.PassageId = v },
+	"r": func(a *CellAddr, v int) { a.RackId = v },
+	"f": func(a *CellAddr, v int) { a.Floor = v },
+	"n": func(a *CellAddr, v int) { a.Number = v },
+}
+
+// cellFormatAction действие шаблона: {{ $x }} или {{ printf "%0Nd" $x }}
+var cellFormatAction = regexp.MustCompile(`^(?:printf\s+"%0?(\d*)d"\s+)?\$([a-zA-Z])$`)
+
+// ParseCellAddr разбирает имя ячейки в числовом (GetNumeric) или
+// человеко-понятном (GetNumericView) представлении в адрес.
+// Для человеко-понятного представления номер ячейки может отсутствовать: "1-2-03-04-05"
+func ParseCellAddr(name string) (CellAddr, error) {
+	name = strings.TrimSpace(name)
+	if strings.Contains(name, "-") {
+		return parseCellNumericView(name)
+	}
+	return parseCellNumeric(name)
+}
+
+func parseCellNumeric(name string) (CellAddr, error) {
+	addr := CellAddr{}
+	if len(name) < 9 {
+		return addr, fmt.Errorf("%w: %q is too short", ErrCellAddrInvalid, name)
+	}
+	parts := []string{name[:len(name)-8], name[len(name)-8 : len(name)-6], name[len(name)-6 : len(name)-4], name[len(name)-4 : len(name)-2], name[len(name)-2:]}
+	vals, err := atoiParts(name, parts)
+	if err != nil {
+		return addr, err
+	}
+	addr.WhsId, addr.ZoneId, addr.PassageId, addr.RackId, addr.Floor = int64(vals[0]), int64(vals[1]), vals[2], vals[3], vals[4]
+	return addr, nil
+}
+
+func parseCellNumericView(name string) (CellAddr, error) {
+	addr := CellAddr{}
+	parts := strings.Split(name, "-")
+	if len(parts) != 5 && len(parts) != 6 {
+		return addr, fmt.Errorf("%w: %q must contain 5 or 6 parts", ErrCellAddrInvalid, name)
+	}
+	vals, err := atoiParts(name, parts)
+	if err != nil {
+		return addr, err
+	}
+	addr.WhsId, addr.ZoneId, addr.PassageId, addr.RackId, addr.Floor = int64(vals[0]), int64(vals[1]), vals[2], vals[3], vals[4]
+	if len(vals) == 6 {
+		addr.Number = vals[5]
+	}
+	return addr, nil
+}
+
+func atoiParts(name string, parts []string) ([]int, error) {
+	vals := make([]int, len(parts))
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%w: %q has non-numeric part %q", ErrCellAddrInvalid, name, p)
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// Parse разбирает имя ячейки, сформированное по шаблону, в адрес
+// Поддерживаются шаблоны из текста и действий вида {{ $x }} и {{ printf "%02d" $x }},
+// поля адреса, отсутствующие в шаблоне, остаются нулевыми
+func (f CellNameFormat) Parse(name string) (CellAddr, error) {
+	addr := CellAddr{}
+	if f == "" {
+		return ParseCellAddr(name)
+	}
+	re, vars, err := f.compile()
+	if err != nil {
+		return addr, err
+	}
+	m := re.FindStringSubmatch(name)
+	if m == nil {
+		return addr, fmt.Errorf("%w: %q does not match format %q", ErrCellAddrInvalid, name, string(f))
+	}
+	seen := make(map[string]int)
+	for i, v := range vars {
+		val, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return addr, fmt.Errorf("%w: %q", ErrCellAddrInvalid, name)
+		}
+		if prev, ok := seen[v]; ok && prev != val {
+			return addr, fmt.Errorf("%w: %q has inconsistent values of $%s", ErrCellAddrInvalid, name, v)
+		}
+		seen[v] = val
+		cellFormatVars[v](&addr, val)
+	}
+	return addr, nil
+}
+
+// compile строит регулярное выражение по шаблону, возвращает его и имена переменных групп
+func (f CellNameFormat) compile() (*regexp.Regexp, []string, error) {
+	var expr strings.Builder
+	vars := make([]string, 0)
+	rest := string(f)
+	expr.WriteString("^")
+	for rest != "" {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			expr.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, nil, fmt.Errorf("%w: unclosed action", ErrCellFormatNotParsed)
+		}
+		end += start
+		literal := rest[:start]
+		action := rest[start+2 : end]
+		rest = rest[end+2:]
+		// маркеры удаления пробелов {{- и -}}
+		if strings.HasPrefix(action, "-") {
+			literal = strings.TrimRight(literal, " \t\r\n")
+			action = action[1:]
+		}
+		if strings.HasSuffix(action, "-") {
+			rest = strings.TrimLeft(rest, " \t\r\n")
+			action = action[:len(action)-1]
+		}
+		expr.WriteString(regexp.QuoteMeta(literal))
+
+		m := cellFormatAction.FindStringSubmatch(strings.TrimSpace(action))
+		if m == nil {
+			return nil, nil, fmt.Errorf("%w: unsupported action {{%s}}", ErrCellFormatNotParsed, action)
+		}
+		if _, ok := cellFormatVars[m[2]]; !ok {
+			return nil, nil, fmt.Errorf("%w: unsupported variable $%s", ErrCellFormatNotParsed, m[2])
+		}
+		if m[1] != "" {
+			expr.WriteString(`(\d{` + m[1] + `,})`)
+		} else {
+			expr.WriteString(`(\d+)`)
+		}
+		vars = append(vars, m[2])
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrCellFormatNotParsed, err)
+	}
+	return re, vars, nil
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCellAddr(t *testing.T) {
+	c := Cell{Number: 5, CellAddr: CellAddr{WhsId: 1, ZoneId: 2, PassageId: 3, RackId: 4, Floor: 1}}
+	tests := []struct {
+		name    string
+		want    CellAddr
+		wantErr bool
+	}{
+		{c.GetNumeric(), CellAddr{WhsId: 1, ZoneId: 2, PassageId: 3, RackId: 4, Floor: 1}, false},
+		{c.GetNumericView(), CellAddr{WhsId: 1, ZoneId: 2, PassageId: 3, RackId: 4, Floor: 1, Number: 5}, false},
+		{"1-2-03-04-05", CellAddr{WhsId: 1, ZoneId: 2, PassageId: 3, RackId: 4, Floor: 5}, false},
+		{"1-2-03", CellAddr{}, true},
+		{"1-2-x3-04-05", CellAddr{}, true},
+		{"1234", CellAddr{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCellAddr(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCellAddr(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrCellAddrInvalid) {
+			t.Errorf("ParseCellAddr(%q) error = %v, want ErrCellAddrInvalid", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseCellAddr(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCellNameFormat_Parse(t *testing.T) {
+	c := Cell{Number: 7, CellAddr: CellAddr{WhsId: 1, ZoneId: 2, SectionId: 3, PassageId: 12, RackId: 4, Floor: 2}}
+	formats := []CellNameFormat{
+		CellCustomViewFormat,
+		`S{{ $s }}/{{ printf "%02d" $p }}.{{ printf "%03d" $r }}.{{- $f -}} #{{ $n }}`,
+	}
+	for _, f := range formats {
+		cell := c
+		if err := cell.SetName(f); err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Parse(cell.Name)
+		if err != nil {
+			t.Errorf("Parse(%q) by %q error = %v", cell.Name, f, err)
+			continue
+		}
+		if got.PassageId != c.PassageId || got.RackId != c.RackId || got.Floor != c.Floor || got.Number != c.Number {
+			t.Errorf("Parse(%q) by %q = %+v", cell.Name, f, got)
+		}
+	}
+
+	if _, err := CellNameFormat("{{ $N }}").Parse("A1"); !errors.Is(err, ErrCellFormatNotParsed) {
+		t.Errorf("Parse by $N error = %v, want ErrCellFormatNotParsed", err)
+	}
+	if _, err := CellNameFormat(CellCustomViewFormat).Parse("1-2-3"); !errors.Is(err, ErrCellAddrInvalid) {
+		t.Errorf("Parse mismatch error = %v, want ErrCellAddrInvalid", err)
+	}
+}
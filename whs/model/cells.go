@@ -2,6 +2,7 @@ package model
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"text/template"
 )
@@ -9,22 +10,61 @@ import (
 const (
 	CellNumericFormat    = "%01d%02d%02d%02d%02d"
 	CellHumanViewFormat  = "%01d-%01d-%2d-%02d-%02d-%02d"
-	CellCustomViewFormat = "{{}}"
+	CellCustomViewFormat = "{{ $w }}-{{ $z }}-{{ $p }}-{{ $r }}-{{ $f }}-{{ $n }}"
 )
 
+var (
+	ErrCellNameEmpty     = errors.New("cell name format produces an empty name")
+	ErrCellNameAmbiguous = errors.New("cell name format produces the same name for different addresses")
+)
+
+// CellNameFormat шаблон имени ячейки (text/template)
+// Доступные переменные: $w - склад, $z - зона, $s - секция, $p - проезд, $r - стеллаж, $f - этаж,
+// $n - номер ячейки, $N - текущее имя. Пустой шаблон - числовое представление (GetNumericView)
 type CellNameFormat string
 
+// Validate проверяет, что шаблон разбирается, формирует непустое имя для нулевого адреса и адресов
+// со всеми ненулевыми составляющими, и что имена двух адресов, различающихся каждой составляющей, различны
+func (f CellNameFormat) Validate() error {
+	if f == "" {
+		return nil
+	}
+	samples := []Cell{
+		{},
+		{Number: 7, CellAddr: CellAddr{WhsId: 1, ZoneId: 2, SectionId: 3, PassageId: 4, RackId: 5, Floor: 6, Number: 7}},
+		{Number: 18, CellAddr: CellAddr{WhsId: 12, ZoneId: 13, SectionId: 14, PassageId: 15, RackId: 16, Floor: 17, Number: 18}},
+	}
+	names := make([]string, len(samples))
+	for i := range samples {
+		name, err := samples[i].GetCustomView(string(f))
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return ErrCellNameEmpty
+		}
+		names[i] = name
+	}
+	if names[1] == names[2] {
+		return ErrCellNameAmbiguous
+	}
+	return nil
+}
+
 // Cell - ячейка
 // Склад/Зона/Блок/Проезд/Стеллаж/Этаж
 type Cell struct {
 	Id            int64
-	Name          string `json:"name"`
-	Number        int    `json:"number"` // Номер (порядковый) ячейки на полке
-	IsSizeFree    bool   `json:"is_size_free"`
-	IsWeightFree  bool   `json:"is_weight_free"`
-	NotAllowedIn  bool   `json:"not_allowed_in"`
-	NotAllowedOut bool   `json:"not_allowed_out"`
-	IsService     bool   `json:"is_service"`
+	Name          string  `json:"name"`
+	Number        int     `json:"number"` // Номер (порядковый) ячейки на полке
+	IsSizeFree    bool    `json:"is_size_free"`
+	IsWeightFree  bool    `json:"is_weight_free"`
+	NotAllowedIn  bool    `json:"not_allowed_in"`
+	NotAllowedOut bool    `json:"not_allowed_out"`
+	IsService     bool    `json:"is_service"`
+	MaxWeight     float64 `json:"max_weight"` // допустимый вес размещенных продуктов, кг (0 - не ограничен, см. IsWeightFree)
+	MaxVolume     float64 `json:"max_volume"` // допустимый объем размещенных продуктов, см3 (0 - не ограничен, см. IsSizeFree)
+	Version       int64   `json:"version"`    // версия записи, см. UpdateCell
 	//Size          SpecificSize `json:"size"`
 	CellAddr
 }
@@ -39,6 +79,22 @@ type CellAddr struct {
 	Number    int   `json:"number"`     // Порядковый номер ячейки по адресу
 }
 
+// CellsRange диапазон адресов для массового создания ячеек
+// Создаются ячейки для каждого сочетания проезд/стеллаж/этаж, по CellsPerFloor ячеек на этаже
+type CellsRange struct {
+	WhsId         int64 `json:"whs_id"`
+	ZoneId        int64 `json:"zone_id"`
+	SectionId     int   `json:"section_id"`
+	PassageFrom   int   `json:"passage_from"`
+	PassageTo     int   `json:"passage_to"`
+	RackFrom      int   `json:"rack_from"`
+	RackTo        int   `json:"rack_to"`
+	FloorFrom     int   `json:"floor_from"`
+	FloorTo       int   `json:"floor_to"`
+	CellsPerFloor int   `json:"cells_per_floor"`
+	Props         Cell  `json:"props"` // Свойства (признаки) создаваемых ячеек
+}
+
 // GetNumeric возвращает строковое представление ячейки в виде набора чисел
 func (ci *Cell) GetNumeric() string {
 	return fmt.Sprintf(CellNumericFormat, ci.WhsId, ci.ZoneId, ci.PassageId, ci.RackId, ci.Floor)
@@ -49,7 +105,8 @@ func (ci *Cell) GetNumericView() string {
 	return fmt.Sprintf(CellHumanViewFormat, ci.WhsId, ci.ZoneId, ci.PassageId, ci.RackId, ci.Floor, ci.Number)
 }
 
-func (ci *Cell) GetCustomView(tplCell string) string {
+// GetCustomView возвращает представление ячейки по шаблону tplCell (см. CellNameFormat)
+func (ci *Cell) GetCustomView(tplCell string) (string, error) {
 	tplBase := `{{- $w := .WhsId }}
 				{{- $z := .ZoneId }}
 				{{- $s := .SectionId }}
@@ -60,14 +117,29 @@ func (ci *Cell) GetCustomView(tplCell string) string {
 	var buf bytes.Buffer
 	t, err := template.New("").Parse(tplBase + tplCell)
 	if err != nil {
-		return err.Error()
+		return "", err
 	}
 	err = t.Execute(&buf, ci)
 	if err != nil {
-		return err.Error()
+		return "", err
 	}
-	return buf.String()
+	return buf.String(), nil
 }
-func (ci *Cell) SetName(format CellNameFormat) {
-	ci.Name = ci.GetNumericView() // пока так
+
+// SetName устанавливает имя ячейки по шаблону format
+// Для пустого шаблона используется числовое представление
+func (ci *Cell) SetName(format CellNameFormat) error {
+	if format == "" {
+		ci.Name = ci.GetNumericView()
+		return nil
+	}
+	name, err := ci.GetCustomView(string(format))
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return ErrCellNameEmpty
+	}
+	ci.Name = name
+	return nil
 }
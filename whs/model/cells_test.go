@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -28,3 +29,44 @@ func TestCell_GetCustomView(t *testing.T) {
 	}
 	fmt.Println(c.GetCustomView(tpl))
 }
+
+func TestCell_SetName(t *testing.T) {
+	c := Cell{Number: 5, CellAddr: CellAddr{WhsId: 1, ZoneId: 2, PassageId: 3, RackId: 4, Floor: 1}}
+	tests := []struct {
+		format  CellNameFormat
+		want    string
+		wantErr bool
+	}{
+		{"", c.GetNumericView(), false},
+		{CellCustomViewFormat, "1-2-3-4-1-5", false},
+		{`{{ printf "%02d" $p }}.{{ $r }}`, "03.4", false},
+		{"{{ $unknown }}", "", true},
+		{"{{ if false }}x{{ end }}", "", true},
+		{`{{ if $p }}{{ slice "ab" $p }}{{ end }}`, "", true}, // ошибка только на ненулевом проезде
+	}
+	for _, tt := range tests {
+		cell := c
+		err := cell.SetName(tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SetName(%q) error = %v, wantErr %v", tt.format, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && cell.Name != tt.want {
+			t.Errorf("SetName(%q) = %q, want %q", tt.format, cell.Name, tt.want)
+		}
+		if tt.wantErr == (tt.format.Validate() == nil) {
+			t.Errorf("Validate(%q) disagrees with SetName", tt.format)
+		}
+	}
+}
+
+func TestCellNameFormat_Validate(t *testing.T) {
+	for _, f := range []CellNameFormat{"A1", "{{ if false }}{{ $p }}{{ end }}R"} {
+		if err := f.Validate(); !errors.Is(err, ErrCellNameAmbiguous) {
+			t.Errorf("Validate(%q) = %v, want ErrCellNameAmbiguous", f, err)
+		}
+	}
+	if err := CellNameFormat("{{ $p }}-{{ $r }}-{{ $f }}").Validate(); err != nil {
+		t.Errorf("Validate of address format = %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Виды зависимостей сущности (Dependency.Kind)
+const (
+	DependencyStock     = "stock"      // ненулевые остатки в ячейках склада
+	DependencyDocuments = "documents"  // строки ledger склада (движения по документам)
+	DependencyBarcodes  = "barcodes"   // штрих-коды сущности
+	DependencyProducts  = "products"   // продукты производителя
+	DependencyCells     = "cells"      // ячейки склада
+	DependencyPickFaces = "pick_faces" // настройки ячеек отбора продукта
+	DependencyWaves     = "waves"      // волны отбора склада
+)
+
+// DependencyIdsLimit максимальное количество идентификаторов в Dependency.Ids
+const DependencyIdsLimit = 20
+
+// Dependency записи вида Kind, ссылающиеся на сущность
+type Dependency struct {
+	Kind  string  `json:"kind"`
+	WhsId int64   `json:"whs_id,omitempty"` // склад остатков и документов
+	Count int64   `json:"count"`            // количество записей
+	Ids   []int64 `json:"ids,omitempty"`    // идентификаторы первых записей (ячеек для остатков), не более DependencyIdsLimit
+}
+
+// DependencyReport зависимости сущности Entity (Entity*) с идентификатором Id, препятствующие ее удалению
+type DependencyReport struct {
+	Entity       string       `json:"entity"`
+	Id           int64        `json:"id"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// Add добавляет зависимость, если у нее есть записи
+func (r *DependencyReport) Add(d Dependency) {
+	if d.Count > 0 {
+		if len(d.Ids) > DependencyIdsLimit {
+			d.Ids = d.Ids[:DependencyIdsLimit]
+		}
+		r.Dependencies = append(r.Dependencies, d)
+	}
+}
+
+// Empty сущность ни на что не ссылается и может быть удалена
+func (r *DependencyReport) Empty() bool {
+	return len(r.Dependencies) == 0
+}
+
+// String краткое описание зависимостей: "stock (2), barcodes (1)"
+func (r *DependencyReport) String() string {
+	parts := make([]string, 0, len(r.Dependencies))
+	for _, d := range r.Dependencies {
+		if d.WhsId != 0 {
+			parts = append(parts, fmt.Sprintf("%s of warehouse %d (%d)", d.Kind, d.WhsId, d.Count))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s (%d)", d.Kind, d.Count))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ArchivedItem запись справочника в архиве
+type ArchivedItem struct {
+	Entity     string    `json:"entity"`
+	Id         int64     `json:"id"`
+	Name       string    `json:"name"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
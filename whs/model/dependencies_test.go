@@ -0,0 +1,23 @@
+package model
+
+import "testing"
+
+func TestDependencyReport(t *testing.T) {
+	r := DependencyReport{Entity: EntityProduct, Id: 1}
+	if !r.Empty() {
+		t.Fatal("new report is not empty")
+	}
+	ids := make([]int64, DependencyIdsLimit+5)
+	r.Add(Dependency{Kind: DependencyStock, WhsId: 2, Count: int64(len(ids)), Ids: ids})
+	r.Add(Dependency{Kind: DependencyDocuments, WhsId: 3})
+	r.Add(Dependency{Kind: DependencyBarcodes, Count: 1, Ids: []int64{7}})
+	if len(r.Dependencies) != 2 {
+		t.Fatalf("dependencies = %+v, want zero count skipped", r.Dependencies)
+	}
+	if n := len(r.Dependencies[0].Ids); n != DependencyIdsLimit {
+		t.Errorf("len(Ids) = %d, want %d", n, DependencyIdsLimit)
+	}
+	if got, want := r.String(), "stock of warehouse 2 (25), barcodes (1)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,20 @@
+package model
+
+// Типы сущностей реестра внешних идентификаторов
+const (
+	EntityProduct      = "product"
+	EntityManufacturer = "manufacturer"
+	EntityWarehouse    = "warehouse"
+	EntityUser         = "user"
+)
+
+// ExternalSystem1C имя системы 1С (обмен CommerceML) в реестре внешних идентификаторов
+const ExternalSystem1C = "1c"
+
+// ExternalId сопоставление идентификатора внешней системы (ERP) с сущностью модуля
+type ExternalId struct {
+	System string `json:"system"` // имя внешней системы
+	Key    string `json:"key"`    // идентификатор во внешней системе
+	Entity string `json:"entity"` // тип сущности, Entity*
+	Id     int64  `json:"id"`     // id сущности
+}
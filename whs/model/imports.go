@@ -0,0 +1,64 @@
+package model
+
+// Действия импорта строки
+const (
+	ImportActionCreate = "create"
+	ImportActionUpdate = "update"
+	ImportActionError  = "error"
+)
+
+// ProductImportRow строка импорта каталога продуктов
+type ProductImportRow struct {
+	Line         int      `json:"line"`        // номер строки источника
+	ExternalId   string   `json:"external_id"` // id продукта во внешней системе ImportOptions.System
+	Name         string   `json:"name"`
+	ItemNumber   string   `json:"item_number"`
+	Manufacturer string   `json:"manufacturer"`
+	Barcodes     []string `json:"barcodes"`
+}
+
+// ImportOptions параметры импорта
+type ImportOptions struct {
+	BatchSize int  `json:"batch_size"` // строк в транзакции, 0 - DefaultImportBatchSize
+	DryRun    bool `json:"dry_run"`    // только проверка, без записи
+	// System внешняя система, идентификаторы которой указаны в ProductImportRow.ExternalId
+	// Продукты сопоставляются с реестром внешних идентификаторов, повторный импорт обновляет те же продукты
+	System string `json:"system"`
+}
+
+// DefaultImportBatchSize количество строк импорта в одной транзакции по умолчанию
+var DefaultImportBatchSize = 500
+
+// ImportRowResult результат импорта строки
+type ImportRowResult struct {
+	Line       int    `json:"line"`
+	ItemNumber string `json:"item_number"`
+	ExternalId string `json:"external_id,omitempty"` // id строки во внешней системе
+	Action     string `json:"action"`                // ImportActionCreate, ImportActionUpdate, ImportActionError
+	ProductId  int64  `json:"product_id"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ImportReport результат импорта
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// Add учитывает результат строки
+func (r *ImportReport) Add(row ImportRowResult) {
+	r.Total++
+	switch row.Action {
+	case ImportActionCreate:
+		r.Created++
+	case ImportActionUpdate:
+		r.Updated++
+	case ImportActionError:
+		r.Failed++
+	}
+	r.Rows = append(r.Rows, row)
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"time"
+)
+
+// Интервалы рядов KPI
+const (
+	KpiPeriodDay   = "day"
+	KpiPeriodWeek  = "week"
+	KpiPeriodMonth = "month"
+)
+
+// KpiQuery параметры отчета KPI
+type KpiQuery struct {
+	WhsId  int64     `json:"whs_id"`
+	ZoneId int64     `json:"zone_id"` // 0 - все зоны
+	ByZone bool      `json:"by_zone"` // ряды в разрезе зон
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Period string    `json:"period"` // KpiPeriodDay, KpiPeriodWeek, KpiPeriodMonth
+}
+
+// KpiPoint показатели за интервал
+type KpiPoint struct {
+	Period        time.Time `json:"period"` // начало интервала
+	ZoneId        int64     `json:"zone_id"`
+	InboundLines  int       `json:"inbound_lines"`
+	InboundQty    int       `json:"inbound_qty"`
+	OutboundLines int       `json:"outbound_lines"`
+	OutboundQty   int       `json:"outbound_qty"`
+	MoveLines     int       `json:"move_lines"`
+	MoveQty       int       `json:"move_qty"`
+}
+
+// UserThroughput производительность пользователя
+// Пользователь строки ledger записывается только для операций, выполненных в контексте whs.WithActor,
+// остальные операции (в том числе записанные до появления пользователя в ledger) учитываются с UserId 0
+type UserThroughput struct {
+	UserId       int64   `json:"user_id"` // 0 - пользователь не известен
+	Lines        int     `json:"lines"`
+	ActiveHours  int     `json:"active_hours"` // часов, в которые были операции
+	LinesPerHour float64 `json:"lines_per_hour"`
+}
+
+// KpiReport отчет KPI склада
+type KpiReport struct {
+	Query       KpiQuery         `json:"query"`
+	Series      []KpiPoint       `json:"series"`
+	Users       []UserThroughput `json:"users"`
+	DockToStock time.Duration    `json:"dock_to_stock"` // среднее время от приемки до размещения в зоне хранения
+	OrderCycle  time.Duration    `json:"order_cycle"`   // среднее время от формирования волны до ее завершения
+}
+
+// FifoDwell рассчитывает среднее (взвешенное по количеству) время нахождения продукта
+// по движениям, упорядоченным по времени: приход ожидает расхода, расход списывает ранние приходы.
+// Учитывается только расход начиная с момента since. Возвращает учтенное количество и среднее время
+func FifoDwell(movements []Movement, since time.Time) (int, time.Duration) {
+	type layer struct {
+		time     time.Time
+		quantity int
+	}
+	layers := make([]layer, 0)
+	total := 0
+	var weighted float64
+	for _, m := range movements {
+		if m.Quantity > 0 {
+			layers = append(layers, layer{m.Time, m.Quantity})
+			continue
+		}
+		consumed := -m.Quantity
+		for consumed > 0 && len(layers) > 0 {
+			q := min(consumed, layers[0].quantity)
+			if !m.Time.Before(since) {
+				weighted += float64(q) * float64(m.Time.Sub(layers[0].time))
+				total += q
+			}
+			layers[0].quantity -= q
+			consumed -= q
+			if layers[0].quantity == 0 {
+				layers = layers[1:]
+			}
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return total, time.Duration(weighted / float64(total))
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFifoDwell(t *testing.T) {
+	t0 := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	qty, avg := FifoDwell([]Movement{
+		{Time: t0, Quantity: 10},
+		{Time: t0.Add(time.Hour), Quantity: 10},
+		{Time: t0.Add(2 * time.Hour), Quantity: -15}, // 10 по 2ч и 5 по 1ч
+	}, t0)
+	if qty != 15 {
+		t.Errorf("quantity = %d, want 15", qty)
+	}
+	if want := 100 * time.Minute; avg != want {
+		t.Errorf("dwell = %v, want %v", avg, want)
+	}
+}
@@ -0,0 +1,314 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Направление движения по проезду
+const (
+	PassageTwoWay   = 0  // двустороннее движение
+	PassageForward  = 1  // только от начала проезда к концу (по росту Y)
+	PassageBackward = -1 // только от конца проезда к началу
+)
+
+// Сторона проезда, с которой стоит стеллаж
+const (
+	RackSideLeft  = -1
+	RackSideRight = 1
+)
+
+var (
+	ErrLayoutInvalid   = errors.New("invalid warehouse layout")
+	ErrCellNotInLayout = errors.New("cell is not placed in warehouse layout")
+	ErrNoPath          = errors.New("no path between points of warehouse layout")
+)
+
+// LayoutPoint точка на плане склада (метры)
+type LayoutPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Layout физическая планировка склада
+// Проезды параллельны оси Y, их начала и концы соединены поперечными проездами
+// (передним и задним), по которым движение двустороннее.
+// Вход и выход примыкают к началу ближайшего по X проезда
+type Layout struct {
+	WhsId    int64           `json:"whs_id"`
+	Entry    LayoutPoint     `json:"entry"`
+	Exit     LayoutPoint     `json:"exit"`
+	Passages []PassageLayout `json:"passages"`
+}
+
+// PassageLayout геометрия проезда
+type PassageLayout struct {
+	PassageId int          `json:"passage_id"`
+	X         float64      `json:"x"`
+	YStart    float64      `json:"y_start"`
+	YEnd      float64      `json:"y_end"`
+	Direction int          `json:"direction"` // PassageTwoWay, PassageForward, PassageBackward
+	Racks     []RackLayout `json:"racks"`
+}
+
+// RackLayout расположение стеллажа вдоль проезда
+type RackLayout struct {
+	RackId     int     `json:"rack_id"`
+	Side       int     `json:"side"`        // RackSideLeft, RackSideRight
+	Offset     float64 `json:"offset"`      // расстояние от начала проезда до начала стеллажа
+	CellLength float64 `json:"cell_length"` // шаг ячейки вдоль стеллажа
+	Cells      int     `json:"cells"`       // количество ячеек на полке
+	Reverse    bool    `json:"reverse"`     // ячейки нумеруются от конца проезда
+}
+
+// Location положение на плане: точка проезда или вход/выход склада
+type Location struct {
+	Passage int     // индекс проезда в Layout.Passages, -1 для входа/выхода
+	Y       float64 // координата вдоль проезда
+	node    int     // узел графа для входа/выхода
+}
+
+// Validate проверяет корректность планировки
+func (l *Layout) Validate() error {
+	if len(l.Passages) == 0 {
+		return fmt.Errorf("%w: no passages", ErrLayoutInvalid)
+	}
+	ids := make(map[int]bool)
+	for _, p := range l.Passages {
+		if ids[p.PassageId] {
+			return fmt.Errorf("%w: duplicate passage %d", ErrLayoutInvalid, p.PassageId)
+		}
+		ids[p.PassageId] = true
+		if p.YEnd <= p.YStart {
+			return fmt.Errorf("%w: passage %d has non-positive length", ErrLayoutInvalid, p.PassageId)
+		}
+		if p.Direction < PassageBackward || p.Direction > PassageForward {
+			return fmt.Errorf("%w: passage %d has unknown direction %d", ErrLayoutInvalid, p.PassageId, p.Direction)
+		}
+		racks := make(map[int]bool)
+		for _, r := range p.Racks {
+			if racks[r.RackId] {
+				return fmt.Errorf("%w: duplicate rack %d in passage %d", ErrLayoutInvalid, r.RackId, p.PassageId)
+			}
+			racks[r.RackId] = true
+			if r.CellLength <= 0 || r.Offset < 0 {
+				return fmt.Errorf("%w: rack %d in passage %d has invalid geometry", ErrLayoutInvalid, r.RackId, p.PassageId)
+			}
+			if r.Cells > 0 && r.Offset+float64(r.Cells)*r.CellLength > p.YEnd-p.YStart {
+				return fmt.Errorf("%w: rack %d is longer than passage %d", ErrLayoutInvalid, r.RackId, p.PassageId)
+			}
+			if r.Reverse && r.Cells == 0 {
+				return fmt.Errorf("%w: reversed rack %d in passage %d needs cells count", ErrLayoutInvalid, r.RackId, p.PassageId)
+			}
+		}
+	}
+	return nil
+}
+
+// Locate возвращает положение ячейки на плане (середина ячейки вдоль проезда)
+func (l *Layout) Locate(c *Cell) (Location, error) {
+	for i, p := range l.Passages {
+		if p.PassageId != c.PassageId {
+			continue
+		}
+		for _, r := range p.Racks {
+			if r.RackId != c.RackId {
+				continue
+			}
+			num := c.Number
+			if num < 1 || (r.Cells > 0 && num > r.Cells) {
+				break
+			}
+			if r.Reverse {
+				num = r.Cells - num + 1
+			}
+			y := p.YStart + r.Offset + (float64(num)-0.5)*r.CellLength
+			return Location{Passage: i, Y: y}, nil
+		}
+		break
+	}
+	return Location{}, fmt.Errorf("%w: cell %d (passage %d, rack %d, number %d)", ErrCellNotInLayout, c.Id, c.PassageId, c.RackId, c.Number)
+}
+
+// EntryLocation положение входа на склад
+func (l *Layout) EntryLocation() Location {
+	return Location{Passage: -1, node: 2 * len(l.Passages)}
+}
+
+// ExitLocation положение выхода со склада
+func (l *Layout) ExitLocation() Location {
+	return Location{Passage: -1, node: 2*len(l.Passages) + 1}
+}
+
+// Distance возвращает длину кратчайшего пешего пути от ячейки a до ячейки b с учетом одностороннего движения
+func (l *Layout) Distance(a, b *Cell) (float64, error) {
+	from, err := l.Locate(a)
+	if err != nil {
+		return 0, err
+	}
+	to, err := l.Locate(b)
+	if err != nil {
+		return 0, err
+	}
+	return l.LocationDistance(from, to)
+}
+
+// LocationDistance возвращает длину кратчайшего пути между положениями на плане
+func (l *Layout) LocationDistance(from, to Location) (float64, error) {
+	g, err := l.graph()
+	if err != nil {
+		return 0, err
+	}
+	d := g.distance(g.shortest(from), from, to)
+	if math.IsInf(d, 1) {
+		return 0, ErrNoPath
+	}
+	return d, nil
+}
+
+// DistanceMatrix возвращает матрицу расстояний между положениями на плане
+// Недостижимые пары имеют значение +Inf
+func (l *Layout) DistanceMatrix(locs []Location) ([][]float64, error) {
+	g, err := l.graph()
+	if err != nil {
+		return nil, err
+	}
+	m := make([][]float64, len(locs))
+	for i, from := range locs {
+		dist := g.shortest(from)
+		m[i] = make([]float64, len(locs))
+		for j, to := range locs {
+			if i != j {
+				m[i][j] = g.distance(dist, from, to)
+			}
+		}
+	}
+	return m, nil
+}
+
+type layoutEdge struct {
+	to     int
+	weight float64
+}
+
+// layoutGraph граф проездов: узлы 2i и 2i+1 - начало и конец проезда i, затем вход и выход
+type layoutGraph struct {
+	l   *Layout
+	adj [][]layoutEdge
+}
+
+func (l *Layout) graph() (*layoutGraph, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	n := len(l.Passages)
+	g := &layoutGraph{l: l, adj: make([][]layoutEdge, 2*n+2)}
+	addEdge := func(from, to int, w float64) {
+		g.adj[from] = append(g.adj[from], layoutEdge{to: to, weight: w})
+	}
+	manhattan := func(a, b LayoutPoint) float64 {
+		return math.Abs(a.X-b.X) + math.Abs(a.Y-b.Y)
+	}
+
+	order := make([]int, n)
+	for i, p := range l.Passages {
+		order[i] = i
+		length := p.YEnd - p.YStart
+		if p.Direction != PassageBackward {
+			addEdge(2*i, 2*i+1, length)
+		}
+		if p.Direction != PassageForward {
+			addEdge(2*i+1, 2*i, length)
+		}
+	}
+	// поперечные проезды соединяют соседние по X проезды
+	sort.Slice(order, func(i, j int) bool { return l.Passages[order[i]].X < l.Passages[order[j]].X })
+	for k := 1; k < n; k++ {
+		a, b := order[k-1], order[k]
+		pa, pb := l.Passages[a], l.Passages[b]
+		front := manhattan(LayoutPoint{pa.X, pa.YStart}, LayoutPoint{pb.X, pb.YStart})
+		back := manhattan(LayoutPoint{pa.X, pa.YEnd}, LayoutPoint{pb.X, pb.YEnd})
+		addEdge(2*a, 2*b, front)
+		addEdge(2*b, 2*a, front)
+		addEdge(2*a+1, 2*b+1, back)
+		addEdge(2*b+1, 2*a+1, back)
+	}
+	// вход и выход примыкают к началу ближайшего проезда
+	nearest := func(pt LayoutPoint) int {
+		best := 0
+		for i, p := range l.Passages {
+			if math.Abs(p.X-pt.X) < math.Abs(l.Passages[best].X-pt.X) {
+				best = i
+			}
+		}
+		return best
+	}
+	e := nearest(l.Entry)
+	addEdge(2*n, 2*e, manhattan(l.Entry, LayoutPoint{l.Passages[e].X, l.Passages[e].YStart}))
+	x := nearest(l.Exit)
+	addEdge(2*x, 2*n+1, manhattan(l.Exit, LayoutPoint{l.Passages[x].X, l.Passages[x].YStart}))
+	return g, nil
+}
+
+// shortest возвращает расстояния от положения from до всех узлов графа (алгоритм Дейкстры)
+func (g *layoutGraph) shortest(from Location) []float64 {
+	dist := make([]float64, len(g.adj))
+	done := make([]bool, len(g.adj))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	if from.Passage < 0 {
+		dist[from.node] = 0
+	} else {
+		p := g.l.Passages[from.Passage]
+		if p.Direction != PassageForward {
+			dist[2*from.Passage] = from.Y - p.YStart
+		}
+		if p.Direction != PassageBackward {
+			dist[2*from.Passage+1] = p.YEnd - from.Y
+		}
+	}
+	for {
+		u := -1
+		for i := range dist {
+			if !done[i] && !math.IsInf(dist[i], 1) && (u < 0 || dist[i] < dist[u]) {
+				u = i
+			}
+		}
+		if u < 0 {
+			return dist
+		}
+		done[u] = true
+		for _, e := range g.adj[u] {
+			if d := dist[u] + e.weight; d < dist[e.to] {
+				dist[e.to] = d
+			}
+		}
+	}
+}
+
+// distance возвращает расстояние до положения to по результату shortest
+func (g *layoutGraph) distance(dist []float64, from, to Location) float64 {
+	if to.Passage < 0 {
+		return dist[to.node]
+	}
+	p := g.l.Passages[to.Passage]
+	best := math.Inf(1)
+	if p.Direction != PassageBackward {
+		best = math.Min(best, dist[2*to.Passage]+to.Y-p.YStart)
+	}
+	if p.Direction != PassageForward {
+		best = math.Min(best, dist[2*to.Passage+1]+p.YEnd-to.Y)
+	}
+	if from.Passage == to.Passage {
+		switch {
+		case to.Y >= from.Y && p.Direction != PassageBackward:
+			best = math.Min(best, to.Y-from.Y)
+		case to.Y <= from.Y && p.Direction != PassageForward:
+			best = math.Min(best, from.Y-to.Y)
+		}
+	}
+	return best
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+// testLayout три проезда длиной 20м через 5м, стеллажи по 10 ячеек шириной 1м с отступом 5м
+func testLayout() *Layout {
+	l := &Layout{Entry: LayoutPoint{X: 0, Y: -2}, Exit: LayoutPoint{X: 10, Y: -2}}
+	for i := 0; i < 3; i++ {
+		l.Passages = append(l.Passages, PassageLayout{
+			PassageId: i + 1,
+			X:         float64(i * 5),
+			YStart:    0,
+			YEnd:      20,
+			Racks: []RackLayout{
+				{RackId: 1, Side: RackSideLeft, Offset: 5, CellLength: 1, Cells: 10},
+				{RackId: 2, Side: RackSideRight, Offset: 5, CellLength: 1, Cells: 10, Reverse: true},
+			},
+		})
+	}
+	return l
+}
+
+func testCell(passage, rack, number int) *Cell {
+	return &Cell{Number: number, CellAddr: CellAddr{PassageId: passage, RackId: rack}}
+}
+
+func TestLayout_Distance(t *testing.T) {
+	l := testLayout()
+	tests := []struct {
+		name string
+		a, b *Cell
+		want float64
+	}{
+		{"same rack", testCell(1, 1, 1), testCell(1, 1, 4), 3},
+		{"reversed rack", testCell(1, 1, 1), testCell(1, 2, 1), 9},
+		{"next passage via front", testCell(1, 1, 1), testCell(2, 1, 1), 5.5 + 5 + 5.5},
+		{"next passage via back", testCell(1, 1, 10), testCell(2, 2, 1), 5.5 + 5 + 5.5},
+	}
+	for _, tt := range tests {
+		got, err := l.Distance(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Distance = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := l.Distance(testCell(1, 1, 11), testCell(1, 1, 1)); !errors.Is(err, ErrCellNotInLayout) {
+		t.Errorf("Distance to unknown cell error = %v, want ErrCellNotInLayout", err)
+	}
+}
+
+func TestLayout_DistanceOneWay(t *testing.T) {
+	l := testLayout()
+	l.Passages[1].Direction = PassageForward
+	// назад по одностороннему проезду нельзя: выход в конец, соседний проезд и обратно
+	got, err := l.Distance(testCell(2, 1, 5), testCell(2, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 10.5 + 5 + 20 + 5 + 5.5; got != want {
+		t.Errorf("Distance = %v, want %v", got, want)
+	}
+
+	for i := range l.Passages {
+		l.Passages[i].Direction = PassageForward
+	}
+	if _, err = l.Distance(testCell(2, 1, 5), testCell(2, 1, 1)); !errors.Is(err, ErrNoPath) {
+		t.Errorf("Distance error = %v, want ErrNoPath", err)
+	}
+}
+
+func TestLayout_EntryExit(t *testing.T) {
+	l := testLayout()
+	got, err := l.LocationDistance(l.EntryLocation(), l.ExitLocation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2 + 10 + 2.0; got != want {
+		t.Errorf("entry-exit distance = %v, want %v", got, want)
+	}
+}
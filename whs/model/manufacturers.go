@@ -1,6 +1,10 @@
 package model
 
+import "time"
+
 type Manufacturer struct {
-	Id   int64  `json:"id"`
-	Name string `json:"name"`
+	Id         int64      `json:"id"`
+	Name       string     `json:"name"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"` // время архивации, nil - действующий производитель
+	Version    int64      `json:"version"`               // версия записи, см. UpdateManufacturer
 }
@@ -1,9 +1,15 @@
 package model
 
+import "time"
+
 type Product struct {
 	Id           int64        `json:"id"`
 	Name         string       `json:"name"`
 	ItemNumber   string       `json:"item_number"`
 	Manufacturer Manufacturer `json:"manufacturer"`
 	Barcodes     []Barcode    `json:"barcodes"`
+	Weight       float64      `json:"weight"`                // вес единицы, кг (0 - не учитывается при размещении)
+	Volume       float64      `json:"volume"`                // объем единицы, см3 (0 - не учитывается при размещении)
+	ArchivedAt   *time.Time   `json:"archived_at,omitempty"` // время архивации, nil - действующий продукт
+	Version      int64        `json:"version"`               // версия записи, см. UpdateProduct
 }
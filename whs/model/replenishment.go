@@ -0,0 +1,67 @@
+package model
+
+// PickFace настройка ячейки отбора (зоны штучного отбора) для продукта
+// При снижении остатка ниже Min ячейка пополняется из резерва до Max
+type PickFace struct {
+	Cell      Cell  `json:"cell"`
+	ProductId int64 `json:"product_id"`
+	Min       int   `json:"min"`
+	Max       int   `json:"max"`
+}
+
+// ReplenishmentTask задание на перемещение продукта из резервной ячейки в ячейку отбора
+type ReplenishmentTask struct {
+	ProductId int64 `json:"product_id"`
+	CellSrc   Cell  `json:"cell_src"` // резерв
+	CellDst   Cell  `json:"cell_dst"` // ячейка отбора
+	Quantity  int   `json:"quantity"`
+}
+
+// PlanReplenishment рассчитывает задания на пополнение ячеек отбора faces.
+// stock - остатки склада по ячейкам, demand - неотобранная потребность по продуктам.
+// Потребность продукта покрывается его ячейками отбора по порядку. Ячейка пополняется,
+// если свободный от потребности остаток ниже Min или потребность не покрыта, на количество
+// до Max плюс непокрытая потребность. Источник - ячейки, не являющиеся ячейками отбора продукта
+func PlanReplenishment(faces []PickFace, stock []CellStock, demand map[int64]int) []ReplenishmentTask {
+	type faceKey struct{ cellId, productId int64 }
+	isFace := make(map[faceKey]bool)
+	for _, f := range faces {
+		isFace[faceKey{f.Cell.Id, f.ProductId}] = true
+	}
+	current := make(map[faceKey]int)
+	reserve := make([]CellStock, 0)
+	for _, st := range stock {
+		k := faceKey{st.Cell.Id, st.ProductId}
+		if isFace[k] {
+			current[k] += st.Quantity
+		} else {
+			reserve = append(reserve, st)
+		}
+	}
+	pool := NewReservePool(reserve)
+
+	uncovered := make(map[int64]int)
+	for productId, qty := range demand {
+		uncovered[productId] = qty
+	}
+	tasks := make([]ReplenishmentTask, 0)
+	for _, f := range faces {
+		qty := current[faceKey{f.Cell.Id, f.ProductId}]
+		covered := min(qty, uncovered[f.ProductId])
+		uncovered[f.ProductId] -= covered
+		free := qty - covered
+		if free >= f.Min && uncovered[f.ProductId] == 0 {
+			continue
+		}
+		want := max(f.Max-free, 0) + uncovered[f.ProductId]
+		if want == 0 {
+			continue
+		}
+		allocs, short := pool.Allocate(f.ProductId, want)
+		uncovered[f.ProductId] -= min(uncovered[f.ProductId], want-short)
+		for _, a := range allocs {
+			tasks = append(tasks, ReplenishmentTask{ProductId: f.ProductId, CellSrc: a.Cell, CellDst: f.Cell, Quantity: a.Quantity})
+		}
+	}
+	return tasks
+}
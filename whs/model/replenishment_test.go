@@ -0,0 +1,35 @@
+package model
+
+import "testing"
+
+func TestPlanReplenishment(t *testing.T) {
+	face := Cell{Id: 1, CellAddr: CellAddr{Floor: 1}}
+	low := Cell{Id: 2, CellAddr: CellAddr{Floor: 2}}
+	high := Cell{Id: 3, CellAddr: CellAddr{Floor: 5}}
+	faces := []PickFace{{Cell: face, ProductId: 10, Min: 5, Max: 20}}
+	stock := []CellStock{
+		{Cell: face, ProductId: 10, Quantity: 8},
+		{Cell: low, ProductId: 10, Quantity: 50},
+		{Cell: high, ProductId: 10, Quantity: 6},
+	}
+
+	if tasks := PlanReplenishment(faces, stock, nil); len(tasks) != 0 {
+		t.Errorf("face above min must not be replenished, got %+v", tasks)
+	}
+
+	// потребность 10: 8 покрыто ячейкой, 2 не покрыто, свободный остаток 0 < min
+	tasks := PlanReplenishment(faces, stock, map[int64]int{10: 10})
+	total := 0
+	for _, task := range tasks {
+		if task.CellDst.Id != face.Id {
+			t.Errorf("task destination = %d, want %d", task.CellDst.Id, face.Id)
+		}
+		total += task.Quantity
+	}
+	if total != 22 {
+		t.Errorf("replenished %d, want 22", total)
+	}
+	if len(tasks) != 2 || tasks[0].CellSrc.Id != high.Id || tasks[0].Quantity != 6 {
+		t.Errorf("reserve must be taken from upper floors first, got %+v", tasks)
+	}
+}
@@ -10,3 +10,46 @@ type RowStock struct {
 type StockData struct {
 	Rows []RowStock `json:"rows"`
 }
+
+// Уровни группировки остатков
+const (
+	StockGroupCell        = iota // продукт в ячейке
+	StockGroupProduct            // продукт
+	StockGroupProductZone        // продукт в зоне
+)
+
+// Сортировка остатков
+const (
+	StockSortProduct      = "product"
+	StockSortManufacturer = "manufacturer"
+	StockSortZone         = "zone"
+	StockSortCell         = "cell"
+	StockSortQuantity     = "quantity"
+)
+
+// StockFilter отбор остатков. Пустые поля не ограничивают выборку
+type StockFilter struct {
+	WhsId           int64   `json:"whs_id"`
+	ZoneIds         []int64 `json:"zone_ids"`
+	CellFrom        string  `json:"cell_from"` // диапазон имен ячеек (включительно)
+	CellTo          string  `json:"cell_to"`
+	ProductIds      []int64 `json:"product_ids"`
+	ManufacturerIds []int64 `json:"manufacturer_ids"`
+	Lot             string  `json:"lot"` // партия, см. whs.WithLot
+}
+
+// StockQuery запрос остатков
+type StockQuery struct {
+	Filter StockFilter `json:"filter"`
+	Group  int         `json:"group"` // StockGroupCell, StockGroupProduct, StockGroupProductZone
+	Sort   string      `json:"sort"`  // StockSort*, по умолчанию StockSortProduct
+	Desc   bool        `json:"desc"`
+	Limit  int         `json:"limit"`  // 0 - без ограничения
+	Cursor string      `json:"cursor"` // NextCursor предыдущей страницы
+}
+
+// StockPage страница остатков
+type StockPage struct {
+	Rows       []RowStock `json:"rows"`
+	NextCursor string     `json:"next_cursor"` // пусто, если страница последняя
+}
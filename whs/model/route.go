@@ -0,0 +1,211 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// RouteStrategy стратегия обхода ячеек при отборе
+type RouteStrategy string
+
+const (
+	RouteSShape     RouteStrategy = "s-shape"     // сквозной проход проездов змейкой
+	RouteLargestGap RouteStrategy = "largest-gap" // вход в проезд с обеих сторон до наибольшего промежутка
+	RouteTSP        RouteStrategy = "tsp"         // ближайший сосед + 2-opt
+)
+
+// RouteStop остановка маршрута
+type RouteStop struct {
+	Cell     Cell    `json:"cell"`
+	Distance float64 `json:"distance"` // расстояние от предыдущей остановки (для первой - от входа)
+}
+
+// Route маршрут отбора от входа склада через ячейки к выходу
+type Route struct {
+	Strategy RouteStrategy `json:"strategy"`
+	Stops    []RouteStop   `json:"stops"`
+	Distance float64       `json:"distance"` // полная длина маршрута, включая путь до выхода
+}
+
+// Route упорядочивает ячейки cells по стратегии strategy и оценивает длину маршрута
+func (l *Layout) Route(cells []Cell, strategy RouteStrategy) (*Route, error) {
+	locs := make([]Location, len(cells)+2)
+	locs[0] = l.EntryLocation()
+	locs[len(locs)-1] = l.ExitLocation()
+	for i := range cells {
+		loc, err := l.Locate(&cells[i])
+		if err != nil {
+			return nil, err
+		}
+		locs[i+1] = loc
+	}
+	dist, err := l.DistanceMatrix(locs)
+	if err != nil {
+		return nil, err
+	}
+
+	var order []int // индексы cells в порядке обхода
+	switch strategy {
+	case RouteSShape:
+		order = l.sShapeOrder(locs[1 : len(locs)-1])
+	case RouteLargestGap:
+		order = l.largestGapOrder(locs[1 : len(locs)-1])
+	case RouteTSP:
+		order = tspOrder(dist)
+	default:
+		return nil, fmt.Errorf("unknown route strategy %q", strategy)
+	}
+
+	route := &Route{Strategy: strategy, Stops: make([]RouteStop, 0, len(order))}
+	prev := 0
+	for _, i := range order {
+		d := dist[prev][i+1]
+		route.Stops = append(route.Stops, RouteStop{Cell: cells[i], Distance: d})
+		route.Distance += d
+		prev = i + 1
+	}
+	route.Distance += dist[prev][len(locs)-1]
+	if math.IsInf(route.Distance, 1) {
+		return nil, ErrNoPath
+	}
+	return route, nil
+}
+
+// passageGroups группирует индексы положений по проездам, проезды упорядочены по X
+func (l *Layout) passageGroups(locs []Location) [][]int {
+	byPassage := make(map[int][]int)
+	passages := make([]int, 0)
+	for i, loc := range locs {
+		if _, ok := byPassage[loc.Passage]; !ok {
+			passages = append(passages, loc.Passage)
+		}
+		byPassage[loc.Passage] = append(byPassage[loc.Passage], i)
+	}
+	sort.Slice(passages, func(i, j int) bool {
+		pi, pj := l.Passages[passages[i]], l.Passages[passages[j]]
+		if pi.X != pj.X {
+			return pi.X < pj.X
+		}
+		return passages[i] < passages[j]
+	})
+	groups := make([][]int, len(passages))
+	for k, p := range passages {
+		idx := byPassage[p]
+		sort.SliceStable(idx, func(i, j int) bool { return locs[idx[i]].Y < locs[idx[j]].Y })
+		groups[k] = idx
+	}
+	return groups
+}
+
+func reversed(idx []int) []int {
+	r := make([]int, len(idx))
+	for i, v := range idx {
+		r[len(idx)-1-i] = v
+	}
+	return r
+}
+
+// sShapeOrder проезды проходятся насквозь, направление чередуется
+func (l *Layout) sShapeOrder(locs []Location) []int {
+	order := make([]int, 0, len(locs))
+	for k, group := range l.passageGroups(locs) {
+		if k%2 == 0 {
+			order = append(order, group...)
+		} else {
+			order = append(order, reversed(group)...)
+		}
+	}
+	return order
+}
+
+// largestGapOrder крайние проезды проходятся насквозь, в остальные отборщик заходит
+// по заднему поперечному проезду до наибольшего промежутка между остановками,
+// а на обратном пути - по переднему
+func (l *Layout) largestGapOrder(locs []Location) []int {
+	groups := l.passageGroups(locs)
+	if len(groups) < 2 {
+		return l.sShapeOrder(locs)
+	}
+	front := make([][]int, len(groups))
+	back := make([][]int, len(groups))
+	for k := 1; k < len(groups)-1; k++ {
+		group := groups[k]
+		p := l.Passages[locs[group[0]].Passage]
+		// промежуток i находится перед остановкой i, последний - после последней остановки
+		gapAt, gapLen := 0, locs[group[0]].Y-p.YStart
+		for i := 1; i <= len(group); i++ {
+			var gap float64
+			if i == len(group) {
+				gap = p.YEnd - locs[group[i-1]].Y
+			} else {
+				gap = locs[group[i]].Y - locs[group[i-1]].Y
+			}
+			if gap > gapLen {
+				gapAt, gapLen = i, gap
+			}
+		}
+		front[k], back[k] = group[:gapAt], group[gapAt:]
+	}
+
+	order := make([]int, 0, len(locs))
+	order = append(order, groups[0]...)
+	for k := 1; k < len(groups)-1; k++ {
+		order = append(order, reversed(back[k])...)
+	}
+	order = append(order, reversed(groups[len(groups)-1])...)
+	for k := len(groups) - 2; k >= 1; k-- {
+		order = append(order, front[k]...)
+	}
+	return order
+}
+
+// tspOrder эвристика коммивояжера по матрице расстояний: узел 0 - вход, последний - выход
+func tspOrder(dist [][]float64) []int {
+	n := len(dist) - 2
+	path := make([]int, 0, n+2)
+	path = append(path, 0)
+	visited := make([]bool, n+2)
+	for cur := 0; len(path) <= n; {
+		next := -1
+		for j := 1; j <= n; j++ {
+			if !visited[j] && (next < 0 || dist[cur][j] < dist[cur][next]) {
+				next = j
+			}
+		}
+		visited[next] = true
+		path = append(path, next)
+		cur = next
+	}
+	path = append(path, n+1)
+
+	// 2-opt: разворот отрезков, пока длина уменьшается (с учетом несимметричных расстояний)
+	length := func(p []int) float64 {
+		sum := 0.0
+		for i := 1; i < len(p); i++ {
+			sum += dist[p[i-1]][p[i]]
+		}
+		return sum
+	}
+	best := length(path)
+	for improved := true; improved; {
+		improved = false
+		for i := 1; i < len(path)-2; i++ {
+			for j := i + 1; j < len(path)-1; j++ {
+				candidate := make([]int, 0, len(path))
+				candidate = append(candidate, path[:i]...)
+				candidate = append(candidate, reversed(path[i:j+1])...)
+				candidate = append(candidate, path[j+1:]...)
+				if d := length(candidate); d < best-1e-9 {
+					path, best, improved = candidate, d, true
+				}
+			}
+		}
+	}
+
+	order := make([]int, n)
+	for i := 1; i <= n; i++ {
+		order[i-1] = path[i] - 1
+	}
+	return order
+}
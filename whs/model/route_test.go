@@ -0,0 +1,97 @@
+package model
+
+import (
+	"testing"
+)
+
+func routeCells(r *Route) []Cell {
+	cells := make([]Cell, len(r.Stops))
+	for i, s := range r.Stops {
+		cells[i] = s.Cell
+	}
+	return cells
+}
+
+func sameCells(got []Cell, want ...*Cell) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].PassageId != want[i].PassageId || got[i].RackId != want[i].RackId || got[i].Number != want[i].Number {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLayout_RouteSShape(t *testing.T) {
+	l := testLayout()
+	a, b, c, d := testCell(1, 1, 8), testCell(1, 1, 2), testCell(2, 1, 3), testCell(2, 1, 9)
+	r, err := l.Route([]Cell{*a, *c, *b, *d}, RouteSShape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameCells(routeCells(r), b, a, d, c) {
+		t.Errorf("S-shape order = %+v", routeCells(r))
+	}
+	// вход 2 + проезд 1 до 12.5 + конец и переход 7.5+5 + спуск до 7.5 (12.5) + выход 7.5+5+2
+	if want := 2 + 12.5 + 7.5 + 5 + 12.5 + 7.5 + 5 + 2; r.Distance != want {
+		t.Errorf("S-shape distance = %v, want %v", r.Distance, want)
+	}
+}
+
+func TestLayout_RouteLargestGap(t *testing.T) {
+	l := testLayout()
+	first, last := testCell(1, 1, 5), testCell(3, 1, 5)
+	low, high := testCell(2, 1, 1), testCell(2, 1, 10)
+	r, err := l.Route([]Cell{*low, *last, *high, *first}, RouteLargestGap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameCells(routeCells(r), first, high, last, low) {
+		t.Errorf("largest gap order = %+v", routeCells(r))
+	}
+}
+
+func TestLayout_RouteTSP(t *testing.T) {
+	l := testLayout()
+	cells := []Cell{
+		*testCell(3, 1, 1), *testCell(1, 2, 4), *testCell(2, 1, 9), *testCell(1, 1, 1),
+		*testCell(3, 2, 7), *testCell(2, 2, 2), *testCell(1, 1, 6),
+	}
+	tsp, err := l.Route(cells, RouteTSP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tsp.Stops) != len(cells) {
+		t.Fatalf("TSP route has %d stops, want %d", len(tsp.Stops), len(cells))
+	}
+	sum := 0.0
+	for _, s := range tsp.Stops {
+		sum += s.Distance
+	}
+	if sum > tsp.Distance {
+		t.Errorf("stops distance %v exceeds route distance %v", sum, tsp.Distance)
+	}
+	for _, strategy := range []RouteStrategy{RouteSShape, RouteLargestGap} {
+		r, err := l.Route(cells, strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tsp.Distance > r.Distance {
+			t.Errorf("TSP distance %v is worse than %s distance %v", tsp.Distance, strategy, r.Distance)
+		}
+	}
+	again, _ := l.Route(cells, RouteTSP)
+	if !sameCells(routeCells(again), testCellsPtr(routeCells(tsp))...) {
+		t.Errorf("TSP route is not deterministic")
+	}
+}
+
+func testCellsPtr(cells []Cell) []*Cell {
+	ptrs := make([]*Cell, len(cells))
+	for i := range cells {
+		ptrs[i] = &cells[i]
+	}
+	return ptrs
+}
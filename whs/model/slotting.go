@@ -0,0 +1,122 @@
+package model
+
+import (
+	"errors"
+	"sort"
+)
+
+// SlottingOptions параметры анализа размещения
+type SlottingOptions struct {
+	GoldenFloorMin int     `json:"golden_floor_min"` // эргономичные этажи (удобный отбор)
+	GoldenFloorMax int     `json:"golden_floor_max"`
+	FloorPenalty   float64 `json:"floor_penalty"` // штраф (м) за каждый этаж вне эргономичных
+	ShareA         float64 `json:"share_a"`       // доля отборов класса A
+	ShareB         float64 `json:"share_b"`       // доля отборов класса B
+}
+
+// DefaultSlottingOptions параметры анализа размещения по умолчанию
+var DefaultSlottingOptions = SlottingOptions{GoldenFloorMin: 1, GoldenFloorMax: 2, FloorPenalty: 5, ShareA: 0.8, ShareB: 0.15}
+
+// SlottingItem текущее размещение продукта
+type SlottingItem struct {
+	ProductId int64   `json:"product_id"`
+	Picks     int     `json:"picks"` // количество отборов за период
+	Class     string  `json:"class"` // класс ABC по количеству отборов
+	Cell      Cell    `json:"cell"`  // основная ячейка хранения
+	Quantity  int     `json:"quantity"`
+	Cost      float64 `json:"cost"` // стоимость одного отбора: расстояние до зоны отгрузки и штраф за этаж
+}
+
+// SlottingMove перемещение продукта в рамках переразмещения
+type SlottingMove struct {
+	ProductId int64   `json:"product_id"`
+	CellSrc   Cell    `json:"cell_src"`
+	CellDst   Cell    `json:"cell_dst"`
+	Quantity  int     `json:"quantity"`
+	Saving    float64 `json:"saving"` // ожидаемое сокращение пути (м) за период
+}
+
+// SlottingPlan результат анализа размещения
+type SlottingPlan struct {
+	Items  []SlottingItem `json:"items"`
+	Moves  []SlottingMove `json:"moves"`
+	Saving float64        `json:"saving"`
+}
+
+// floorPenalty штраф за неудобный этаж
+func (o *SlottingOptions) floorPenalty(floor int) float64 {
+	switch {
+	case floor < o.GoldenFloorMin:
+		return float64(o.GoldenFloorMin-floor) * o.FloorPenalty
+	case floor > o.GoldenFloorMax:
+		return float64(floor-o.GoldenFloorMax) * o.FloorPenalty
+	}
+	return 0
+}
+
+// PlanSlotting оценивает размещение продуктов по частоте отборов picks и предлагает
+// переразмещение: самые часто отбираемые продукты - в ячейки с наименьшей стоимостью отбора.
+// Основной ячейкой продукта считается ячейка с наибольшим остатком; ячейки вне планировки не участвуют
+func PlanSlotting(layout *Layout, picks map[int64]int, stock []CellStock, opts SlottingOptions) (*SlottingPlan, error) {
+	primary := make(map[int64]CellStock)
+	for _, st := range stock {
+		if st.Quantity <= 0 {
+			continue
+		}
+		if cur, ok := primary[st.ProductId]; !ok || st.Quantity > cur.Quantity {
+			primary[st.ProductId] = st
+		}
+	}
+	values := make(map[int64]float64)
+	items := make([]SlottingItem, 0, len(primary))
+	exit := layout.ExitLocation()
+	for productId, st := range primary {
+		loc, err := layout.Locate(&st.Cell)
+		if err != nil {
+			if errors.Is(err, ErrCellNotInLayout) {
+				continue
+			}
+			return nil, err
+		}
+		d, err := layout.LocationDistance(loc, exit)
+		if err != nil {
+			return nil, err
+		}
+		values[productId] = float64(picks[productId])
+		items = append(items, SlottingItem{
+			ProductId: productId, Picks: picks[productId], Cell: st.Cell, Quantity: st.Quantity,
+			Cost: d + opts.floorPenalty(st.Cell.Floor),
+		})
+	}
+	classes := ClassifyABC(values, opts.ShareA, opts.ShareB)
+	for i := range items {
+		items[i].Class = classes[items[i].ProductId]
+	}
+
+	// продукты по убыванию частоты, ячейки по возрастанию стоимости
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Picks != items[j].Picks {
+			return items[i].Picks > items[j].Picks
+		}
+		return items[i].ProductId < items[j].ProductId
+	})
+	slots := append([]SlottingItem(nil), items...)
+	sort.SliceStable(slots, func(i, j int) bool {
+		if slots[i].Cost != slots[j].Cost {
+			return slots[i].Cost < slots[j].Cost
+		}
+		return slots[i].Cell.Id < slots[j].Cell.Id
+	})
+
+	plan := &SlottingPlan{Items: items, Moves: make([]SlottingMove, 0)}
+	for i, it := range items {
+		dst := slots[i]
+		if dst.Cell.Id == it.Cell.Id {
+			continue
+		}
+		saving := float64(it.Picks) * (it.Cost - dst.Cost)
+		plan.Moves = append(plan.Moves, SlottingMove{ProductId: it.ProductId, CellSrc: it.Cell, CellDst: dst.Cell, Quantity: it.Quantity, Saving: saving})
+		plan.Saving += saving
+	}
+	return plan, nil
+}
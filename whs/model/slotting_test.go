@@ -0,0 +1,49 @@
+package model
+
+import "testing"
+
+func TestClassifyABC(t *testing.T) {
+	got := ClassifyABC(map[int64]float64{1: 70, 2: 20, 3: 6, 4: 4, 5: 0}, 0.8, 0.15)
+	want := map[int64]string{1: ClassA, 2: ClassA, 3: ClassB, 4: ClassC, 5: ClassC}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("class of %d = %s, want %s", k, got[k], v)
+		}
+	}
+}
+
+func TestPlanSlotting(t *testing.T) {
+	l := testLayout()
+	near := *testCell(3, 1, 1) // рядом с выходом
+	far := *testCell(1, 1, 10)
+	high := *testCell(3, 1, 2)
+	high.Floor = 5
+	stock := []CellStock{
+		{Cell: far, ProductId: 1, Quantity: 10},
+		{Cell: near, ProductId: 2, Quantity: 10},
+		{Cell: high, ProductId: 3, Quantity: 10},
+	}
+	for i := range stock {
+		stock[i].Cell.Id = int64(i + 1)
+		if stock[i].Cell.Floor == 0 {
+			stock[i].Cell.Floor = 1
+		}
+	}
+	plan, err := PlanSlotting(l, map[int64]int{1: 100, 2: 1, 3: 10}, stock, DefaultSlottingOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Items) != 3 || plan.Items[0].ProductId != 1 || plan.Items[0].Class != ClassA {
+		t.Fatalf("items = %+v", plan.Items)
+	}
+	if plan.Saving <= 0 {
+		t.Errorf("saving = %v, want positive", plan.Saving)
+	}
+	dst := map[int64]int64{}
+	for _, m := range plan.Moves {
+		dst[m.ProductId] = m.CellDst.Id
+	}
+	if dst[1] != 2 {
+		t.Errorf("fast mover must move to the nearest cell, moves = %+v", plan.Moves)
+	}
+}
@@ -0,0 +1,99 @@
+package model
+
+import "sort"
+
+// CellStock остаток продукта в ячейке
+type CellStock struct {
+	Cell      Cell  `json:"cell"`
+	ProductId int64 `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+}
+
+// StockAllocation количество продукта, отбираемое из ячейки
+type StockAllocation struct {
+	Cell      Cell  `json:"cell"`
+	ProductId int64 `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+}
+
+// StockPool остатки, из которых последовательно резервируется отбор
+type StockPool struct {
+	byProduct map[int64][]*CellStock
+}
+
+// NewStockPool создает пул из остатков. Ячейки, запрещенные к отбору, и служебные не используются.
+// Отбор идет сначала с нижних этажей, затем из ячеек с меньшим остатком (освобождение ячеек)
+func NewStockPool(stock []CellStock) *StockPool {
+	return newStockPool(stock, 1)
+}
+
+// NewReservePool создает пул резерва: в отличие от NewStockPool отбор идет сначала с верхних этажей
+func NewReservePool(stock []CellStock) *StockPool {
+	return newStockPool(stock, -1)
+}
+
+func newStockPool(stock []CellStock, floorOrder int) *StockPool {
+	p := &StockPool{byProduct: make(map[int64][]*CellStock)}
+	for i := range stock {
+		st := stock[i]
+		if st.Quantity <= 0 || st.Cell.NotAllowedOut || st.Cell.IsService {
+			continue
+		}
+		p.byProduct[st.ProductId] = append(p.byProduct[st.ProductId], &st)
+	}
+	for _, items := range p.byProduct {
+		sort.SliceStable(items, func(i, j int) bool {
+			if items[i].Cell.Floor != items[j].Cell.Floor {
+				return floorOrder*items[i].Cell.Floor < floorOrder*items[j].Cell.Floor
+			}
+			if items[i].Quantity != items[j].Quantity {
+				return items[i].Quantity < items[j].Quantity
+			}
+			return items[i].Cell.Id < items[j].Cell.Id
+		})
+	}
+	return p
+}
+
+// Allocate резервирует quantity продукта productId. Возвращает распределение по ячейкам
+// и количество, которое зарезервировать не удалось
+func (p *StockPool) Allocate(productId int64, quantity int) ([]StockAllocation, int) {
+	allocs := make([]StockAllocation, 0)
+	for _, st := range p.byProduct[productId] {
+		if quantity == 0 {
+			break
+		}
+		if st.Quantity == 0 {
+			continue
+		}
+		q := quantity
+		if st.Quantity < q {
+			q = st.Quantity
+		}
+		st.Quantity -= q
+		quantity -= q
+		allocs = append(allocs, StockAllocation{Cell: st.Cell, ProductId: productId, Quantity: q})
+	}
+	return allocs, quantity
+}
+
+// Exclude исключает из пула количество, уже зарезервированное allocs (например, открытыми волнами)
+func (p *StockPool) Exclude(allocs []StockAllocation) {
+	for _, a := range allocs {
+		q := a.Quantity
+		for _, st := range p.byProduct[a.ProductId] {
+			if q == 0 {
+				break
+			}
+			if st.Cell.Id != a.Cell.Id {
+				continue
+			}
+			n := q
+			if st.Quantity < n {
+				n = st.Quantity
+			}
+			st.Quantity -= n
+			q -= n
+		}
+	}
+}
@@ -1,6 +1,19 @@
 package model
 
+import "time"
+
 type User struct {
-	Id   int64  `json:"id"`
-	Name string `json:"name"`
+	Id         int64      `json:"id"`
+	Name       string     `json:"name"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"` // время архивации, nil - действующий пользователь
+	Version    int64      `json:"version"`               // версия записи, см. UpdateUser
+}
+
+// Actor пользователь, выполняющий операцию, и терминал (устройство), с которого она выполняется
+type Actor struct {
+	User     User   `json:"user"`
+	Terminal string `json:"terminal"` // идентификатор терминала, не более MaxTerminalLen байт
 }
+
+// MaxTerminalLen максимальная длина идентификатора терминала
+const MaxTerminalLen = 64
@@ -0,0 +1,296 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Группировка заказов в волны
+const (
+	WaveByCutOff     = iota // перевозчик и время отсечки
+	WaveByZone              // зона хранения большинства строк заказа
+	WaveBySkuOverlap        // пересечение ассортимента
+)
+
+// Статусы волны
+const (
+	WaveStatusPlanned   = iota // сформирована
+	WaveStatusReleased         // выдана в работу
+	WaveStatusPicking          // идет отбор
+	WaveStatusSorting          // идет сортировка по заказам (put-wall)
+	WaveStatusCompleted        // завершена
+	WaveStatusCancelled        // отменена
+)
+
+// waveTransitions допустимые переходы статусов волны
+var waveTransitions = map[int][]int{
+	WaveStatusPlanned:  {WaveStatusReleased, WaveStatusCancelled},
+	WaveStatusReleased: {WaveStatusPicking, WaveStatusCancelled},
+	WaveStatusPicking:  {WaveStatusSorting, WaveStatusCancelled},
+	WaveStatusSorting:  {WaveStatusCompleted},
+}
+
+// CanChangeWaveStatus проверяет допустимость перехода волны из статуса from в статус to
+func CanChangeWaveStatus(from, to int) bool {
+	for _, s := range waveTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OutboundOrder заказ на отгрузку
+type OutboundOrder struct {
+	Id      int64      `json:"id"`
+	Number  string     `json:"number"`
+	Carrier string     `json:"carrier"`
+	CutOff  time.Time  `json:"cut_off"` // время отсечки перевозчика
+	Rows    []OrderRow `json:"rows"`
+}
+
+// OrderRow строка заказа
+type OrderRow struct {
+	Product  Product `json:"product"`
+	Quantity int     `json:"quantity"`
+}
+
+// WaveOptions параметры планирования волн
+type WaveOptions struct {
+	Grouping     int             `json:"grouping"`      // WaveByCutOff, WaveByZone, WaveBySkuOverlap
+	MaxOrders    int             `json:"max_orders"`    // заказов в волне, 0 - без ограничения
+	Pickers      int             `json:"pickers"`       // отборщиков (пакетов отбора) на волну
+	ProductZones map[int64]int64 `json:"product_zones"` // зона хранения продукта (для WaveByZone)
+}
+
+// Wave волна отбора
+type Wave struct {
+	Id        int64           `json:"id"`
+	WhsId     int64           `json:"whs_id"`
+	Status    int             `json:"status"`
+	Orders    []OutboundOrder `json:"orders"`
+	Batches   []PickBatch     `json:"batches"`
+	Shortages []OrderRow      `json:"shortages"` // не обеспеченное остатками количество
+	UserId    int64           `json:"user_id"`   // пользователь, спланировавший волну
+	Terminal  string          `json:"terminal"`  // терминал, с которого спланирована волна
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	// пользователь и терминал последнего изменения статуса (SetWaveStatus)
+	StatusUserId   int64  `json:"status_user_id"`
+	StatusTerminal string `json:"status_terminal"`
+}
+
+// HoldsStock сообщает, резервирует ли волна остатки листов отбора: волна не завершена и не отменена
+// Отобранное количество строк в волне не учитывается, поэтому волна в отборе и сортировке резервирует
+// листы отбора целиком, пока не будет завершена (отобранное и списанное из ячеек не распределяется повторно)
+func (w *Wave) HoldsStock() bool {
+	return w.Status != WaveStatusCompleted && w.Status != WaveStatusCancelled
+}
+
+// Allocations количество, резервируемое листами отбора волны, по ячейкам
+func (w *Wave) Allocations() []StockAllocation {
+	allocs := make([]StockAllocation, 0)
+	for _, b := range w.Batches {
+		for _, l := range b.Lines {
+			allocs = append(allocs, StockAllocation{Cell: l.Cell, ProductId: l.ProductId, Quantity: l.Quantity})
+		}
+	}
+	return allocs
+}
+
+// PickBatch сводный лист отбора одного отборщика по нескольким заказам
+type PickBatch struct {
+	Picker  int           `json:"picker"` // номер отборщика в волне
+	UserId  int64         `json:"user_id"`
+	Lines   []PickLine    `json:"lines"`
+	PutWall []PutWallSlot `json:"put_wall"`
+}
+
+// PickLine строка сводного листа отбора
+type PickLine struct {
+	Cell      Cell  `json:"cell"`
+	ProductId int64 `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+}
+
+// PutWallSlot ячейка стены сортировки, закрепленная за заказом
+type PutWallSlot struct {
+	Slot    int        `json:"slot"`
+	OrderId int64      `json:"order_id"`
+	Rows    []OrderRow `json:"rows"`
+}
+
+// PlanWaves группирует заказы в волны (без формирования листов отбора)
+func PlanWaves(orders []OutboundOrder, opts WaveOptions) ([]Wave, error) {
+	var groups [][]OutboundOrder
+	switch opts.Grouping {
+	case WaveByCutOff:
+		groups = groupOrders(orders, func(o *OutboundOrder) string {
+			return o.Carrier + "|" + o.CutOff.UTC().Format(time.RFC3339)
+		})
+	case WaveByZone:
+		groups = groupOrders(orders, func(o *OutboundOrder) string {
+			return fmt.Sprint(orderZone(o, opts.ProductZones))
+		})
+	case WaveBySkuOverlap:
+		groups = groupBySkuOverlap(orders, opts.MaxOrders)
+	default:
+		return nil, fmt.Errorf("unknown wave grouping %d", opts.Grouping)
+	}
+
+	waves := make([]Wave, 0, len(groups))
+	for _, g := range groups {
+		for len(g) > 0 {
+			n := len(g)
+			if opts.MaxOrders > 0 && n > opts.MaxOrders {
+				n = opts.MaxOrders
+			}
+			waves = append(waves, Wave{Status: WaveStatusPlanned, Orders: g[:n]})
+			g = g[n:]
+		}
+	}
+	return waves, nil
+}
+
+// groupOrders группирует заказы по ключу, группы упорядочены по ранней отсечке
+func groupOrders(orders []OutboundOrder, key func(o *OutboundOrder) string) [][]OutboundOrder {
+	sorted := sortedOrders(orders)
+	idx := make(map[string]int)
+	groups := make([][]OutboundOrder, 0)
+	for _, o := range sorted {
+		k := key(&o)
+		i, ok := idx[k]
+		if !ok {
+			i = len(groups)
+			idx[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], o)
+	}
+	return groups
+}
+
+func sortedOrders(orders []OutboundOrder) []OutboundOrder {
+	sorted := append([]OutboundOrder(nil), orders...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].CutOff.Equal(sorted[j].CutOff) {
+			return sorted[i].CutOff.Before(sorted[j].CutOff)
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+	return sorted
+}
+
+// orderZone зона, в которой хранится большинство строк заказа
+func orderZone(o *OutboundOrder, zones map[int64]int64) int64 {
+	count := make(map[int64]int)
+	best := int64(0)
+	for _, r := range o.Rows {
+		z := zones[r.Product.Id]
+		count[z]++
+		if count[z] > count[best] || (count[z] == count[best] && z < best) {
+			best = z
+		}
+	}
+	return best
+}
+
+// groupBySkuOverlap жадно набирает к заказу-основе заказы с наибольшей долей общего ассортимента
+func groupBySkuOverlap(orders []OutboundOrder, maxOrders int) [][]OutboundOrder {
+	rest := sortedOrders(orders)
+	groups := make([][]OutboundOrder, 0)
+	for len(rest) > 0 {
+		group := []OutboundOrder{rest[0]}
+		skus := make(map[int64]bool)
+		for _, r := range rest[0].Rows {
+			skus[r.Product.Id] = true
+		}
+		rest = rest[1:]
+		for len(rest) > 0 && (maxOrders <= 0 || len(group) < maxOrders) {
+			best, bestScore := -1, 0.0
+			for i, o := range rest {
+				common := 0
+				for _, r := range o.Rows {
+					if skus[r.Product.Id] {
+						common++
+					}
+				}
+				if len(o.Rows) == 0 || common == 0 {
+					continue
+				}
+				if score := float64(common) / float64(len(o.Rows)); score > bestScore {
+					best, bestScore = i, score
+				}
+			}
+			if best < 0 {
+				break
+			}
+			group = append(group, rest[best])
+			for _, r := range rest[best].Rows {
+				skus[r.Product.Id] = true
+			}
+			rest = append(rest[:best], rest[best+1:]...)
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// Batch распределяет заказы волны между pickers отборщиками и формирует сводные листы
+// отбора из остатков pool и план сортировки по заказам. Недостача попадает в Shortages
+func (w *Wave) Batch(pool *StockPool, pickers int) {
+	if pickers <= 0 {
+		pickers = 1
+	}
+	if pickers > len(w.Orders) {
+		pickers = len(w.Orders)
+	}
+	// заказы с наибольшим числом строк - отборщику с наименьшей загрузкой
+	orders := append([]OutboundOrder(nil), w.Orders...)
+	sort.SliceStable(orders, func(i, j int) bool { return len(orders[i].Rows) > len(orders[j].Rows) })
+	assigned := make([][]OutboundOrder, pickers)
+	load := make([]int, pickers)
+	for _, o := range orders {
+		p := 0
+		for i := range load {
+			if load[i] < load[p] {
+				p = i
+			}
+		}
+		assigned[p] = append(assigned[p], o)
+		load[p] += len(o.Rows)
+	}
+
+	w.Batches = make([]PickBatch, 0, pickers)
+	w.Shortages = make([]OrderRow, 0)
+	slot := 0
+	for p, batchOrders := range assigned {
+		batch := PickBatch{Picker: p + 1, Lines: make([]PickLine, 0), PutWall: make([]PutWallSlot, 0)}
+		products := make([]int64, 0)
+		total := make(map[int64]int)
+		names := make(map[int64]Product)
+		for _, o := range batchOrders {
+			slot++
+			batch.PutWall = append(batch.PutWall, PutWallSlot{Slot: slot, OrderId: o.Id, Rows: o.Rows})
+			for _, r := range o.Rows {
+				if _, ok := total[r.Product.Id]; !ok {
+					products = append(products, r.Product.Id)
+					names[r.Product.Id] = r.Product
+				}
+				total[r.Product.Id] += r.Quantity
+			}
+		}
+		for _, productId := range products {
+			allocs, short := pool.Allocate(productId, total[productId])
+			for _, a := range allocs {
+				batch.Lines = append(batch.Lines, PickLine{Cell: a.Cell, ProductId: productId, Quantity: a.Quantity})
+			}
+			if short > 0 {
+				w.Shortages = append(w.Shortages, OrderRow{Product: names[productId], Quantity: short})
+			}
+		}
+		sort.SliceStable(batch.Lines, func(i, j int) bool { return batch.Lines[i].Cell.Name < batch.Lines[j].Cell.Name })
+		w.Batches = append(w.Batches, batch)
+	}
+}
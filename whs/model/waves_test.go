@@ -0,0 +1,149 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func testOrder(id int64, carrier string, cutOff time.Time, products ...int64) OutboundOrder {
+	o := OutboundOrder{Id: id, Carrier: carrier, CutOff: cutOff}
+	for _, p := range products {
+		o.Rows = append(o.Rows, OrderRow{Product: Product{Id: p}, Quantity: 1})
+	}
+	return o
+}
+
+func waveOrderIds(w Wave) []int64 {
+	ids := make([]int64, len(w.Orders))
+	for i, o := range w.Orders {
+		ids[i] = o.Id
+	}
+	return ids
+}
+
+func TestPlanWaves(t *testing.T) {
+	morning := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	evening := morning.Add(8 * time.Hour)
+	orders := []OutboundOrder{
+		testOrder(1, "cdek", evening, 1, 2),
+		testOrder(2, "post", morning, 3),
+		testOrder(3, "cdek", evening, 3, 4),
+		testOrder(4, "post", morning, 1, 2),
+		testOrder(5, "cdek", evening, 5),
+	}
+	tests := []struct {
+		name string
+		opts WaveOptions
+		want [][]int64
+	}{
+		{"cut-off", WaveOptions{Grouping: WaveByCutOff}, [][]int64{{2, 4}, {1, 3, 5}}},
+		{"cut-off limited", WaveOptions{Grouping: WaveByCutOff, MaxOrders: 2}, [][]int64{{2, 4}, {1, 3}, {5}}},
+		{"zone", WaveOptions{Grouping: WaveByZone, ProductZones: map[int64]int64{1: 7, 2: 7, 3: 8, 4: 8, 5: 8}}, [][]int64{{2, 3, 5}, {4, 1}}},
+		{"sku overlap", WaveOptions{Grouping: WaveBySkuOverlap}, [][]int64{{2, 3}, {4, 1}, {5}}},
+	}
+	for _, tt := range tests {
+		waves, err := PlanWaves(orders, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(waves) != len(tt.want) {
+			t.Errorf("%s: got %d waves, want %d", tt.name, len(waves), len(tt.want))
+			continue
+		}
+		for i, w := range waves {
+			got := waveOrderIds(w)
+			if len(got) != len(tt.want[i]) {
+				t.Errorf("%s: wave %d = %v, want %v", tt.name, i, got, tt.want[i])
+				continue
+			}
+			for j := range got {
+				if got[j] != tt.want[i][j] {
+					t.Errorf("%s: wave %d = %v, want %v", tt.name, i, got, tt.want[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestWave_Batch(t *testing.T) {
+	w := Wave{Orders: []OutboundOrder{
+		testOrder(1, "", time.Time{}, 1, 2),
+		testOrder(2, "", time.Time{}, 1),
+		testOrder(3, "", time.Time{}, 2, 3),
+	}}
+	pool := NewStockPool([]CellStock{
+		{Cell: Cell{Id: 10, Name: "A", CellAddr: CellAddr{Floor: 1}}, ProductId: 1, Quantity: 1},
+		{Cell: Cell{Id: 11, Name: "B", CellAddr: CellAddr{Floor: 3}}, ProductId: 1, Quantity: 5},
+		{Cell: Cell{Id: 12, Name: "C", IsService: true}, ProductId: 2, Quantity: 5},
+		{Cell: Cell{Id: 13, Name: "D"}, ProductId: 2, Quantity: 1},
+	})
+	w.Batch(pool, 2)
+
+	if len(w.Batches) != 2 {
+		t.Fatalf("got %d batches, want 2", len(w.Batches))
+	}
+	slots, picked := 0, 0
+	for _, b := range w.Batches {
+		slots += len(b.PutWall)
+		for _, l := range b.Lines {
+			if l.Cell.IsService {
+				t.Errorf("line picks from service cell %d", l.Cell.Id)
+			}
+			picked += l.Quantity
+		}
+	}
+	if slots != 3 {
+		t.Errorf("put-wall has %d slots, want 3", slots)
+	}
+	if picked != 3 {
+		t.Errorf("picked %d, want 3", picked)
+	}
+	// продукт 2 заказан дважды, доступен 1 (служебная ячейка не используется), продукта 3 нет
+	short := map[int64]int{}
+	for _, r := range w.Shortages {
+		short[r.Product.Id] += r.Quantity
+	}
+	if short[2] != 1 || short[3] != 1 || len(short) != 2 {
+		t.Errorf("shortages = %v", short)
+	}
+}
+
+func TestStockPool_Exclude(t *testing.T) {
+	stock := []CellStock{
+		{Cell: Cell{Id: 10}, ProductId: 1, Quantity: 4},
+		{Cell: Cell{Id: 11}, ProductId: 1, Quantity: 5},
+	}
+	planned := Wave{Orders: []OutboundOrder{testOrder(1, "", time.Time{}, 1)}}
+	planned.Batch(NewStockPool(stock), 1)
+
+	// второе планирование не получает остаток, зарезервированный первой волной
+	pool := NewStockPool(stock)
+	pool.Exclude(planned.Allocations())
+	allocs, short := pool.Allocate(1, 9)
+	got := 0
+	for _, a := range allocs {
+		got += a.Quantity
+	}
+	if got != 8 || short != 1 {
+		t.Errorf("allocated %d, short %d, want 8, 1", got, short)
+	}
+}
+
+func TestCanChangeWaveStatus(t *testing.T) {
+	if !CanChangeWaveStatus(WaveStatusPlanned, WaveStatusReleased) {
+		t.Error("planned -> released must be allowed")
+	}
+	if CanChangeWaveStatus(WaveStatusCompleted, WaveStatusPicking) {
+		t.Error("completed -> picking must not be allowed")
+	}
+}
+
+func TestWaveHoldsStock(t *testing.T) {
+	for status, want := range map[int]bool{WaveStatusPlanned: true, WaveStatusReleased: true, WaveStatusPicking: true,
+		WaveStatusSorting: true, WaveStatusCompleted: false, WaveStatusCancelled: false} {
+		if w := (Wave{Status: status}); w.HoldsStock() != want {
+			t.Errorf("HoldsStock of status %d = %v, want %v", status, !want, want)
+		}
+	}
+}
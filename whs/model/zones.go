@@ -1,5 +1,13 @@
 package model
 
+// Типы зон
+const (
+	ZoneTypeStorage    = iota // хранение
+	ZoneTypeAcceptance        // приемка
+	ZoneTypeShipping          // отгрузка
+	ZoneTypeCustom            // прочие
+)
+
 type Zone struct {
 	Id      int64  `json:"id"`
 	Name    string `json:"name"`
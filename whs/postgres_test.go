@@ -0,0 +1,52 @@
+package whs_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/mlplabs/mwms-core/whs"
+	"github.com/mlplabs/mwms-core/whs/repotest"
+	"os"
+	"sync"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+var (
+	pgOnce sync.Once
+	pgWms  *whs.Wms
+	pgErr  error
+)
+
+// openPostgres возвращает Wms тестовой базы PostgreSQL, общий для всех тестов пакета
+// Строка подключения к тестовой базе задается переменной окружения MWMS_TEST_POSTGRES_DSN
+func openPostgres(t *testing.T) *whs.Wms {
+	dsn := os.Getenv("MWMS_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("MWMS_TEST_POSTGRES_DSN is not set")
+	}
+	pgOnce.Do(func() {
+		var db *sql.DB
+		if db, pgErr = sql.Open("postgres", dsn); pgErr != nil {
+			return
+		}
+		pgWms = whs.NewWms(db)
+		pgErr = pgWms.Migrate(context.Background())
+	})
+	if pgErr != nil {
+		t.Fatal(pgErr)
+	}
+	return pgWms
+}
+
+// TestPostgresConformance прогоняет общий набор тестов хранилища на PostgreSQL
+func TestPostgresConformance(t *testing.T) {
+	w := openPostgres(t)
+	repotest.Run(t, func(t *testing.T) whs.Repository { return whs.NewStorage(w) })
+}
+
+// TestPostgresStorage прогоняет тесты возможностей Storage на PostgreSQL
+func TestPostgresStorage(t *testing.T) {
+	openPostgres(t)
+	repotest.RunStorage(t, openPostgres)
+}
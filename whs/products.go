@@ -2,9 +2,8 @@ package whs
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"github.com/lib/pq"
+	"github.com/mlplabs/mwms-core/core"
 	"github.com/mlplabs/mwms-core/whs/model"
 )
 
@@ -12,12 +11,13 @@ import (
 func (s *Storage) GetProducts(ctx context.Context) ([]model.Product, error) {
 	items := make([]model.Product, 0)
 	sqlSel := `SELECT 
-    				p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name 
+    				p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name, p.weight, p.volume, p.version 
 				FROM products p
 				LEFT JOIN manufacturers m ON p.manufacturer_id = m.id
+				WHERE p.archived_at IS NULL
 				ORDER BY p.name ASC`
 
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel)
+	rows, err := s.db().QueryContext(ctx, sqlSel)
 	if err != nil {
 		return items, err
 	}
@@ -25,7 +25,7 @@ func (s *Storage) GetProducts(ctx context.Context) ([]model.Product, error) {
 
 	for rows.Next() {
 		item := model.Product{Manufacturer: model.Manufacturer{}}
-		err = rows.Scan(&item.Id, &item.Name, &item.ItemNumber, &item.Manufacturer.Id, &item.Manufacturer.Name)
+		err = rows.Scan(&item.Id, &item.Name, &item.ItemNumber, &item.Manufacturer.Id, &item.Manufacturer.Name, &item.Weight, &item.Volume, &item.Version)
 		items = append(items, item)
 	}
 	return items, nil
@@ -36,24 +36,26 @@ func (s *Storage) GetProductsItems(ctx context.Context, offset int, limit int, s
 	var totalCount int64
 	var sqlCond string
 	items := make([]model.Product, 0)
+	args := make([]any, 0)
 	if search != "" {
-		sqlCond = "WHERE p.name ILIKE '%" + search + "%' OR m.name ILIKE '" + search + "%' OR item_number ILIKE '" + search + "%'"
+		sqlCond = " AND (" + s.wms.ilike("p.name", "$1") + " OR " + s.wms.ilike("m.name", "$2") +
+			" OR " + s.wms.ilike("item_number", "$2") + ")"
+		args = append(args, "%"+search+"%", search+"%")
 	}
-	args := make([]any, 0)
 
 	if limit == 0 {
 		limit = DefaultRowsLimit
 	}
-	args = append(args, limit)
-	args = append(args, offset)
-	query := "SELECT p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name " +
+	query := "SELECT p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name, p.weight, p.volume, p.version " +
 		"	FROM products p " +
 		"   LEFT JOIN manufacturers m ON p.manufacturer_id = m.id" +
-		"   %s " +
+		"   WHERE p.archived_at IS NULL%s " +
 		"	ORDER BY p.name ASC"
 	sqlSel := fmt.Sprintf(query, sqlCond)
 
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel+" LIMIT $1 OFFSET $2", args...)
+	sqlPage := fmt.Sprintf("%s LIMIT $%d OFFSET $%d", sqlSel, len(args)+1, len(args)+2)
+
+	rows, err := s.db().QueryContext(ctx, sqlPage, append(args, limit, offset)...)
 	if err != nil {
 		return items, totalCount, err
 	}
@@ -61,12 +63,12 @@ func (s *Storage) GetProductsItems(ctx context.Context, offset int, limit int, s
 
 	for rows.Next() {
 		item := model.Product{Manufacturer: model.Manufacturer{}}
-		err = rows.Scan(&item.Id, &item.Name, &item.ItemNumber, &item.Manufacturer.Id, &item.Manufacturer.Name)
+		err = rows.Scan(&item.Id, &item.Name, &item.ItemNumber, &item.Manufacturer.Id, &item.Manufacturer.Name, &item.Weight, &item.Volume, &item.Version)
 		items = append(items, item)
 	}
 
 	sqlCount := fmt.Sprintf("SELECT COUNT(*) as count FROM ( %s ) sub", sqlSel)
-	err = s.wms.Db.QueryRowContext(ctx, sqlCount).Scan(&totalCount)
+	err = s.db().QueryRowContext(ctx, sqlCount, args...).Scan(&totalCount)
 	if err != nil {
 		return items, totalCount, err
 	}
@@ -74,70 +76,71 @@ func (s *Storage) GetProductsItems(ctx context.Context, offset int, limit int, s
 }
 
 func (s *Storage) CreateProduct(ctx context.Context, product *model.Product) (int64, error) {
+	return s.created(ctx, model.EntityProduct, product, func(s *Storage) (int64, error) {
+		return s.createProduct(ctx, product)
+	})
+}
+
+func (s *Storage) createProduct(ctx context.Context, product *model.Product) (int64, error) {
 	var insertId int64
-	sqlCreate := `INSERT INTO products (name, item_number, manufacturer_id) VALUES ($1, $2, $3) RETURNING id`
-	err := s.wms.Db.QueryRowContext(ctx, sqlCreate, product.Name, product.ItemNumber, product.Manufacturer.Id).Scan(&insertId)
+	sqlCreate := `INSERT INTO products (name, item_number, manufacturer_id, weight, volume) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	err := s.db().QueryRowContext(ctx, sqlCreate, product.Name, product.ItemNumber, product.Manufacturer.Id, product.Weight, product.Volume).Scan(&insertId)
 	return insertId, err
 }
 
 func (s *Storage) UpdateProduct(ctx context.Context, product *model.Product) (int64, error) {
-	sqlUpd := `UPDATE products SET name=$2, item_number=$3, manufacturer_id=$4 WHERE id=$1`
-	res, err := s.wms.Db.ExecContext(ctx, sqlUpd, product.Id, product.Name, product.ItemNumber, product.Manufacturer.Id)
-	if err != nil {
+	if err := CheckVersion("products", product.Id, product.Version); err != nil {
 		return 0, err
 	}
-	if a, err := res.RowsAffected(); a != 1 || err != nil {
+	return s.audited(ctx, model.EntityProduct, model.AuditUpdate, product.Id, func(s *Storage) (int64, error) {
+		return s.updateProduct(ctx, product)
+	})
+}
+
+func (s *Storage) updateProduct(ctx context.Context, product *model.Product) (int64, error) {
+	sqlUpd := `UPDATE products SET name=$2, item_number=$3, manufacturer_id=$4, weight=$5, volume=$6, version=version+1 WHERE id=$1 AND ` + versionCond(7)
+	res, err := s.db().ExecContext(ctx, sqlUpd, product.Id, product.Name, product.ItemNumber, product.Manufacturer.Id, product.Weight, product.Volume, product.Version)
+	if err != nil {
 		return 0, err
 	}
-	return product.Id, nil
+	return s.updated(ctx, res, "products", product.Id, product.Version)
 }
 
 func (s *Storage) DeleteProduct(ctx context.Context, itemId int64) error {
 	if itemId == 0 {
-		return fmt.Errorf("unacceptable action. item id eq 0")
-	}
-	sqlDel := `DELETE FROM products WHERE id=$1`
-	_, err := s.wms.Db.ExecContext(ctx, sqlDel, itemId)
-	if err != nil {
-		var pgErr *pq.Error
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == ("23503") {
-				return err
-			}
-		}
-		return err
+		return core.Validation("products", 0, "unacceptable action. item id eq 0")
 	}
-	return nil
+	return s.deleteEntity(ctx, model.EntityProduct, itemId)
 }
 
 func (s *Storage) GetProductById(ctx context.Context, itemId int64) (*model.Product, error) {
-	sqlSel := `SELECT p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name 
+	sqlSel := `SELECT p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name, p.weight, p.volume, p.archived_at, p.version 
 				FROM products p 
-				LEFT JOIN public.manufacturers m on m.id = p.manufacturer_id
+				LEFT JOIN manufacturers m on m.id = p.manufacturer_id
 				WHERE p.id = $1`
-	row := s.wms.Db.QueryRowContext(ctx, sqlSel, itemId)
+	row := s.db().QueryRowContext(ctx, sqlSel, itemId)
 	newItem := model.Product{Manufacturer: model.Manufacturer{}}
-	err := row.Scan(&newItem.Id, &newItem.Name, &newItem.ItemNumber, &newItem.Manufacturer.Id, &newItem.Manufacturer.Name)
+	err := row.Scan(&newItem.Id, &newItem.Name, &newItem.ItemNumber, &newItem.Manufacturer.Id, &newItem.Manufacturer.Name, &newItem.Weight, &newItem.Volume, scanNullTime(&newItem.ArchivedAt), &newItem.Version)
 	if err != nil {
-		return nil, err
+		return nil, core.Translate("products", itemId, err)
 	}
 	return &newItem, nil
 }
 
 func (s *Storage) FindProductsByName(ctx context.Context, itemName string) ([]model.Product, error) {
 	items := make([]model.Product, 0)
-	sql := `SELECT p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name
+	sql := `SELECT p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name, p.weight, p.volume, p.version
 			FROM products p 
-			LEFT JOIN public.manufacturers m on m.id = p.manufacturer_id
+			LEFT JOIN manufacturers m on m.id = p.manufacturer_id
 			WHERE p.name = $1`
-	rows, err := s.wms.Db.QueryContext(ctx, sql, itemName)
+	rows, err := s.db().QueryContext(ctx, sql, itemName)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		item := model.Product{Manufacturer: model.Manufacturer{}}
-		err = rows.Scan(&item.Id, &item.Name, &item.ItemNumber, &item.Manufacturer.Id, &item.Manufacturer.Name)
+		err = rows.Scan(&item.Id, &item.Name, &item.ItemNumber, &item.Manufacturer.Id, &item.Manufacturer.Name, &item.Weight, &item.Volume, &item.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -149,19 +152,19 @@ func (s *Storage) FindProductsByName(ctx context.Context, itemName string) ([]mo
 // FindProductsByBarcode returns a product by barcode
 func (s *Storage) FindProductsByBarcode(ctx context.Context, itemName string) ([]model.Product, error) {
 	items := make([]model.Product, 0)
-	sqlQuery := `SELECT p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name
+	sqlQuery := `SELECT p.id, p.name, p.item_number, p.manufacturer_id, coalesce(m.name, '') as manufacturer_name, p.weight, p.volume, p.version
 					FROM products p
-					LEFT JOIN public.manufacturers m on p.manufacturer_id = m.id
+					LEFT JOIN manufacturers m on p.manufacturer_id = m.id
 					WHERE p.id IN (
     					SELECT b.owner_id FROM barcodes b WHERE b.owner_ref='products' AND b.name = $1)`
-	rows, err := s.wms.Db.QueryContext(ctx, sqlQuery, itemName)
+	rows, err := s.db().QueryContext(ctx, sqlQuery, itemName)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		item := model.Product{}
-		err = rows.Scan(&item.Id, &item.Name, &item.ItemNumber, &item.Manufacturer.Id, &item.Manufacturer.Name)
+		err = rows.Scan(&item.Id, &item.Name, &item.ItemNumber, &item.Manufacturer.Id, &item.Manufacturer.Name, &item.Weight, &item.Volume, &item.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -170,6 +173,6 @@ func (s *Storage) FindProductsByBarcode(ctx context.Context, itemName string) ([
 	return items, nil
 }
 func (s *Storage) ProductsSuggest(ctx context.Context, text string, limit int) ([]model.Suggestion, error) {
-	sg := NewSuggestions(s.wms)
+	sg := &Suggestions{wms: s.wms, db: s.db()}
 	return sg.GetSuggestion(ctx, "products", text, limit)
 }
@@ -0,0 +1,146 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+const tablePickFaces = "pick_faces"
+
+// SetPickFace сохраняет настройку min/max ячейки отбора для продукта
+func (s *Storage) SetPickFace(ctx context.Context, face *model.PickFace) error {
+	if face.Cell.Id == 0 || face.ProductId == 0 {
+		return core.Validation(tablePickFaces, 0, "unacceptable action. cell id or product id eq 0")
+	}
+	if face.Min < 0 || face.Max < face.Min || face.Max == 0 {
+		return core.Validation(tablePickFaces, 0, "invalid pick face levels min %d max %d", face.Min, face.Max)
+	}
+	sqlUps := fmt.Sprintf("INSERT INTO %s (cell_id, prod_id, min_qty, max_qty) VALUES ($1, $2, $3, $4) "+
+		"ON CONFLICT (cell_id, prod_id) DO UPDATE SET min_qty = excluded.min_qty, max_qty = excluded.max_qty", tablePickFaces)
+	return s.unit(ctx, func(s *Storage) error {
+		before, err := s.pickFaceEntry(ctx, face.Cell.Id, face.ProductId)
+		if err != nil {
+			return err
+		}
+		if _, err = s.db().ExecContext(ctx, sqlUps, face.Cell.Id, face.ProductId, face.Min, face.Max); err != nil {
+			return err
+		}
+		after := &pickFaceEntry{ProductId: face.ProductId, Min: face.Min, Max: face.Max}
+		return s.audit(ctx, model.EntityPickFace, auditAction(before != nil, true), face.Cell.Id, before, after)
+	})
+}
+
+// DeletePickFace удаляет настройку ячейки отбора для продукта
+func (s *Storage) DeletePickFace(ctx context.Context, cellId int64, productId int64) error {
+	sqlDel := fmt.Sprintf("DELETE FROM %s WHERE cell_id = $1 AND prod_id = $2", tablePickFaces)
+	return s.unit(ctx, func(s *Storage) error {
+		before, err := s.pickFaceEntry(ctx, cellId, productId)
+		if err != nil || before == nil {
+			return err
+		}
+		if _, err = s.db().ExecContext(ctx, sqlDel, cellId, productId); err != nil {
+			return err
+		}
+		return s.audit(ctx, model.EntityPickFace, model.AuditDelete, cellId, before, nil)
+	})
+}
+
+// pickFaceEntry настройка ячейки отбора продукта в журнале аудита
+type pickFaceEntry struct {
+	ProductId int64 `json:"product_id"`
+	Min       int   `json:"min"`
+	Max       int   `json:"max"`
+}
+
+// pickFaceEntry возвращает настройку ячейки отбора cellId для продукта productId, nil - если ее нет
+func (s *Storage) pickFaceEntry(ctx context.Context, cellId int64, productId int64) (*pickFaceEntry, error) {
+	e := &pickFaceEntry{ProductId: productId}
+	sqlSel := fmt.Sprintf("SELECT min_qty, max_qty FROM %s WHERE cell_id = $1 AND prod_id = $2", tablePickFaces)
+	err := s.db().QueryRowContext(ctx, sqlSel, cellId, productId).Scan(&e.Min, &e.Max)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GetPickFaces возвращает ячейки отбора склада whsId
+func (s *Storage) GetPickFaces(ctx context.Context, whsId int64) ([]model.PickFace, error) {
+	items := make([]model.PickFace, 0)
+	sqlSel := fmt.Sprintf("SELECT pf.prod_id, pf.min_qty, pf.max_qty, c.id, c.name, c.whs_id, c.zone_id, c.section_id, c.passage_id, c.rack_id, c.floor, c.number, "+
+		"c.is_size_free, c.is_weight_free, c.not_allowed_in, c.not_allowed_out, c.is_service "+
+		"FROM %s pf JOIN cells c ON c.id = pf.cell_id WHERE c.whs_id = $1 ORDER BY c.name, pf.prod_id", tablePickFaces)
+	rows, err := s.db().QueryContext(ctx, sqlSel, whsId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f := model.PickFace{}
+		c := &f.Cell
+		err = rows.Scan(&f.ProductId, &f.Min, &f.Max, &c.Id, &c.Name, &c.WhsId, &c.ZoneId, &c.SectionId, &c.PassageId, &c.RackId, &c.Floor, &c.Number,
+			&c.IsSizeFree, &c.IsWeightFree, &c.NotAllowedIn, &c.NotAllowedOut, &c.IsService)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, f)
+	}
+	return items, rows.Err()
+}
+
+// CalcReplenishment рассчитывает задания на пополнение ячеек отбора склада whsId
+// demand - неотобранная потребность по продуктам; если nil, она берется из незавершенных волн
+func (s *Storage) CalcReplenishment(ctx context.Context, whsId int64, demand map[int64]int) ([]model.ReplenishmentTask, error) {
+	faces, err := s.GetPickFaces(ctx, whsId)
+	if err != nil {
+		return nil, err
+	}
+	if len(faces) == 0 {
+		return make([]model.ReplenishmentTask, 0), nil
+	}
+	if demand == nil {
+		demand, err = s.openWavesDemand(ctx, whsId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	productIds := make([]int64, 0, len(faces))
+	for _, f := range faces {
+		productIds = append(productIds, f.ProductId)
+	}
+	stock, err := s.GetCellStocks(ctx, whsId, productIds)
+	if err != nil {
+		return nil, err
+	}
+	return model.PlanReplenishment(faces, stock, demand), nil
+}
+
+// ExecuteReplenishment выполняет задание на пополнение перемещением продукта
+func (s *Storage) ExecuteReplenishment(ctx context.Context, task *model.ReplenishmentTask) (int, error) {
+	return s.MoveItemToCell(ctx, task.ProductId, task.CellSrc.Id, task.CellDst.Id, task.Quantity)
+}
+
+// openWavesDemand потребность по заказам волн, отбор которых еще не начат
+func (s *Storage) openWavesDemand(ctx context.Context, whsId int64) (map[int64]int, error) {
+	demand := make(map[int64]int)
+	for _, status := range []int{model.WaveStatusPlanned, model.WaveStatusReleased} {
+		waves, err := s.GetWaves(ctx, whsId, status)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range waves {
+			for _, o := range w.Orders {
+				for _, r := range o.Rows {
+					demand[r.Product.Id] += r.Quantity
+				}
+			}
+		}
+	}
+	return demand, nil
+}
@@ -2,48 +2,235 @@ package whs
 
 import (
 	"context"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
 	"github.com/mlplabs/mwms-core/whs/model"
+	"time"
 )
 
+// ReportStocks возвращает остатки первого склада по ячейкам без ограничения количества строк
+// Для отбора, сортировки и постраничного вывода используется QueryStocks
 func (s *Storage) ReportStocks(ctx context.Context) (*model.StockData, error) {
-	retVal := make([]model.RowStock, 0)
-	sqlSel := "SELECT store.prod_id AS product_id, coalesce(p.name, '<unnamed>') AS product_name, " +
-		"       coalesce(m.id, 0) AS manufacturer_id, coalesce(m.name, '<unnamed>') AS manufacturer_name, " +
-		"       store.zone_id, coalesce(z.name, '<unnamed>') AS zone_name, " +
-		"       store.cell_id, " +
-		"       store.quantity " +
-		"FROM (SELECT s.prod_id, s.zone_id, s.cell_id, SUM(s.quantity) AS quantity " +
-		"               FROM storage1 s " +
-		"               GROUP BY s.prod_id, s.zone_id, s.cell_id) AS store " +
-		"LEFT JOIN products p ON store.prod_id = p.id " +
-		"LEFT JOIN manufacturers m on p.manufacturer_id = m.id " +
-		"LEFT JOIN zones z ON store.zone_id = z.id " +
-		"LEFT JOIN cells c ON store.cell_id = c.id " +
-		"ORDER BY p.name"
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel)
+	page, err := s.QueryStocks(ctx, &model.StockQuery{
+		Filter: model.StockFilter{WhsId: 1},
+		Group:  model.StockGroupCell,
+		Sort:   model.StockSortProduct,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Rows {
+		for j := range page.Rows[i].Cells {
+			if page.Rows[i].Cells[j].Name == "" {
+				_ = page.Rows[i].Cells[j].SetName("")
+			}
+		}
+	}
+	return &model.StockData{Rows: page.Rows}, nil
+}
+
+// ReportAbcXyz выполняет ABC/XYZ анализ отгрузок склада whsId за период [from, to)
+// и сохраняет полученные классы продуктов склада (см. GetProductClasses). Продукты склада
+// без отгрузок за период (с движением до конца периода или ранее классифицированные) получают классы C и Z
+func (s *Storage) ReportAbcXyz(ctx context.Context, whsId int64, from time.Time, to time.Time, opts model.AbcXyzOptions) (*model.AbcXyzReport, error) {
+	if !to.After(from) || opts.Bucket <= 0 {
+		return nil, core.Validation("", 0, "invalid report period")
+	}
+	buckets := int((to.Sub(from) + opts.Bucket - 1) / opts.Bucket)
+	demand := make(map[int64][]float64)
+	sqlSel := fmt.Sprintf("SELECT prod_id, %s AS bucket, -SUM(quantity) "+
+		"FROM storage%d WHERE quantity < 0 AND doc_type IN (%d, %d) AND row_time >= $1 AND row_time < $2 "+
+		"GROUP BY prod_id, bucket", s.wms.floorInt(s.wms.secondsBetween("$1", "row_time")+" / $3"), whsId, DocTypeUnknown, DocTypeOutbound)
+	rows, err := s.db().QueryContext(ctx, sqlSel, s.wms.timeArg(from), s.wms.timeArg(to), opts.Bucket.Seconds())
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		row := model.RowStock{
-			Product:  model.Product{},
-			Quantity: 0,
-			Cells:    make([]model.Cell, 0),
+		var productId int64
+		var bucket int
+		var quantity float64
+		if err = rows.Scan(&productId, &bucket, &quantity); err != nil {
+			return nil, err
 		}
-		cellId := int64(0)
-		err = rows.Scan(&row.Product.Id, &row.Product.Name, &row.Product.Manufacturer.Id, &row.Product.Manufacturer.Name, &row.Zone.Id, &row.Zone.Name, &cellId, &row.Quantity)
-		if err != nil {
+		if demand[productId] == nil {
+			demand[productId] = make([]float64, buckets)
+		}
+		if bucket >= 0 && bucket < buckets {
+			demand[productId][bucket] += quantity
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sqlIdle := fmt.Sprintf("SELECT DISTINCT prod_id FROM storage%d WHERE prod_id IS NOT NULL AND row_time < $1 "+
+		"UNION SELECT prod_id FROM product_classes WHERE whs_id = $2", whsId)
+	idle, err := s.db().QueryContext(ctx, sqlIdle, s.wms.timeArg(to), whsId)
+	if err != nil {
+		return nil, err
+	}
+	defer idle.Close()
+	for idle.Next() {
+		var productId int64
+		if err = idle.Scan(&productId); err != nil {
 			return nil, err
 		}
-		cell, err := s.wms.GetCellInfo(ctx, cellId, nil)
+		if demand[productId] == nil {
+			demand[productId] = make([]float64, buckets)
+		}
+	}
+	if err = idle.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &model.AbcXyzReport{WhsId: whsId, From: from, To: to, Rows: model.AnalyzeAbcXyz(demand, opts)}
+
+	err = s.unit(ctx, func(s *Storage) error {
+		stored, err := s.GetProductClasses(ctx, whsId)
 		if err != nil {
+			return err
+		}
+		before := make(map[int64]*model.ProductClass, len(stored))
+		for i := range stored {
+			before[stored[i].ProductId] = &stored[i]
+		}
+		if _, err = s.db().ExecContext(ctx, "DELETE FROM product_classes WHERE whs_id = $1", whsId); err != nil {
+			return err
+		}
+		sqlIns := "INSERT INTO product_classes (whs_id, prod_id, abc_class, xyz_class) VALUES ($1, $2, $3, $4)"
+		for _, row := range report.Rows {
+			if _, err = s.db().ExecContext(ctx, sqlIns, whsId, row.Product.Id, row.Abc, row.Xyz); err != nil {
+				return err
+			}
+			prev := before[row.Product.Id]
+			after := &model.ProductClass{WhsId: whsId, ProductId: row.Product.Id, Abc: row.Abc, Xyz: row.Xyz}
+			if err = s.audit(ctx, model.EntityProductClass, auditAction(prev != nil, true), row.Product.Id, prev, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// GetProductClasses возвращает классы продуктов склада whsId по последнему ReportAbcXyz
+func (s *Storage) GetProductClasses(ctx context.Context, whsId int64) ([]model.ProductClass, error) {
+	return s.productClasses(ctx, "whs_id", whsId)
+}
+
+// productClasses возвращает классы продуктов, у которых колонка column (whs_id, prod_id) равна id
+func (s *Storage) productClasses(ctx context.Context, column string, id int64) ([]model.ProductClass, error) {
+	items := make([]model.ProductClass, 0)
+	sqlSel := fmt.Sprintf("SELECT whs_id, prod_id, abc_class, xyz_class FROM product_classes WHERE %s = $1 ORDER BY whs_id, prod_id", column)
+	rows, err := s.db().QueryContext(ctx, sqlSel, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := model.ProductClass{}
+		if err = rows.Scan(&item.WhsId, &item.ProductId, &item.Abc, &item.Xyz); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ReportStockAging рассчитывает возраст остатков склада whsId на момент at по FIFO:
+// расход списывает самые ранние приходы в ячейку. Перемещение переносит в ячейку-получатель
+// время поступления перемещенного остатка на склад (см. model.AgeProductFIFO)
+func (s *Storage) ReportStockAging(ctx context.Context, whsId int64, at time.Time) (*model.AgingReport, error) {
+	report := &model.AgingReport{WhsId: whsId, At: at, Rows: make([]model.AgingRow, 0), Products: make([]model.AgingRow, 0)}
+	sqlSel := fmt.Sprintf("SELECT s.cell_id, coalesce(c.name, ''), s.prod_id, coalesce(p.name, '<unnamed>'), s.row_time, s.quantity, s.doc_type "+
+		"FROM storage%d s "+
+		"LEFT JOIN products p ON s.prod_id = p.id "+
+		"LEFT JOIN cells c ON s.cell_id = c.id "+
+		"WHERE s.row_time <= $1 "+
+		"ORDER BY s.prod_id, s.row_time, s.quantity", whsId)
+	rows, err := s.db().QueryContext(ctx, sqlSel, s.wms.timeArg(at))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var product model.Product
+	cellNames := make(map[int64]string)
+	movements := make([]model.Movement, 0)
+	flush := func() {
+		if len(movements) == 0 {
+			return
+		}
+		total := model.AgingRow{Product: product}
+		for _, row := range model.AgeProductFIFO(movements, at) {
+			row.Product, row.Cell.Name = product, cellNames[row.Cell.Id]
+			report.Rows = append(report.Rows, row)
+			for _, t := range []*model.AgingRow{&total, &report.Total} {
+				t.Quantity += row.Quantity
+				t.OldestDays = max(t.OldestDays, row.OldestDays)
+				t.Buckets.Merge(row.Buckets)
+			}
+		}
+		if total.Quantity > 0 {
+			report.Products = append(report.Products, total)
+		}
+		movements = movements[:0]
+	}
+	for rows.Next() {
+		m := model.Movement{}
+		var cellName, productName string
+		var docType int
+		if err = rows.Scan(&m.CellId, &cellName, &m.ProductId, &productName, scanTime(&m.Time), &m.Quantity, &docType); err != nil {
 			return nil, err
 		}
-		cell.SetName("")
-		row.Cells = append(row.Cells, *cell)
-		retVal = append(retVal, row)
+		if m.ProductId != product.Id {
+			flush()
+			product = model.Product{Id: m.ProductId, Name: productName}
+		}
+		m.Move = docType == DocTypeMove
+		cellNames[m.CellId] = cellName
+		movements = append(movements, m)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return report, nil
+}
 
-	return &model.StockData{Rows: retVal}, nil
+// ReportSlowMovers возвращает продукты с остатком на складе whsId, не отгружавшиеся days дней до момента at
+func (s *Storage) ReportSlowMovers(ctx context.Context, whsId int64, days int, at time.Time) ([]model.SlowMover, error) {
+	items := make([]model.SlowMover, 0)
+	sqlSel := fmt.Sprintf("SELECT st.prod_id, coalesce(p.name, '<unnamed>'), st.quantity, st.last_out, st.first_in "+
+		"FROM (SELECT s.prod_id, SUM(s.quantity) AS quantity, "+
+		"             coalesce(MAX(s.row_time) FILTER (WHERE s.quantity < 0 AND s.doc_type IN (%[2]d, %[3]d)), %[4]s) AS last_out, "+
+		"             MIN(s.row_time) FILTER (WHERE s.quantity > 0) AS first_in "+
+		"      FROM storage%[1]d s WHERE s.row_time <= $1 GROUP BY s.prod_id) AS st "+
+		"LEFT JOIN products p ON st.prod_id = p.id "+
+		"WHERE st.quantity > 0 AND st.last_out < $2 "+
+		"ORDER BY st.last_out, p.name", whsId, DocTypeUnknown, DocTypeOutbound, s.wms.epoch())
+	rows, err := s.db().QueryContext(ctx, sqlSel, s.wms.timeArg(at), s.wms.timeArg(at.AddDate(0, 0, -days)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := model.SlowMover{}
+		var lastOut, firstIn time.Time
+		if err = rows.Scan(&item.Product.Id, &item.Product.Name, &item.Quantity, scanTime(&lastOut), scanTime(&firstIn)); err != nil {
+			return nil, err
+		}
+		since := firstIn
+		if lastOut.After(time.Unix(0, 0)) {
+			item.LastOutbound = lastOut
+			since = lastOut
+		}
+		item.IdleDays = int(at.Sub(since).Hours() / 24)
+		items = append(items, item)
+	}
+	return items, rows.Err()
 }
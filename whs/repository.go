@@ -0,0 +1,105 @@
+package whs
+
+import (
+	"context"
+	"github.com/mlplabs/mwms-core/whs/model"
+)
+
+// ProductRepository операции справочника продуктов
+type ProductRepository interface {
+	GetProducts(ctx context.Context) ([]model.Product, error) // без архивных
+	GetProductById(ctx context.Context, itemId int64) (*model.Product, error)
+	CreateProduct(ctx context.Context, product *model.Product) (int64, error)
+	UpdateProduct(ctx context.Context, product *model.Product) (int64, error)
+	DeleteProduct(ctx context.Context, itemId int64) error
+	FindProductsByName(ctx context.Context, itemName string) ([]model.Product, error)
+	FindProductsByBarcode(ctx context.Context, itemName string) ([]model.Product, error)
+}
+
+// ManufacturerRepository операции справочника производителей
+type ManufacturerRepository interface {
+	GetManufacturers(ctx context.Context) ([]model.Manufacturer, error)
+	GetManufacturerById(ctx context.Context, itemId int64) (*model.Manufacturer, error)
+	CreateManufacturer(ctx context.Context, mnf *model.Manufacturer) (int64, error)
+	UpdateManufacturer(ctx context.Context, mnf *model.Manufacturer) (int64, error)
+	DeleteManufacturer(ctx context.Context, itemId int64) error
+	FindManufacturersByName(ctx context.Context, itemName string) ([]model.Manufacturer, error)
+}
+
+// BarcodeRepository операции справочника штрих-кодов
+type BarcodeRepository interface {
+	GetBarcodeById(ctx context.Context, itemId int64) (*model.Barcode, error)
+	CreateBarcode(ctx context.Context, bc *model.Barcode) (int64, error)
+	UpdateBarcode(ctx context.Context, bc *model.Barcode) (int64, error)
+	DeleteBarcode(ctx context.Context, itemId int64) error
+	FindBarcodesByName(ctx context.Context, itemName string) ([]model.Barcode, error)
+	FindBarcodesByOwnerId(ctx context.Context, ownerId int64, ownerRef string) ([]model.Barcode, error)
+}
+
+// WarehouseRepository операции справочника складов
+type WarehouseRepository interface {
+	GetWarehouses(ctx context.Context) ([]model.Warehouse, error)
+	GetWarehouseById(ctx context.Context, itemId int64) (*model.Warehouse, error)
+	CreateWarehouse(ctx context.Context, whs *model.Warehouse) (int64, error)
+	UpdateWarehouse(ctx context.Context, whs *model.Warehouse) (int64, error)
+	DeleteWarehouse(ctx context.Context, itemId int64) error
+	FindWarehousesByName(ctx context.Context, itemName string) ([]model.Warehouse, error)
+}
+
+// UserRepository операции справочника пользователей
+type UserRepository interface {
+	GetUsers(ctx context.Context) ([]model.User, error)
+	GetUserById(ctx context.Context, itemId int64) (*model.User, error)
+	CreateUser(ctx context.Context, user *model.User) (int64, error)
+	UpdateUser(ctx context.Context, user *model.User) (int64, error)
+	DeleteUser(ctx context.Context, itemId int64) error
+	FindUsersByName(ctx context.Context, itemName string) ([]model.User, error)
+}
+
+// CellRepository операции с ячейками и шаблонами их имен
+type CellRepository interface {
+	GetCellById(ctx context.Context, cellId int64) (*model.Cell, error)
+	CreateCell(ctx context.Context, cell *model.Cell) (int64, error)
+	UpdateCell(ctx context.Context, cell *model.Cell) (int64, error)
+	GenerateCells(ctx context.Context, rng *model.CellsRange) ([]int64, error)
+	GetCellNameFormat(ctx context.Context, whsId int64, zoneId int64) (model.CellNameFormat, error)
+	SetCellNameFormat(ctx context.Context, whsId int64, zoneId int64, format model.CellNameFormat) error
+}
+
+// LedgerRepository операции с остатками (ledger склада)
+// Отбор и перемещение выполняются с контролем остатка: операция, после которой остаток продукта
+// в ячейке стал бы отрицательным, не выполняется (core.StockError).
+// Размещение в ячейку с признаком NotAllowedIn и отбор из ячейки с признаком NotAllowedOut
+// (для перемещения - в получатель и из источника соответственно) отклоняются с core.ErrCellBlocked.
+// Размещение или перемещение, после которого вес или объем продуктов ячейки превысил бы MaxWeight
+// или MaxVolume (кроме ячеек с IsWeightFree/IsSizeFree), отклоняется с core.ErrCapacityExceeded
+type LedgerRepository interface {
+	PutItemToCell(ctx context.Context, itemId int64, cellId int64, quantity int) (int, error)
+	GetItemFromCell(ctx context.Context, itemId int64, cellId int64, quantity int) (int, error)
+	MoveItemToCell(ctx context.Context, itemId int64, cellSrcId int64, cellDstId int64, quantity int) (int, error)
+	GetCellStocks(ctx context.Context, whsId int64, productIds []int64) ([]model.CellStock, error)
+}
+
+// ArchiveRepository архивация (мягкое удаление) записей справочников entity (model.Entity*)
+// Delete* удаляет запись, только если на нее ничего не ссылается (GetDependencies), иначе возвращает core.ErrReferenced
+type ArchiveRepository interface {
+	Archive(ctx context.Context, entity string, id int64) error
+	Restore(ctx context.Context, entity string, id int64) error
+	GetArchived(ctx context.Context, entity string) ([]model.ArchivedItem, error)
+	GetDependencies(ctx context.Context, entity string, id int64) (*model.DependencyReport, error)
+}
+
+// Repository справочники, ячейки и ledger склада
+// Реализации: Storage (PostgreSQL) и memstore.Store (в памяти, для тестов)
+type Repository interface {
+	ProductRepository
+	ManufacturerRepository
+	BarcodeRepository
+	WarehouseRepository
+	UserRepository
+	CellRepository
+	LedgerRepository
+	ArchiveRepository
+}
+
+var _ Repository = (*Storage)(nil)
@@ -0,0 +1,724 @@
+// Package repotest набор тестов соответствия реализаций whs.Repository
+// Каждая реализация (PostgreSQL, SQLite, память) запускает Run из своих тестов,
+// что гарантирует одинаковую семантику справочников, ячеек и ledger
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Factory возвращает хранилище для теста. Хранилище может содержать данные других тестов,
+// тесты набора используют уникальные имена
+type Factory func(t *testing.T) whs.Repository
+
+// Run выполняет набор тестов соответствия для хранилища, создаваемого newRepo
+func Run(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, r whs.Repository)
+	}{
+		{"Products", testProducts},
+		{"Manufacturers", testManufacturers},
+		{"Barcodes", testBarcodes},
+		{"Warehouses", testWarehouses},
+		{"Users", testUsers},
+		{"Cells", testCells},
+		{"GenerateCells", testGenerateCells},
+		{"Ledger", testLedger},
+		{"BalanceControl", testBalanceControl},
+		{"CellStocks", testCellStocks},
+		{"ConcurrentWithdrawals", testConcurrentWithdrawals},
+		{"Idempotency", testIdempotency},
+		{"Errors", testErrors},
+		{"Capacity", testCapacity},
+		{"Archive", testArchive},
+		{"Versions", testVersions},
+		{"Actor", testActor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if p := recover(); p != nil {
+					if f, ok := p.(failure); ok {
+						t.Fatal(f.err)
+					}
+					panic(p)
+				}
+			}()
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+var seq atomic.Int64
+
+// unique возвращает уникальное в пределах запуска имя
+func unique(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), seq.Add(1))
+}
+
+// failure ошибка операции хранилища, прерывающая тест (см. must)
+type failure struct{ err error }
+
+// must возвращает v или прерывает текущий тест набора с ошибкой err
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(failure{err})
+	}
+	return v
+}
+
+func testProducts(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	mnfName := unique("mnf")
+	mnfId := must(r.CreateManufacturer(ctx, &model.Manufacturer{Name: mnfName}))
+	name := unique("product")
+	id := must(r.CreateProduct(ctx, &model.Product{Name: name, ItemNumber: "A-1", Manufacturer: model.Manufacturer{Id: mnfId}}))
+
+	p := must(r.GetProductById(ctx, id))
+	want := model.Product{Id: id, Name: name, ItemNumber: "A-1", Manufacturer: model.Manufacturer{Id: mnfId, Name: mnfName}, Version: 1}
+	if !reflect.DeepEqual(*p, want) {
+		t.Errorf("GetProductById = %+v, want %+v", *p, want)
+	}
+	found := must(r.FindProductsByName(ctx, name))
+	if len(found) != 1 || found[0].Id != id {
+		t.Errorf("FindProductsByName = %+v", found)
+	}
+
+	p.Name = unique("renamed")
+	if upd := must(r.UpdateProduct(ctx, p)); upd != id {
+		t.Errorf("UpdateProduct = %d, want %d", upd, id)
+	}
+	if p2 := must(r.GetProductById(ctx, id)); p2.Name != p.Name {
+		t.Errorf("name after update = %q, want %q", p2.Name, p.Name)
+	}
+	if upd := must(r.UpdateProduct(ctx, &model.Product{Id: id + 1000000, Name: "x", Version: whs.VersionAny})); upd != 0 {
+		t.Errorf("UpdateProduct of missing product = %d, want 0", upd)
+	}
+
+	if err := r.DeleteProduct(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetProductById(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetProductById after delete: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := r.DeleteProduct(ctx, 0); err == nil {
+		t.Error("DeleteProduct(0): expected error")
+	}
+}
+
+func testManufacturers(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	name := unique("mnf")
+	id := must(r.CreateManufacturer(ctx, &model.Manufacturer{Name: name}))
+	if m := must(r.GetManufacturerById(ctx, id)); m.Name != name {
+		t.Errorf("GetManufacturerById = %+v", m)
+	}
+	renamed := unique("mnf")
+	if upd := must(r.UpdateManufacturer(ctx, &model.Manufacturer{Id: id, Name: renamed, Version: whs.VersionAny})); upd != id {
+		t.Errorf("UpdateManufacturer = %d", upd)
+	}
+	if found := must(r.FindManufacturersByName(ctx, renamed)); len(found) != 1 || found[0].Id != id {
+		t.Errorf("FindManufacturersByName = %+v", found)
+	}
+	if found := must(r.FindManufacturersByName(ctx, name)); len(found) != 0 {
+		t.Errorf("FindManufacturersByName(old name) = %+v", found)
+	}
+	all := must(r.GetManufacturers(ctx))
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Name > all[i].Name {
+			t.Fatalf("GetManufacturers is not ordered by name: %q > %q", all[i-1].Name, all[i].Name)
+		}
+	}
+	if err := r.DeleteManufacturer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetManufacturerById(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetManufacturerById after delete: err = %v", err)
+	}
+}
+
+func testBarcodes(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	code := unique("bc")
+	id := must(r.CreateBarcode(ctx, &model.Barcode{Name: code, Type: model.BarcodeTypeCode128, OwnerId: prodId, OwnerRef: "products"}))
+
+	want := model.Barcode{Id: id, Name: code, Type: model.BarcodeTypeCode128, OwnerId: prodId, OwnerRef: "products", Version: 1}
+	if bc := must(r.GetBarcodeById(ctx, id)); *bc != want {
+		t.Errorf("GetBarcodeById = %+v, want %+v", *bc, want)
+	}
+	if found := must(r.FindBarcodesByName(ctx, code)); len(found) != 1 || found[0] != want {
+		t.Errorf("FindBarcodesByName = %+v", found)
+	}
+	if found := must(r.FindBarcodesByOwnerId(ctx, prodId, "products")); len(found) != 1 || found[0] != want {
+		t.Errorf("FindBarcodesByOwnerId = %+v", found)
+	}
+	if found := must(r.FindProductsByBarcode(ctx, code)); len(found) != 1 || found[0].Id != prodId {
+		t.Errorf("FindProductsByBarcode = %+v", found)
+	}
+
+	want.Type = model.BarcodeTypeUnknown
+	if upd := must(r.UpdateBarcode(ctx, &want)); upd != id {
+		t.Errorf("UpdateBarcode = %d", upd)
+	}
+	want.Version++
+	if bc := must(r.GetBarcodeById(ctx, id)); *bc != want {
+		t.Errorf("GetBarcodeById after update = %+v, want %+v", *bc, want)
+	}
+	if err := r.DeleteBarcode(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if found := must(r.FindProductsByBarcode(ctx, code)); len(found) != 0 {
+		t.Errorf("FindProductsByBarcode after delete = %+v", found)
+	}
+}
+
+func testWarehouses(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	name := unique("whs")
+	id := must(r.CreateWarehouse(ctx, &model.Warehouse{Name: name}))
+	if w := must(r.GetWarehouseById(ctx, id)); w.Id != id || w.Name != name {
+		t.Errorf("GetWarehouseById = %+v", w)
+	}
+	renamed := unique("whs")
+	if upd := must(r.UpdateWarehouse(ctx, &model.Warehouse{Id: id, Name: renamed, Version: whs.VersionAny})); upd != id {
+		t.Errorf("UpdateWarehouse = %d", upd)
+	}
+	if found := must(r.FindWarehousesByName(ctx, renamed)); len(found) != 1 || found[0].Id != id {
+		t.Errorf("FindWarehousesByName = %+v", found)
+	}
+	// ledger нового склада пуст
+	if stocks := must(r.GetCellStocks(ctx, id, nil)); len(stocks) != 0 {
+		t.Errorf("GetCellStocks of new warehouse = %+v", stocks)
+	}
+}
+
+func testUsers(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	name := unique("user")
+	id := must(r.CreateUser(ctx, &model.User{Name: name}))
+	if u := must(r.GetUserById(ctx, id)); *u != (model.User{Id: id, Name: name, Version: 1}) {
+		t.Errorf("GetUserById = %+v", u)
+	}
+	if found := must(r.FindUsersByName(ctx, name)); len(found) != 1 || found[0].Id != id {
+		t.Errorf("FindUsersByName = %+v", found)
+	}
+	if upd := must(r.UpdateUser(ctx, &model.User{Id: id + 1000000, Name: "x", Version: whs.VersionAny})); upd != 0 {
+		t.Errorf("UpdateUser of missing user = %d, want 0", upd)
+	}
+	if err := r.DeleteUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetUserById(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserById after delete: err = %v", err)
+	}
+}
+
+func testCells(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId := must(r.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	addr := model.CellAddr{WhsId: whsId, ZoneId: 2, PassageId: 1, RackId: 3, Floor: 1}
+
+	c1 := model.Cell{CellAddr: addr, NotAllowedOut: true}
+	id1 := must(r.CreateCell(ctx, &c1))
+	stored := must(r.GetCellById(ctx, id1))
+	if stored.Number != 1 || !stored.NotAllowedOut || stored.Name != c1.Name || stored.Name == "" {
+		t.Errorf("GetCellById = %+v", stored)
+	}
+
+	if err := r.SetCellNameFormat(ctx, whsId, 0, "W{{ $w }}-{{ $r }}-{{ $n }}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetCellNameFormat(ctx, whsId, 2, "Z{{ $z }}-{{ $n }}"); err != nil {
+		t.Fatal(err)
+	}
+	if f := must(r.GetCellNameFormat(ctx, whsId, 5)); f != "W{{ $w }}-{{ $r }}-{{ $n }}" {
+		t.Errorf("GetCellNameFormat(zone without format) = %q", f)
+	}
+	c2 := model.Cell{CellAddr: addr}
+	id2 := must(r.CreateCell(ctx, &c2))
+	if stored = must(r.GetCellById(ctx, id2)); stored.Number != 2 || stored.Name != "Z2-2" {
+		t.Errorf("cell created with zone format = %+v", stored)
+	}
+	if err := r.SetCellNameFormat(ctx, whsId, 2, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.UpdateCell(ctx, &model.Cell{Id: id2, Version: whs.VersionAny}); err != nil {
+		t.Fatal(err)
+	}
+	if stored = must(r.GetCellById(ctx, id2)); stored.Name != fmt.Sprintf("W%d-3-2", whsId) {
+		t.Errorf("cell renamed with warehouse format = %+v", stored)
+	}
+	if _, err := r.GetCellById(ctx, id2+1000000); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetCellById of missing cell: err = %v", err)
+	}
+	if err := r.SetCellNameFormat(ctx, whsId, 0, "{{ $x"); err == nil {
+		t.Error("SetCellNameFormat with invalid format: expected error")
+	}
+}
+
+func testGenerateCells(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId := must(r.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	rng := &model.CellsRange{WhsId: whsId, ZoneId: 1, PassageFrom: 1, PassageTo: 2, RackFrom: 1, RackTo: 1,
+		FloorFrom: 1, FloorTo: 2, CellsPerFloor: 3, Props: model.Cell{IsService: true}}
+	ids := must(r.GenerateCells(ctx, rng))
+	if len(ids) != 12 {
+		t.Fatalf("GenerateCells created %d cells, want 12", len(ids))
+	}
+	// повторная генерация продолжает нумерацию
+	rng.PassageTo, rng.FloorTo, rng.CellsPerFloor = 1, 1, 1
+	more := must(r.GenerateCells(ctx, rng))
+	if c := must(r.GetCellById(ctx, more[0])); c.Number != 4 || !c.IsService || c.PassageId != 1 || c.Floor != 1 {
+		t.Errorf("generated cell = %+v", c)
+	}
+	if _, err := r.GenerateCells(ctx, &model.CellsRange{WhsId: whsId, PassageFrom: 2, PassageTo: 1, CellsPerFloor: 1}); err == nil {
+		t.Error("GenerateCells with invalid range: expected error")
+	}
+}
+
+// newCells создает склад и n ячеек в нем
+func newCells(t *testing.T, r whs.Repository, n int) (int64, []int64) {
+	t.Helper()
+	ctx := context.Background()
+	whsId := must(r.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	ids := must(r.GenerateCells(ctx, &model.CellsRange{WhsId: whsId, ZoneId: 1, PassageFrom: 1, PassageTo: 1,
+		RackFrom: 1, RackTo: 1, FloorFrom: 1, FloorTo: 1, CellsPerFloor: n}))
+	return whsId, ids
+}
+
+func stockOf(t *testing.T, r whs.Repository, whsId, prodId, cellId int64) int {
+	t.Helper()
+	for _, st := range must(r.GetCellStocks(context.Background(), whsId, []int64{prodId})) {
+		if st.Cell.Id == cellId {
+			return st.Quantity
+		}
+	}
+	return 0
+}
+
+func testLedger(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId, cells := newCells(t, r, 2)
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+
+	if q := must(r.PutItemToCell(ctx, prodId, cells[0], 10)); q != 10 {
+		t.Errorf("PutItemToCell = %d", q)
+	}
+	if q := must(r.GetItemFromCell(ctx, prodId, cells[0], 3)); q != 3 {
+		t.Errorf("GetItemFromCell = %d", q)
+	}
+	if q := must(r.MoveItemToCell(ctx, prodId, cells[0], cells[1], 5)); q != 5 {
+		t.Errorf("MoveItemToCell = %d", q)
+	}
+	if got := stockOf(t, r, whsId, prodId, cells[0]); got != 2 {
+		t.Errorf("stock of source cell = %d, want 2", got)
+	}
+	if got := stockOf(t, r, whsId, prodId, cells[1]); got != 5 {
+		t.Errorf("stock of destination cell = %d, want 5", got)
+	}
+
+	otherWhs, otherCells := newCells(t, r, 1)
+	if _, err := r.MoveItemToCell(ctx, prodId, cells[1], otherCells[0], 1); err == nil {
+		t.Error("MoveItemToCell between warehouses: expected error")
+	}
+	if got := stockOf(t, r, otherWhs, prodId, otherCells[0]); got != 0 {
+		t.Errorf("stock after failed move = %d, want 0", got)
+	}
+}
+
+func testBalanceControl(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId, cells := newCells(t, r, 2)
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	must(r.PutItemToCell(ctx, prodId, cells[0], 4))
+
+	if _, err := r.GetItemFromCell(ctx, prodId, cells[0], 5); err == nil {
+		t.Error("GetItemFromCell over balance: expected error")
+	}
+	if _, err := r.MoveItemToCell(ctx, prodId, cells[0], cells[1], 5); err == nil {
+		t.Error("MoveItemToCell over balance: expected error")
+	}
+	// неудачные операции не оставляют строк в ledger
+	if got := stockOf(t, r, whsId, prodId, cells[0]); got != 4 {
+		t.Errorf("stock after failed operations = %d, want 4", got)
+	}
+	if got := stockOf(t, r, whsId, prodId, cells[1]); got != 0 {
+		t.Errorf("destination stock after failed move = %d, want 0", got)
+	}
+	if q := must(r.GetItemFromCell(ctx, prodId, cells[0], 4)); q != 4 {
+		t.Errorf("GetItemFromCell of whole balance = %d", q)
+	}
+	if stocks := must(r.GetCellStocks(ctx, whsId, []int64{prodId})); len(stocks) != 0 {
+		t.Errorf("GetCellStocks of empty cell = %+v", stocks)
+	}
+}
+
+func testCellStocks(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId, cells := newCells(t, r, 2)
+	p1 := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	p2 := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	must(r.PutItemToCell(ctx, p2, cells[1], 1))
+	must(r.PutItemToCell(ctx, p2, cells[0], 2))
+	must(r.PutItemToCell(ctx, p1, cells[1], 3))
+
+	stocks := must(r.GetCellStocks(ctx, whsId, nil))
+	got := make([][3]int64, 0, len(stocks))
+	for _, st := range stocks {
+		got = append(got, [3]int64{st.ProductId, st.Cell.Id, int64(st.Quantity)})
+	}
+	want := [][3]int64{{p1, cells[1], 3}, {p2, cells[0], 2}, {p2, cells[1], 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetCellStocks = %v, want %v", got, want)
+	}
+	if stocks[0].Cell.WhsId != whsId || stocks[0].Cell.ZoneId != 1 || stocks[0].Cell.Name == "" {
+		t.Errorf("stock cell = %+v", stocks[0].Cell)
+	}
+	if stocks = must(r.GetCellStocks(ctx, whsId, []int64{p1})); len(stocks) != 1 || stocks[0].ProductId != p1 {
+		t.Errorf("GetCellStocks(p1) = %+v", stocks)
+	}
+}
+
+// testConcurrentWithdrawals конкурентные отборы и перемещения из одной ячейки не уводят остаток в минус
+func testConcurrentWithdrawals(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	const stock, workers = 10, 30
+	whsId, cells := newCells(t, r, 2)
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	must(r.PutItemToCell(ctx, prodId, cells[0], stock))
+
+	var done atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = r.GetItemFromCell(ctx, prodId, cells[0], 1)
+			} else {
+				_, err = r.MoveItemToCell(ctx, prodId, cells[0], cells[1], 1)
+			}
+			if err == nil {
+				done.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := done.Load(); n != stock {
+		t.Errorf("successful withdrawals = %d, want %d", n, stock)
+	}
+	if got := stockOf(t, r, whsId, prodId, cells[0]); got != 0 {
+		t.Errorf("stock after concurrent withdrawals = %d, want 0", got)
+	}
+}
+
+// testIdempotency повтор операции с тем же ключом возвращает первый результат без записи в ledger
+func testIdempotency(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId, cells := newCells(t, r, 3)
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	put, get, move := unique("put"), unique("get"), unique("move")
+
+	for i := 0; i < 2; i++ {
+		if q := must(r.PutItemToCell(whs.WithIdempotencyKey(ctx, put), prodId, cells[0], 10)); q != 10 {
+			t.Errorf("PutItemToCell #%d = %d, want 10", i, q)
+		}
+		if q := must(r.GetItemFromCell(whs.WithIdempotencyKey(ctx, get), prodId, cells[0], 3)); q != 3 {
+			t.Errorf("GetItemFromCell #%d = %d, want 3", i, q)
+		}
+		if q := must(r.MoveItemToCell(whs.WithIdempotencyKey(ctx, move), prodId, cells[0], cells[1], 2)); q != 2 {
+			t.Errorf("MoveItemToCell #%d = %d, want 2", i, q)
+		}
+	}
+	if got := stockOf(t, r, whsId, prodId, cells[0]); got != 5 {
+		t.Errorf("stock after repeated operations = %d, want 5", got)
+	}
+	if got := stockOf(t, r, whsId, prodId, cells[1]); got != 2 {
+		t.Errorf("destination stock after repeated move = %d, want 2", got)
+	}
+
+	// ключ другой операции
+	if _, err := r.GetItemFromCell(whs.WithIdempotencyKey(ctx, put), prodId, cells[0], 10); !errors.Is(err, whs.ErrIdempotencyKeyReused) {
+		t.Errorf("GetItemFromCell with key of put: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+	if _, err := r.PutItemToCell(whs.WithIdempotencyKey(ctx, put), prodId, cells[0], 11); !errors.Is(err, whs.ErrIdempotencyKeyReused) {
+		t.Errorf("PutItemToCell with other quantity: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+	if _, err := r.MoveItemToCell(whs.WithIdempotencyKey(ctx, move), prodId, cells[0], cells[2], 2); !errors.Is(err, whs.ErrIdempotencyKeyReused) {
+		t.Errorf("MoveItemToCell to other cell: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+	// ключ неудачной операции можно использовать повторно
+	failed := unique("failed")
+	if _, err := r.GetItemFromCell(whs.WithIdempotencyKey(ctx, failed), prodId, cells[0], 100); err == nil {
+		t.Error("GetItemFromCell over balance: expected error")
+	}
+	if q := must(r.GetItemFromCell(whs.WithIdempotencyKey(ctx, failed), prodId, cells[0], 1)); q != 1 {
+		t.Errorf("GetItemFromCell with key of failed operation = %d, want 1", q)
+	}
+	if _, err := r.PutItemToCell(whs.WithIdempotencyKey(ctx, strings.Repeat("k", whs.MaxIdempotencyKeyLen+1)), prodId, cells[0], 1); err == nil {
+		t.Error("PutItemToCell with too long key: expected error")
+	}
+
+	// создание записей справочников
+	create, name := whs.WithIdempotencyKey(ctx, unique("create")), unique("product")
+	first := must(r.CreateProduct(create, &model.Product{Name: name}))
+	if id := must(r.CreateProduct(create, &model.Product{Name: name})); id != first {
+		t.Errorf("repeated CreateProduct = %d, want %d", id, first)
+	}
+	if items, _ := r.FindProductsByName(ctx, name); len(items) != 1 {
+		t.Errorf("products after repeated create = %+v", items)
+	}
+	if _, err := r.CreateManufacturer(create, &model.Manufacturer{Name: name}); !errors.Is(err, whs.ErrIdempotencyKeyReused) {
+		t.Errorf("CreateManufacturer with key of CreateProduct: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+}
+
+// testErrors виды ошибок операций (core.Err*) и идентификаторы сущностей в них
+func testErrors(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId, cells := newCells(t, r, 1)
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	must(r.PutItemToCell(ctx, prodId, cells[0], 2))
+
+	var e *core.Error
+	_, err := r.GetProductById(ctx, prodId+1000000)
+	if !errors.Is(err, core.ErrNotFound) || !errors.As(err, &e) || e.Entity != "products" || e.Id != prodId+1000000 {
+		t.Errorf("GetProductById of missing product: err = %v, want products not found", err)
+	}
+	if err = r.DeleteProduct(ctx, 0); !errors.Is(err, core.ErrValidation) {
+		t.Errorf("DeleteProduct(0): err = %v, want ErrValidation", err)
+	}
+	if _, err = r.PutItemToCell(ctx, prodId, cells[0]+1000000, 1); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("PutItemToCell into missing cell: err = %v, want ErrNotFound", err)
+	}
+
+	var se *core.StockError
+	_, err = r.GetItemFromCell(ctx, prodId, cells[0], 3)
+	if !errors.Is(err, core.ErrInsufficientStock) || !errors.As(err, &se) ||
+		*se != (core.StockError{WhsId: whsId, CellId: cells[0], ProductId: prodId, Balance: -1}) {
+		t.Errorf("GetItemFromCell over balance: err = %v, want insufficient stock", err)
+	}
+
+	addr := model.CellAddr{WhsId: whsId, ZoneId: 1, PassageId: 2}
+	closedIn := must(r.CreateCell(ctx, &model.Cell{CellAddr: addr, NotAllowedIn: true}))
+	closedOut := must(r.CreateCell(ctx, &model.Cell{CellAddr: addr, NotAllowedOut: true}))
+	if _, err = r.PutItemToCell(ctx, prodId, closedIn, 1); !errors.Is(err, core.ErrCellBlocked) || !errors.As(err, &e) || e.Id != closedIn {
+		t.Errorf("PutItemToCell into closed cell: err = %v, want ErrCellBlocked", err)
+	}
+	if _, err = r.MoveItemToCell(ctx, prodId, cells[0], closedIn, 1); !errors.Is(err, core.ErrCellBlocked) {
+		t.Errorf("MoveItemToCell into closed cell: err = %v, want ErrCellBlocked", err)
+	}
+	must(r.PutItemToCell(ctx, prodId, closedOut, 1))
+	if _, err = r.GetItemFromCell(ctx, prodId, closedOut, 1); !errors.Is(err, core.ErrCellBlocked) {
+		t.Errorf("GetItemFromCell from closed cell: err = %v, want ErrCellBlocked", err)
+	}
+	if got := stockOf(t, r, whsId, prodId, cells[0]); got != 2 {
+		t.Errorf("stock after failed operations = %d, want 2", got)
+	}
+}
+
+func testCapacity(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId, cells := newCells(t, r, 1)
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product"), Weight: 0.1, Volume: 500}))
+	if p := must(r.GetProductById(ctx, prodId)); p.Weight != 0.1 || p.Volume != 500 {
+		t.Errorf("product weight/volume = %g/%g, want 0.1/500", p.Weight, p.Volume)
+	}
+	must(r.PutItemToCell(ctx, prodId, cells[0], 10))
+
+	addr := model.CellAddr{WhsId: whsId, ZoneId: 1, PassageId: 3}
+	light := must(r.CreateCell(ctx, &model.Cell{CellAddr: addr, MaxWeight: 0.3}))
+	small := must(r.CreateCell(ctx, &model.Cell{CellAddr: addr, MaxVolume: 1000}))
+	free := must(r.CreateCell(ctx, &model.Cell{CellAddr: addr, MaxWeight: 0.1, IsWeightFree: true}))
+	if c := must(r.GetCellById(ctx, light)); c.MaxWeight != 0.3 {
+		t.Errorf("cell max weight = %g, want 0.3", c.MaxWeight)
+	}
+
+	// 0.1 * 3 с погрешностью суммирования не превышает 0.3
+	must(r.PutItemToCell(ctx, prodId, light, 3))
+	var e *core.Error
+	if _, err := r.PutItemToCell(ctx, prodId, light, 1); !errors.Is(err, core.ErrCapacityExceeded) || !errors.As(err, &e) || e.Id != light {
+		t.Errorf("PutItemToCell over weight: err = %v, want ErrCapacityExceeded", err)
+	}
+	if _, err := r.MoveItemToCell(ctx, prodId, cells[0], small, 3); !errors.Is(err, core.ErrCapacityExceeded) {
+		t.Errorf("MoveItemToCell over volume: err = %v, want ErrCapacityExceeded", err)
+	}
+	must(r.MoveItemToCell(ctx, prodId, cells[0], small, 2))
+	must(r.PutItemToCell(ctx, prodId, free, 5))
+	if got := stockOf(t, r, whsId, prodId, cells[0]); got != 8 {
+		t.Errorf("source stock after rejected move = %d, want 8", got)
+	}
+	if got := stockOf(t, r, whsId, prodId, light); got != 3 {
+		t.Errorf("stock of full cell = %d, want 3", got)
+	}
+}
+
+func testArchive(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	whsId, cells := newCells(t, r, 1)
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	bcId := must(r.CreateBarcode(ctx, &model.Barcode{Name: unique("bc"), Type: 1, OwnerId: prodId, OwnerRef: "products"}))
+	must(r.PutItemToCell(ctx, prodId, cells[0], 2))
+
+	if err := r.Archive(ctx, model.EntityProduct, prodId); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range must(r.GetProducts(ctx)) {
+		if p.Id == prodId {
+			t.Error("GetProducts returns archived product")
+		}
+	}
+	if p := must(r.GetProductById(ctx, prodId)); p.ArchivedAt == nil {
+		t.Error("GetProductById: ArchivedAt is nil after Archive")
+	}
+	archived := false
+	for _, item := range must(r.GetArchived(ctx, model.EntityProduct)) {
+		archived = archived || item.Id == prodId && !item.ArchivedAt.IsZero()
+	}
+	if !archived {
+		t.Error("GetArchived does not return archived product")
+	}
+	if err := r.Restore(ctx, model.EntityProduct, prodId); err != nil {
+		t.Fatal(err)
+	}
+	if p := must(r.GetProductById(ctx, prodId)); p.ArchivedAt != nil {
+		t.Error("GetProductById: ArchivedAt is set after Restore")
+	}
+	if err := r.Archive(ctx, model.EntityProduct, prodId+1000000); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("Archive of missing product: err = %v, want ErrNotFound", err)
+	}
+	if err := r.Archive(ctx, "cell", cells[0]); !errors.Is(err, core.ErrValidation) {
+		t.Errorf("Archive of cell: err = %v, want ErrValidation", err)
+	}
+
+	report := must(r.GetDependencies(ctx, model.EntityProduct, prodId))
+	kinds := make(map[string]model.Dependency)
+	for _, d := range report.Dependencies {
+		kinds[d.Kind] = d
+	}
+	if d := kinds[model.DependencyBarcodes]; !reflect.DeepEqual(d.Ids, []int64{bcId}) {
+		t.Errorf("barcodes dependency = %+v, want barcode %d", d, bcId)
+	}
+	if d := kinds[model.DependencyStock]; d.WhsId != whsId || !reflect.DeepEqual(d.Ids, []int64{cells[0]}) {
+		t.Errorf("stock dependency = %+v, want cell %d of warehouse %d", d, cells[0], whsId)
+	}
+	if err := r.DeleteProduct(ctx, prodId); !errors.Is(err, core.ErrReferenced) {
+		t.Errorf("DeleteProduct of referenced product: err = %v, want ErrReferenced", err)
+	}
+	must(r.GetProductById(ctx, prodId))
+	if err := r.DeleteWarehouse(ctx, whsId); !errors.Is(err, core.ErrReferenced) {
+		t.Errorf("DeleteWarehouse with cells: err = %v, want ErrReferenced", err)
+	}
+
+	mnfId := must(r.CreateManufacturer(ctx, &model.Manufacturer{Name: unique("mnf")}))
+	if report = must(r.GetDependencies(ctx, model.EntityManufacturer, mnfId)); !report.Empty() {
+		t.Errorf("GetDependencies of new manufacturer = %+v, want empty", report)
+	}
+	if err := r.DeleteManufacturer(ctx, mnfId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetDependencies(ctx, model.EntityManufacturer, mnfId); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("GetDependencies of deleted manufacturer: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testVersions(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	id := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	first := must(r.GetProductById(ctx, id))
+	second := must(r.GetProductById(ctx, id))
+
+	first.Name = unique("first")
+	if upd := must(r.UpdateProduct(ctx, first)); upd != id {
+		t.Fatalf("UpdateProduct = %d, want %d", upd, id)
+	}
+	second.Name = unique("second")
+	var e *core.Error
+	if _, err := r.UpdateProduct(ctx, second); !errors.Is(err, core.ErrConflict) || !errors.As(err, &e) || e.Entity != "products" || e.Id != id {
+		t.Errorf("UpdateProduct with stale version: err = %v, want products conflict", err)
+	}
+	p := must(r.GetProductById(ctx, id))
+	if p.Name != first.Name || p.Version != first.Version+1 {
+		t.Errorf("product after conflict = %+v, want name %q, version %d", p, first.Name, first.Version+1)
+	}
+	// списки возвращают версию записи
+	if found := must(r.FindProductsByName(ctx, first.Name)); len(found) != 1 || found[0].Version != p.Version {
+		t.Errorf("FindProductsByName = %+v, want version %d", found, p.Version)
+	}
+	// не заданная версия - ошибка, безусловное изменение - только явно
+	if _, err := r.UpdateProduct(ctx, &model.Product{Id: id, Name: second.Name}); !errors.Is(err, core.ErrValidation) {
+		t.Errorf("UpdateProduct without version: err = %v, want ErrValidation", err)
+	}
+	if upd := must(r.UpdateProduct(ctx, &model.Product{Id: id, Name: second.Name, Version: whs.VersionAny})); upd != id {
+		t.Errorf("UpdateProduct with VersionAny = %d, want %d", upd, id)
+	}
+	if upd := must(r.UpdateProduct(ctx, &model.Product{Id: id + 1000000, Name: "x", Version: 1})); upd != 0 {
+		t.Errorf("UpdateProduct of missing product = %d, want 0", upd)
+	}
+	p = must(r.GetProductById(ctx, id))
+	if err := r.Archive(ctx, model.EntityProduct, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.UpdateProduct(ctx, p); !errors.Is(err, core.ErrConflict) {
+		t.Errorf("UpdateProduct after Archive: err = %v, want ErrConflict", err)
+	}
+
+	_, cells := newCells(t, r, 1)
+	c := must(r.GetCellById(ctx, cells[0]))
+	c.Name = unique("cell")
+	must(r.UpdateCell(ctx, c))
+	if _, err := r.UpdateCell(ctx, c); !errors.Is(err, core.ErrConflict) {
+		t.Errorf("UpdateCell with stale version: err = %v, want ErrConflict", err)
+	}
+
+	usrId := must(r.CreateUser(ctx, &model.User{Name: unique("user")}))
+	usr := must(r.GetUserById(ctx, usrId))
+	must(r.UpdateUser(ctx, usr))
+	if _, err := r.UpdateUser(ctx, usr); !errors.Is(err, core.ErrConflict) {
+		t.Errorf("UpdateUser with stale version: err = %v, want ErrConflict", err)
+	}
+}
+
+func testActor(t *testing.T, r whs.Repository) {
+	ctx := context.Background()
+	_, cells := newCells(t, r, 1)
+	prodId := must(r.CreateProduct(ctx, &model.Product{Name: unique("product")}))
+	usrId := must(r.CreateUser(ctx, &model.User{Name: unique("user")}))
+	actorCtx := whs.WithActor(ctx, model.Actor{User: model.User{Id: usrId}, Terminal: "tsd-01"})
+	if actor, ok := whs.ActorFrom(actorCtx); !ok || actor.User.Id != usrId {
+		t.Fatalf("ActorFrom = %+v, %v", actor, ok)
+	}
+	if _, ok := whs.ActorFrom(ctx); ok {
+		t.Error("ActorFrom of context without actor: ok = true")
+	}
+
+	must(r.PutItemToCell(actorCtx, prodId, cells[0], 1))
+	report := must(r.GetDependencies(ctx, model.EntityUser, usrId))
+	if len(report.Dependencies) != 1 || report.Dependencies[0].Kind != model.DependencyDocuments || report.Dependencies[0].Count != 1 {
+		t.Errorf("user dependencies = %+v, want 1 document", report.Dependencies)
+	}
+	if err := r.DeleteUser(ctx, usrId); !errors.Is(err, core.ErrReferenced) {
+		t.Errorf("DeleteUser of user with documents: err = %v, want ErrReferenced", err)
+	}
+
+	longCtx := whs.WithActor(ctx, model.Actor{User: model.User{Id: usrId}, Terminal: strings.Repeat("t", model.MaxTerminalLen+1)})
+	if _, err := r.PutItemToCell(longCtx, prodId, cells[0], 1); !errors.Is(err, core.ErrValidation) {
+		t.Errorf("PutItemToCell with long terminal id: err = %v, want ErrValidation", err)
+	}
+}
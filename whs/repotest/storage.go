@@ -0,0 +1,675 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Opener возвращает Wms для теста. База может содержать данные других тестов,
+// тесты набора используют уникальные имена и отдельные склады
+type Opener func(t *testing.T) *whs.Wms
+
+// RunStorage выполняет набор тестов возможностей whs.Storage, не входящих в whs.Repository
+// (единица работы, отчеты, волны, импорт, журнал аудита), для базы, открываемой open
+func RunStorage(t *testing.T, open Opener) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, w *whs.Wms)
+	}{
+		{"CellAddrName", testCellAddrName},
+		{"Reports", testReports},
+		{"AbcXyzBuckets", testAbcXyzBuckets},
+		{"Waves", testWaves},
+		{"ImportProducts", testImportProducts},
+		{"SearchIgnoresCase", testSearchIgnoresCase},
+		{"WithTxCommit", testWithTxCommit},
+		{"WithTxRollback", testWithTxRollback},
+		{"IdempotencyRetention", testIdempotencyRetention},
+		{"OperationKeys", testOperationKeys},
+		{"AuditLog", testAuditLog},
+		{"AuditOperations", testAuditOperations},
+		{"DeleteReferences", testDeleteReferences},
+		{"ActorRecords", testActorRecords},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if p := recover(); p != nil {
+					if f, ok := p.(failure); ok {
+						t.Fatal(f.err)
+					}
+					panic(p)
+				}
+			}()
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+// timeArg значение времени t для запросов к базе w в обход Storage
+func timeArg(w *whs.Wms, t time.Time) any {
+	if w.Dialect() == whs.DialectSQLite {
+		return t.UTC().Format("2006-01-02 15:04:05.000")
+	}
+	return t
+}
+
+// ledgerRow добавляет строку ledger склада whsId с заданным временем
+func ledgerRow(t *testing.T, w *whs.Wms, whsId int64, docType int, at time.Time, zoneId, cellId, prodId int64, qty int) {
+	t.Helper()
+	_, err := w.Db.Exec(fmt.Sprintf("INSERT INTO storage%d (doc_type, row_time, zone_id, cell_id, prod_id, quantity) VALUES ($1, $2, $3, $4, $5, $6)", whsId),
+		docType, timeArg(w, at), zoneId, cellId, prodId, qty)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newZone добавляет зону типа zoneType
+func newZone(t *testing.T, w *whs.Wms, zoneType int) int64 {
+	t.Helper()
+	var id int64
+	if err := w.Db.QueryRow("INSERT INTO zones (name, type) VALUES ($1, $2) RETURNING id", unique("zone"), zoneType).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// ean13 возвращает уникальный в пределах запуска штрих-код EAN-13 с верной контрольной цифрой
+func ean13() string {
+	code := fmt.Sprintf("46%010d", (time.Now().UnixNano()/1000+seq.Add(1))%1e10)
+	sum := 0
+	for i, c := range code {
+		d := int(c - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return fmt.Sprintf("%s%d", code, (10-sum%10)%10)
+}
+
+// newWarehouse склад с ячейкой для тестов Storage
+func newWarehouse(t *testing.T, s *whs.Storage) (int64, int64) {
+	ctx := context.Background()
+	whsId := must(s.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	cellId := must(s.CreateCell(ctx, &model.Cell{CellAddr: model.CellAddr{WhsId: whsId, ZoneId: 1}}))
+	return whsId, cellId
+}
+
+func testCellAddrName(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	whsId := must(s.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	// шаблон склада без зоны
+	if err := s.SetCellNameFormat(ctx, whsId, 0, `{{ $p }}-{{ $r }}-{{ $f }}`); err != nil {
+		t.Fatal(err)
+	}
+	cellId := must(s.CreateCell(ctx, &model.Cell{CellAddr: model.CellAddr{WhsId: whsId, ZoneId: 3, PassageId: 2, RackId: 5, Floor: 1}}))
+	if cells := must(s.FindCellsByAddrName(ctx, whsId, "2-5-1")); len(cells) != 1 || cells[0].Id != cellId {
+		t.Errorf("FindCellsByAddrName = %+v, want cell %d", cells, cellId)
+	}
+}
+
+func testReports(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	storage, acceptance := newZone(t, w, model.ZoneTypeStorage), newZone(t, w, model.ZoneTypeAcceptance)
+	whsId := must(s.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	dock := must(s.CreateCell(ctx, &model.Cell{CellAddr: model.CellAddr{WhsId: whsId, ZoneId: acceptance}}))
+	cell := must(s.CreateCell(ctx, &model.Cell{CellAddr: model.CellAddr{WhsId: whsId, ZoneId: storage}}))
+	milk := must(s.CreateProduct(ctx, &model.Product{Name: unique("milk")}))
+	tea := must(s.CreateProduct(ctx, &model.Product{Name: unique("tea")}))
+
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC) // понедельник
+	ledgerRow(t, w, whsId, whs.DocTypeInbound, day.Add(8*time.Hour), acceptance, dock, milk, 10)
+	ledgerRow(t, w, whsId, whs.DocTypeMove, day.Add(10*time.Hour), acceptance, dock, milk, -10)
+	ledgerRow(t, w, whsId, whs.DocTypeMove, day.Add(10*time.Hour), storage, cell, milk, 10)
+	ledgerRow(t, w, whsId, whs.DocTypeOutbound, day.Add(26*time.Hour), storage, cell, milk, -4)
+	ledgerRow(t, w, whsId, whs.DocTypeInbound, day.Add(9*time.Hour), storage, cell, tea, 5)
+
+	kpi := must(s.ReportKpi(ctx, &model.KpiQuery{WhsId: whsId, From: day, To: day.AddDate(0, 0, 7), Period: model.KpiPeriodDay}))
+	if len(kpi.Series) != 2 || !kpi.Series[0].Period.Equal(day) || kpi.Series[0].InboundQty != 15 || kpi.Series[0].MoveQty != 10 ||
+		kpi.Series[1].OutboundQty != 4 {
+		t.Errorf("kpi series = %+v", kpi.Series)
+	}
+	if kpi.DockToStock != 2*time.Hour {
+		t.Errorf("dock to stock = %v, want 2h", kpi.DockToStock)
+	}
+	weekly := must(s.ReportKpi(ctx, &model.KpiQuery{WhsId: whsId, From: day, To: day.AddDate(0, 0, 7), Period: model.KpiPeriodWeek}))
+	if len(weekly.Series) != 1 || !weekly.Series[0].Period.Equal(day) {
+		t.Errorf("weekly kpi series = %+v", weekly.Series)
+	}
+
+	aging := must(s.ReportStockAging(ctx, whsId, day.AddDate(0, 0, 3)))
+	if aging.Total.Quantity != 11 || len(aging.Products) != 2 {
+		t.Errorf("aging = %+v", aging)
+	}
+
+	slow := must(s.ReportSlowMovers(ctx, whsId, 2, day.AddDate(0, 0, 3)))
+	if len(slow) != 1 || slow[0].Product.Id != tea || slow[0].IdleDays != 2 {
+		t.Errorf("slow movers = %+v", slow)
+	}
+
+	abc := must(s.ReportAbcXyz(ctx, whsId, day, day.AddDate(0, 0, 7), model.DefaultAbcXyzOptions))
+	// чай без отгрузок за период - C/Z
+	if len(abc.Rows) != 2 || abc.Rows[0].Product.Id != milk || abc.Rows[1].Abc != model.ClassC || abc.Rows[1].Xyz != model.ClassZ {
+		t.Errorf("abc/xyz = %+v", abc.Rows)
+	}
+	if classes := must(s.GetProductClasses(ctx, whsId)); len(classes) != 2 || classes[0].WhsId != whsId {
+		t.Errorf("product classes = %+v", classes)
+	}
+
+	picks := must(s.GetPickFrequency(ctx, whsId, day, day.AddDate(0, 0, 7)))
+	if picks[milk] != 1 {
+		t.Errorf("pick frequency = %v", picks)
+	}
+
+	page := must(s.QueryStocks(ctx, &model.StockQuery{Filter: model.StockFilter{WhsId: whsId, ProductIds: []int64{tea}}, Group: model.StockGroupCell}))
+	if len(page.Rows) != 1 || page.Rows[0].Quantity != 5 {
+		t.Errorf("stocks = %+v", page.Rows)
+	}
+
+	lot := unique("lot")
+	must(s.PutItemToCell(whs.WithLot(ctx, lot), tea, cell, 2))
+	page = must(s.QueryStocks(ctx, &model.StockQuery{Filter: model.StockFilter{WhsId: whsId, Lot: lot}, Group: model.StockGroupCell}))
+	if len(page.Rows) != 1 || page.Rows[0].Product.Id != tea || page.Rows[0].Quantity != 2 {
+		t.Errorf("lot stocks = %+v", page.Rows)
+	}
+	// отбор партии контролирует остаток партии, а не только общий остаток продукта в ячейке
+	var se *core.StockError
+	if _, err := s.GetItemFromCell(whs.WithLot(ctx, unique("lot")), tea, cell, 1); !errors.As(err, &se) || se.Balance != -1 || se.Lot == "" {
+		t.Errorf("GetItemFromCell of absent lot: err = %v, want lot stock error", err)
+	}
+	if _, err := s.MoveItemToCell(whs.WithLot(ctx, lot), tea, cell, dock, 3); !errors.Is(err, core.ErrInsufficientStock) {
+		t.Errorf("MoveItemToCell of lot over balance: err = %v, want ErrInsufficientStock", err)
+	}
+	must(s.GetItemFromCell(whs.WithLot(ctx, lot), tea, cell, 2))
+	page = must(s.QueryStocks(ctx, &model.StockQuery{Filter: model.StockFilter{WhsId: whsId, Lot: lot}, Group: model.StockGroupCell}))
+	if len(page.Rows) != 0 {
+		t.Errorf("lot stocks after pick = %+v", page.Rows)
+	}
+}
+
+func testAbcXyzBuckets(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	storage := newZone(t, w, model.ZoneTypeStorage)
+	whsId := must(s.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	cell := must(s.CreateCell(ctx, &model.Cell{CellAddr: model.CellAddr{WhsId: whsId, ZoneId: storage}}))
+	milk := must(s.CreateProduct(ctx, &model.Product{Name: unique("milk")}))
+
+	// отгрузки во второй половине каждого из двух часовых интервалов: спрос [4, 4]
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	ledgerRow(t, w, whsId, whs.DocTypeInbound, day.Add(-time.Hour), storage, cell, milk, 10)
+	ledgerRow(t, w, whsId, whs.DocTypeOutbound, day.Add(40*time.Minute), storage, cell, milk, -4)
+	ledgerRow(t, w, whsId, whs.DocTypeOutbound, day.Add(105*time.Minute), storage, cell, milk, -4)
+
+	opts := model.DefaultAbcXyzOptions
+	opts.Bucket = time.Hour
+	abc := must(s.ReportAbcXyz(ctx, whsId, day, day.Add(2*time.Hour), opts))
+	if len(abc.Rows) != 1 || abc.Rows[0].Quantity != 8 || abc.Rows[0].Xyz != model.ClassX {
+		t.Errorf("abc/xyz = %+v, want 8 shipped with even demand (X)", abc.Rows)
+	}
+}
+
+func testWaves(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	whsId, cell := newWarehouse(t, s)
+	milk := must(s.CreateProduct(ctx, &model.Product{Name: unique("milk")}))
+	must(s.PutItemToCell(ctx, milk, cell, 10))
+	orders := []model.OutboundOrder{{Id: 1, Rows: []model.OrderRow{{Product: model.Product{Id: milk}, Quantity: 3}}}}
+	waves := must(s.CreateWaves(ctx, whsId, orders, model.WaveOptions{Pickers: 1}))
+	if len(waves) != 1 || waves[0].CreatedAt.IsZero() {
+		t.Fatalf("waves = %+v", waves)
+	}
+	if err := s.SetWaveStatus(ctx, waves[0].Id, model.WaveStatusReleased); err != nil {
+		t.Fatal(err)
+	}
+	wave := must(s.GetWaveById(ctx, waves[0].Id))
+	if wave.Status != model.WaveStatusReleased || len(wave.Orders) != 1 {
+		t.Errorf("wave = %+v", wave)
+	}
+
+	// остаток, зарезервированный открытой волной, повторно не распределяется
+	orders[0].Rows[0].Quantity = 9
+	next := must(s.CreateWaves(ctx, whsId, orders, model.WaveOptions{Pickers: 1}))
+	if len(next) != 1 || len(next[0].Shortages) != 1 || next[0].Shortages[0].Quantity != 2 {
+		t.Errorf("second waves = %+v", next)
+	}
+
+	// волна в отборе резервирует еще не отобранные строки до завершения
+	if err := s.SetWaveStatus(ctx, waves[0].Id, model.WaveStatusPicking); err != nil {
+		t.Fatal(err)
+	}
+	orders[0].Rows[0].Quantity = 1
+	picking := must(s.CreateWaves(ctx, whsId, orders, model.WaveOptions{Pickers: 1}))
+	if len(picking) != 1 || len(picking[0].Shortages) != 1 || picking[0].Shortages[0].Quantity != 1 {
+		t.Errorf("waves planned while picking = %+v", picking)
+	}
+	if err := s.SetWaveStatus(ctx, next[0].Id, model.WaveStatusCancelled); err != nil {
+		t.Fatal(err)
+	}
+	if freed := must(s.CreateWaves(ctx, whsId, orders, model.WaveOptions{Pickers: 1})); len(freed) != 1 || len(freed[0].Shortages) != 0 {
+		t.Errorf("waves planned after cancel = %+v", freed)
+	}
+}
+
+func testImportProducts(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	barcode, mnf := ean13(), unique("farm")
+	rows := []model.ProductImportRow{
+		{Line: 2, Name: "milk", ItemNumber: unique("M"), Manufacturer: mnf, Barcodes: []string{barcode}},
+		{Line: 3, Name: "kefir", ItemNumber: unique("K"), Barcodes: []string{barcode}},
+	}
+	report := must(s.ImportProducts(ctx, rows, model.ImportOptions{}))
+	if report.Created != 1 || report.Failed != 1 {
+		t.Errorf("import report = %+v", report)
+	}
+	if items, _ := s.FindProductsByBarcode(ctx, barcode); len(items) != 1 || items[0].Manufacturer.Name != mnf {
+		t.Errorf("products = %+v", items)
+	}
+
+	// строки без номеров различаются по порядку, производитель строки с ошибкой не создается
+	failed := unique("farm")
+	rows = []model.ProductImportRow{
+		{Name: "tea", ItemNumber: unique("T")},
+		{Name: "coffee", ItemNumber: unique("C"), Manufacturer: failed, Barcodes: []string{barcode}},
+	}
+	report = must(s.ImportProducts(ctx, rows, model.ImportOptions{}))
+	if len(report.Rows) != 2 || report.Rows[0].Action != model.ImportActionCreate || report.Rows[1].Action != model.ImportActionError {
+		t.Errorf("import report = %+v", report)
+	}
+	if items, _ := s.FindManufacturersByName(ctx, failed); len(items) != 0 {
+		t.Errorf("manufacturers of failed row = %+v", items)
+	}
+}
+
+func testSearchIgnoresCase(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	name := unique("Молоко")
+	id := must(s.CreateProduct(ctx, &model.Product{Name: name}))
+	items, _, err := s.GetProductsItems(ctx, 0, 10, strings.ToLower(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Id != id {
+		t.Errorf("GetProductsItems(%q) = %+v", strings.ToLower(name), items)
+	}
+	if sg := must(s.ProductsSuggest(ctx, strings.ToUpper(name), 10)); len(sg) != 1 || sg[0].Id != id {
+		t.Errorf("ProductsSuggest = %+v", sg)
+	}
+
+	// строка поиска передается параметром, кавычки не нарушают запрос
+	quoted := unique("O'Brien")
+	mnfId := must(s.CreateManufacturer(ctx, &model.Manufacturer{Name: quoted}))
+	prodId := must(s.CreateProduct(ctx, &model.Product{Name: quoted}))
+	if items, total, err := s.GetProductsItems(ctx, 0, 10, quoted); err != nil || len(items) != 1 || items[0].Id != prodId || total != 1 {
+		t.Errorf("GetProductsItems(%q) = %+v, %d, %v", quoted, items, total, err)
+	}
+	if items, total, err := s.GetManufacturersItems(ctx, 0, 10, quoted); err != nil || len(items) != 1 || items[0].Id != mnfId || total != 1 {
+		t.Errorf("GetManufacturersItems(%q) = %+v, %d, %v", quoted, items, total, err)
+	}
+}
+
+func testWithTxCommit(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	whsId, cellId := newWarehouse(t, s)
+	barcode, rejected := ean13(), unique("rejected")
+	var prodId int64
+	err := w.WithTx(ctx, func(tx *whs.Tx) error {
+		var err error
+		if prodId, err = tx.CreateProduct(ctx, &model.Product{Name: unique("milk")}); err != nil {
+			return err
+		}
+		if _, err = tx.CreateBarcode(ctx, &model.Barcode{Name: barcode, Type: model.BarcodeTypeEAN13, OwnerId: prodId, OwnerRef: "products"}); err != nil {
+			return err
+		}
+		if _, err = tx.PutItemToCell(ctx, prodId, cellId, 10); err != nil {
+			return err
+		}
+		// ошибка операции откатывает только ее изменения
+		if _, err = tx.GetItemFromCell(ctx, prodId, cellId, 11); err == nil {
+			t.Error("GetItemFromCell over balance succeeded")
+		}
+		// ошибка отдельного запроса (ячейки нет) не прерывает транзакцию
+		if err = tx.SetPickFace(ctx, &model.PickFace{Cell: model.Cell{Id: cellId + 1000000}, ProductId: prodId, Min: 1, Max: 2}); err == nil {
+			t.Error("SetPickFace for unknown cell succeeded")
+		}
+		// изменение, не записанное в журнал аудита, откатывается
+		bad := whs.WithActor(ctx, model.Actor{Terminal: strings.Repeat("t", model.MaxTerminalLen+1)})
+		if _, err = tx.CreateProduct(bad, &model.Product{Name: rejected}); err == nil {
+			t.Error("CreateProduct with invalid actor succeeded")
+		}
+		_, err = tx.GetItemFromCell(ctx, prodId, cellId, 4)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := s.FindProductsByBarcode(ctx, barcode); len(items) != 1 || items[0].Id != prodId {
+		t.Errorf("FindProductsByBarcode = %+v", items)
+	}
+	if stock, _ := s.GetCellStocks(ctx, whsId, []int64{prodId}); len(stock) != 1 || stock[0].Quantity != 6 {
+		t.Errorf("GetCellStocks = %+v", stock)
+	}
+	if items, _ := s.FindProductsByName(ctx, rejected); len(items) != 0 {
+		t.Errorf("rejected products = %+v", items)
+	}
+}
+
+func testWithTxRollback(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	whsId, cellId := newWarehouse(t, s)
+	fail := errors.New("fail")
+	names := []string{unique("error"), unique("panic"), unique("cancel")}
+
+	if err := w.WithTx(ctx, func(tx *whs.Tx) error {
+		prodId, _ := tx.CreateProduct(ctx, &model.Product{Name: names[0]})
+		_, _ = tx.PutItemToCell(ctx, prodId, cellId, 1)
+		return fail
+	}); !errors.Is(err, fail) {
+		t.Errorf("WithTx error = %v, want %v", err, fail)
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recover = %v, want boom", p)
+			}
+		}()
+		_ = w.WithTx(ctx, func(tx *whs.Tx) error {
+			_, _ = tx.CreateProduct(ctx, &model.Product{Name: names[1]})
+			panic("boom")
+		})
+	}()
+
+	cctx, cancel := context.WithCancel(ctx)
+	if err := w.WithTx(cctx, func(tx *whs.Tx) error {
+		_, _ = tx.CreateProduct(cctx, &model.Product{Name: names[2]})
+		cancel()
+		return nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Errorf("WithTx error = %v, want context.Canceled", err)
+	}
+
+	for _, name := range names {
+		if items, _ := s.FindProductsByName(ctx, name); len(items) != 0 {
+			t.Errorf("products after rollback = %+v", items)
+		}
+	}
+	if stock, _ := s.GetCellStocks(ctx, whsId, nil); len(stock) != 0 {
+		t.Errorf("stocks after rollback = %+v", stock)
+	}
+}
+
+func testIdempotencyRetention(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	whsId, cellId := newWarehouse(t, s)
+	retention := w.KeyRetention
+	w.KeyRetention = time.Hour
+	t.Cleanup(func() { w.KeyRetention = retention })
+	prodId := must(s.CreateProduct(ctx, &model.Product{Name: unique("milk")}))
+	_, err := w.Db.Exec(fmt.Sprintf("INSERT INTO storage%d (doc_type, row_id, row_time, zone_id, cell_id, prod_id, quantity) VALUES ($1, 'k1', $2, 1, $3, $4, 5)", whsId),
+		whs.DocTypeInbound, timeArg(w, time.Now().Add(-2*time.Hour)), cellId, prodId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ключ старше срока хранения не учитывается
+	must(s.PutItemToCell(whs.WithIdempotencyKey(ctx, "k1"), prodId, cellId, 5))
+	if stock, _ := s.GetCellStocks(ctx, whsId, nil); len(stock) != 1 || stock[0].Quantity != 10 {
+		t.Errorf("stocks = %+v", stock)
+	}
+	if n, err := s.PurgeIdempotencyKeys(ctx, whsId); err != nil || n != 1 {
+		t.Errorf("PurgeIdempotencyKeys = %d, %v, want 1", n, err)
+	}
+	var keys int
+	if err = w.Db.QueryRow(fmt.Sprintf("SELECT count(*) FROM storage%d WHERE row_id = 'k1'", whsId)).Scan(&keys); err != nil || keys != 1 {
+		t.Errorf("rows with key = %d, %v, want 1", keys, err)
+	}
+}
+
+// testOperationKeys ключи идемпотентности операций без ledger: волны и импорт
+func testOperationKeys(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	whsId, cell := newWarehouse(t, s)
+	milk := must(s.CreateProduct(ctx, &model.Product{Name: unique("milk")}))
+	must(s.PutItemToCell(ctx, milk, cell, 10))
+	orders := []model.OutboundOrder{{Id: 1, Rows: []model.OrderRow{{Product: model.Product{Id: milk}, Quantity: 3}}}}
+
+	create := whs.WithIdempotencyKey(ctx, unique("waves"))
+	waves := must(s.CreateWaves(create, whsId, orders, model.WaveOptions{Pickers: 1}))
+	if again := must(s.CreateWaves(create, whsId, orders, model.WaveOptions{Pickers: 1})); len(again) != 1 || again[0].Id != waves[0].Id {
+		t.Errorf("repeated CreateWaves = %+v, want %+v", again, waves)
+	}
+	if all := must(s.GetWaves(ctx, whsId, -1)); len(all) != 1 {
+		t.Errorf("waves after repeated create = %d, want 1", len(all))
+	}
+	release := whs.WithIdempotencyKey(ctx, unique("release"))
+	for i := 0; i < 2; i++ {
+		if err := s.SetWaveStatus(release, waves[0].Id, model.WaveStatusReleased); err != nil {
+			t.Errorf("SetWaveStatus #%d: %v", i, err)
+		}
+	}
+	if err := s.SetWaveStatus(release, waves[0].Id, model.WaveStatusCancelled); !errors.Is(err, whs.ErrIdempotencyKeyReused) {
+		t.Errorf("SetWaveStatus to other status: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+
+	kefir := unique("kefir")
+	rows := []model.ProductImportRow{{Line: 2, Name: kefir, ItemNumber: unique("K")}}
+	imp := whs.WithIdempotencyKey(ctx, unique("import"))
+	must(s.ImportProducts(imp, rows, model.ImportOptions{}))
+	if report := must(s.ImportProducts(imp, rows, model.ImportOptions{})); report.Created != 1 {
+		t.Errorf("repeated import report = %+v, want report of first import", report)
+	}
+	if items, _ := s.FindProductsByName(ctx, kefir); len(items) != 1 {
+		t.Errorf("products after repeated import = %+v", items)
+	}
+}
+
+func testAuditLog(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	start := time.Now().Add(-time.Second)
+	usrId := must(s.CreateUser(ctx, &model.User{Name: unique("manager")}))
+	name := unique("milk")
+	prodId := must(s.CreateProduct(ctx, &model.Product{Name: name}))
+	must(s.UpdateProduct(whs.WithUser(ctx, model.User{Id: usrId}), &model.Product{Id: prodId, Name: name + "-kefir", Version: whs.VersionAny}))
+	if err := s.DeleteProduct(ctx, prodId); err != nil {
+		t.Fatal(err)
+	}
+	whsId := must(s.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	if err := s.SetCellNameFormat(ctx, whsId, 0, "{{ $p }}-{{ $r }}"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := must(s.GetAuditLog(ctx, model.AuditFilter{Entity: model.EntityProduct, EntityId: prodId}))
+	actions := make([]string, 0)
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	if fmt.Sprint(actions) != "[delete update create]" {
+		t.Fatalf("actions = %v", actions)
+	}
+	change := entries[1].Changes["name"]
+	if string(change.Before) != fmt.Sprintf("%q", name) || string(change.After) != fmt.Sprintf("%q", name+"-kefir") ||
+		entries[1].UserId != usrId || entries[1].CreatedAt.Before(start) {
+		t.Errorf("update entry = %+v", entries[1])
+	}
+	if byUser, _ := s.GetAuditLog(ctx, model.AuditFilter{UserId: usrId}); len(byUser) != 1 || byUser[0].Action != model.AuditUpdate {
+		t.Errorf("entries of user = %+v", byUser)
+	}
+	if formats, _ := s.GetAuditLog(ctx, model.AuditFilter{Entity: model.EntityCellNameFormat, EntityId: whsId}); len(formats) != 1 {
+		t.Errorf("cell name format entries = %+v", formats)
+	}
+	if all, _ := s.GetAuditLog(ctx, model.AuditFilter{From: start, Limit: 2}); len(all) != 2 {
+		t.Errorf("limited entries = %+v", all)
+	}
+	// постраничный вывод по id последней записи предыдущей страницы
+	filter := model.AuditFilter{Entity: model.EntityProduct, EntityId: prodId, Limit: 2}
+	first := must(s.GetAuditLog(ctx, filter))
+	filter.BeforeId = first[len(first)-1].Id
+	if next := must(s.GetAuditLog(ctx, filter)); len(next) != 1 || next[0].Action != model.AuditCreate {
+		t.Errorf("second page = %+v", next)
+	}
+	if later, _ := s.GetAuditLog(ctx, model.AuditFilter{From: time.Now().Add(time.Hour)}); len(later) != 0 {
+		t.Errorf("entries after period start = %+v", later)
+	}
+}
+
+// testAuditOperations журнал аудита изменений помимо Create*/Update*/Delete*
+func testDeleteReferences(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	whsId := must(s.CreateWarehouse(ctx, &model.Warehouse{Name: unique("whs")}))
+	prodId := must(s.CreateProduct(ctx, &model.Product{Name: unique("milk")}))
+	prodKey, whsKey := unique("ext"), unique("ext")
+	for _, ext := range []model.ExternalId{{System: "1c", Key: prodKey, Entity: model.EntityProduct, Id: prodId},
+		{System: "1c", Key: whsKey, Entity: model.EntityWarehouse, Id: whsId}} {
+		if err := s.SetExternalId(ctx, &ext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Db.Exec("INSERT INTO product_classes (whs_id, prod_id, abc_class, xyz_class) VALUES ($1, $2, 'A', 'X')", whsId, prodId); err != nil {
+		t.Fatal(err)
+	}
+
+	// удаление записи удаляет ее внешние идентификаторы и классы ABC/XYZ
+	if err := s.DeleteProduct(ctx, prodId); err != nil {
+		t.Fatal(err)
+	}
+	if id := must(s.LookupExternalId(ctx, "1c", model.EntityProduct, prodKey)); id != 0 {
+		t.Errorf("external id of deleted product = %d, want 0", id)
+	}
+	if classes := must(s.GetProductClasses(ctx, whsId)); len(classes) != 0 {
+		t.Errorf("classes of deleted product = %+v", classes)
+	}
+	if err := s.DeleteWarehouse(ctx, whsId); err != nil {
+		t.Fatal(err)
+	}
+	if id := must(s.LookupExternalId(ctx, "1c", model.EntityWarehouse, whsKey)); id != 0 {
+		t.Errorf("external id of deleted warehouse = %d, want 0", id)
+	}
+}
+
+func testAuditOperations(t *testing.T, w *whs.Wms) {
+	ctx := context.Background()
+	s := whs.NewStorage(w)
+	whsId, cellId := newWarehouse(t, s)
+	actions := func(entity string, id int64) string {
+		t.Helper()
+		entries := must(s.GetAuditLog(ctx, model.AuditFilter{Entity: entity, EntityId: id}))
+		res := make([]string, 0, len(entries))
+		for _, e := range entries {
+			res = append(res, e.Action)
+		}
+		return fmt.Sprint(res)
+	}
+
+	barcode, key := ean13(), unique("ext")
+	rows := []model.ProductImportRow{{Line: 2, Name: unique("milk"), ItemNumber: unique("M"), ExternalId: key, Barcodes: []string{barcode}}}
+	report := must(s.ImportProducts(ctx, rows, model.ImportOptions{System: "erp"}))
+	prodId := report.Rows[0].ProductId
+	bc := must(s.FindBarcodesByOwnerId(ctx, prodId, "products"))
+	if got := actions(model.EntityProduct, prodId); got != "[create]" {
+		t.Errorf("product actions after import = %s", got)
+	}
+	if len(bc) != 1 || actions(model.EntityBarcode, bc[0].Id) != "[create]" {
+		t.Errorf("barcode entries after import = %+v", bc)
+	}
+	if got := actions(model.EntityExternalId, prodId); got != "[create]" {
+		t.Errorf("external id actions after import = %s", got)
+	}
+	if err := s.DeleteExternalId(ctx, "erp", model.EntityProduct, key); err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(model.EntityExternalId, prodId); got != "[delete create]" {
+		t.Errorf("external id actions after delete = %s", got)
+	}
+
+	if err := s.SetCellNameFormat(ctx, whsId, 0, "R{{ $r }}-{{ $n }}"); err != nil {
+		t.Fatal(err)
+	}
+	if n := must(s.RenameCells(ctx, whsId, 0)); n != 1 {
+		t.Errorf("RenameCells = %d, want 1", n)
+	}
+	if got := actions(model.EntityCell, cellId); got != "[update create]" {
+		t.Errorf("cell actions after rename = %s", got)
+	}
+
+	layout := &model.Layout{WhsId: whsId, Passages: []model.PassageLayout{{PassageId: 1, YEnd: 10}}}
+	for i := 0; i < 2; i++ {
+		if err := s.SaveLayout(ctx, layout); err != nil {
+			t.Fatal(err)
+		}
+		layout.Passages[0].YEnd = 20
+	}
+	if got := actions(model.EntityLayout, whsId); got != "[update create]" {
+		t.Errorf("layout actions = %s", got)
+	}
+
+	if err := s.SetPickFace(ctx, &model.PickFace{Cell: model.Cell{Id: cellId}, ProductId: prodId, Min: 1, Max: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeletePickFace(ctx, cellId, prodId); err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(model.EntityPickFace, cellId); got != "[delete create]" {
+		t.Errorf("pick face actions = %s", got)
+	}
+
+	must(s.PutItemToCell(ctx, prodId, cellId, 5))
+	must(s.ReportAbcXyz(ctx, whsId, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), model.DefaultAbcXyzOptions))
+	if got := actions(model.EntityProductClass, prodId); got != "[create]" {
+		t.Errorf("product class actions = %s", got)
+	}
+}
+
+func testActorRecords(t *testing.T, w *whs.Wms) {
+	s := whs.NewStorage(w)
+	usrId := must(s.CreateUser(context.Background(), &model.User{Name: unique("picker")}))
+	ctx := whs.WithActor(context.Background(), model.Actor{User: model.User{Id: usrId}, Terminal: "tsd-01"})
+	whsId, cell := newWarehouse(t, s)
+	milk := must(s.CreateProduct(ctx, &model.Product{Name: unique("milk")}))
+	must(s.PutItemToCell(ctx, milk, cell, 10))
+
+	entries := must(s.GetAuditLog(ctx, model.AuditFilter{UserId: usrId}))
+	if len(entries) != 1 || entries[0].Entity != model.EntityProduct || entries[0].Terminal != "tsd-01" {
+		t.Errorf("audit entries of user = %+v", entries)
+	}
+	orders := []model.OutboundOrder{{Id: 1, Rows: []model.OrderRow{{Product: model.Product{Id: milk}, Quantity: 3}}}}
+	waves := must(s.CreateWaves(ctx, whsId, orders, model.WaveOptions{Pickers: 1}))
+	if wave, _ := s.GetWaveById(ctx, waves[0].Id); wave == nil || wave.UserId != usrId || wave.Terminal != "tsd-01" {
+		t.Errorf("wave = %+v, want user %d on tsd-01", wave, usrId)
+	}
+	releaser := whs.WithActor(context.Background(), model.Actor{User: model.User{Id: usrId + 1}, Terminal: "tsd-02"})
+	if err := s.SetWaveStatus(releaser, waves[0].Id, model.WaveStatusReleased); err != nil {
+		t.Fatal(err)
+	}
+	if wave, _ := s.GetWaveById(ctx, waves[0].Id); wave == nil || wave.StatusUserId != usrId+1 || wave.StatusTerminal != "tsd-02" || wave.UserId != usrId {
+		t.Errorf("wave after release = %+v, want status changed by user %d on tsd-02", wave, usrId+1)
+	}
+
+	// недопустимый терминал отклоняет изменение, даже если записывать в журнал нечего
+	invalid := whs.WithActor(context.Background(), model.Actor{Terminal: strings.Repeat("t", model.MaxTerminalLen+1)})
+	if _, err := s.UpdateProduct(invalid, &model.Product{Id: milk + 1000000, Name: "x", Version: whs.VersionAny}); !errors.Is(err, core.ErrValidation) {
+		t.Errorf("UpdateProduct of missing product with invalid terminal: err = %v, want ErrValidation", err)
+	}
+	if err := s.SetWaveStatus(invalid, waves[0].Id, model.WaveStatusPicking); !errors.Is(err, core.ErrValidation) {
+		t.Errorf("SetWaveStatus with invalid terminal: err = %v, want ErrValidation", err)
+	}
+}
@@ -0,0 +1,337 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// schema дополнительные объекты БД, используемые модулем
+// Все выражения идемпотентны и выполняются по порядку методом Wms.Migrate
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS cell_name_formats (
+		whs_id  integer not null,
+		zone_id integer default 0 not null,
+		format  text not null,
+		PRIMARY KEY (whs_id, zone_id))`,
+	`CREATE TABLE IF NOT EXISTS whs_layouts (
+		whs_id integer primary key,
+		layout jsonb not null)`,
+	`CREATE TABLE IF NOT EXISTS waves (
+		id         serial primary key,
+		whs_id     integer not null,
+		status     smallint default 0 not null,
+		plan       jsonb not null,
+		created_at timestamptz default now() not null,
+		updated_at timestamptz default now() not null)`,
+	`CREATE TABLE IF NOT EXISTS pick_faces (
+		cell_id integer not null references cells,
+		prod_id integer not null,
+		min_qty integer default 0 not null,
+		max_qty integer default 0 not null,
+		PRIMARY KEY (cell_id, prod_id))`,
+	`CREATE TABLE IF NOT EXISTS product_classes (
+		whs_id    integer not null,
+		prod_id   integer not null,
+		abc_class varchar(1) not null,
+		xyz_class varchar(1) not null,
+		PRIMARY KEY (whs_id, prod_id))`,
+	`CREATE TABLE IF NOT EXISTS external_ids (
+		system  varchar(32) not null,
+		entity  varchar(32) not null,
+		ext_key varchar(128) not null,
+		id      integer not null,
+		PRIMARY KEY (system, entity, ext_key))`,
+	`CREATE INDEX IF NOT EXISTS external_ids_entity_idx ON external_ids (entity, id)`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at timestamptz`,
+	`ALTER TABLE manufacturers ADD COLUMN IF NOT EXISTS archived_at timestamptz`,
+	`ALTER TABLE warehouses ADD COLUMN IF NOT EXISTS archived_at timestamptz`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS archived_at timestamptz`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS version integer default 1 not null`,
+	`ALTER TABLE manufacturers ADD COLUMN IF NOT EXISTS version integer default 1 not null`,
+	`ALTER TABLE barcodes ADD COLUMN IF NOT EXISTS version integer default 1 not null`,
+	`ALTER TABLE warehouses ADD COLUMN IF NOT EXISTS version integer default 1 not null`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS version integer default 1 not null`,
+	`ALTER TABLE cells ADD COLUMN IF NOT EXISTS version integer default 1 not null`,
+	`ALTER TABLE cells ADD COLUMN IF NOT EXISTS max_weight double precision default 0 not null`,
+	`ALTER TABLE cells ADD COLUMN IF NOT EXISTS max_volume double precision default 0 not null`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS weight double precision default 0 not null`,
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS volume double precision default 0 not null`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id         serial primary key,
+		entity     varchar(32) not null,
+		entity_id  integer not null,
+		action     varchar(16) not null,
+		changes    jsonb not null,
+		user_id    integer default 0 not null,
+		created_at timestamptz default now() not null)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity, entity_id)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at)`,
+	`ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS terminal varchar(64) default '' not null`,
+	`ALTER TABLE waves ADD COLUMN IF NOT EXISTS user_id integer default 0 not null`,
+	`ALTER TABLE waves ADD COLUMN IF NOT EXISTS terminal varchar(64) default '' not null`,
+	`ALTER TABLE waves ADD COLUMN IF NOT EXISTS status_user_id integer default 0 not null`,
+	`ALTER TABLE waves ADD COLUMN IF NOT EXISTS status_terminal varchar(64) default '' not null`,
+	`CREATE TABLE IF NOT EXISTS operation_keys (
+		op_key     varchar(36) primary key,
+		operation  varchar(32) not null,
+		request    varchar(64) not null,
+		result     text not null,
+		created_at timestamptz default now() not null)`,
+}
+
+// ledgerSchema объекты ledger склада (таблица storage<id склада>), %[1]d - id склада
+// Выполняются при создании склада и методом Wms.Migrate для всех существующих складов
+var ledgerSchema = []string{
+	`CREATE TABLE IF NOT EXISTS storage%[1]d (
+		doc_id   integer default 0 not null,
+		doc_type smallint default 0 not null,
+		row_id   varchar(36) default ''::character varying not null,
+		row_time timestamptz default now() not null,
+		zone_id  integer,
+		cell_id  integer constraint storage%[1]d_cells_id_fk references cells,
+		prod_id  integer,
+		quantity integer)`,
+	`ALTER TABLE storage%[1]d ADD COLUMN IF NOT EXISTS user_id integer default 0 not null`,
+	`ALTER TABLE storage%[1]d ADD COLUMN IF NOT EXISTS terminal varchar(64) default '' not null`,
+	`ALTER TABLE storage%[1]d ADD COLUMN IF NOT EXISTS lot varchar(64) default '' not null`,
+	`CREATE INDEX IF NOT EXISTS storage%[1]d_row_time_idx ON storage%[1]d (row_time)`,
+	`CREATE INDEX IF NOT EXISTS storage%[1]d_row_id_idx ON storage%[1]d (row_id) WHERE row_id <> ''`,
+}
+
+// sqliteSchema полная схема БД SQLite, включая справочники, которые в PostgreSQL создаются вне модуля
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS manufacturers (
+		id   integer primary key autoincrement,
+		name text default '' not null)`,
+	`CREATE TABLE IF NOT EXISTS products (
+		id              integer primary key autoincrement,
+		name            text default '' not null,
+		item_number     text default '' not null,
+		manufacturer_id integer default 0 not null)`,
+	`CREATE TABLE IF NOT EXISTS barcodes (
+		id           integer primary key autoincrement,
+		name         text not null,
+		barcode_type integer default 0 not null,
+		owner_id     integer default 0 not null,
+		owner_ref    text default '' not null)`,
+	`CREATE INDEX IF NOT EXISTS barcodes_name_idx ON barcodes (name)`,
+	`CREATE TABLE IF NOT EXISTS warehouses (
+		id      integer primary key autoincrement,
+		name    text default '' not null,
+		address text default '' not null)`,
+	`CREATE TABLE IF NOT EXISTS users (
+		id   integer primary key autoincrement,
+		name text default '' not null)`,
+	`CREATE TABLE IF NOT EXISTS zones (
+		id       integer primary key autoincrement,
+		name     text default '' not null,
+		type     integer default 0 not null,
+		owner_id integer default 0 not null)`,
+	`CREATE TABLE IF NOT EXISTS cells (
+		id              integer primary key autoincrement,
+		name            text default '' not null,
+		whs_id          integer default 0 not null,
+		zone_id         integer default 0 not null,
+		section_id      integer default 0 not null,
+		passage_id      integer default 0 not null,
+		rack_id         integer default 0 not null,
+		floor           integer default 0 not null,
+		number          integer default 0 not null,
+		is_size_free    boolean default false not null,
+		is_weight_free  boolean default false not null,
+		not_allowed_in  boolean default false not null,
+		not_allowed_out boolean default false not null,
+		is_service      boolean default false not null)`,
+	`CREATE TABLE IF NOT EXISTS cell_name_formats (
+		whs_id  integer not null,
+		zone_id integer default 0 not null,
+		format  text not null,
+		PRIMARY KEY (whs_id, zone_id))`,
+	`CREATE TABLE IF NOT EXISTS whs_layouts (
+		whs_id integer primary key,
+		layout text not null)`,
+	`CREATE TABLE IF NOT EXISTS waves (
+		id         integer primary key autoincrement,
+		whs_id     integer not null,
+		status     smallint default 0 not null,
+		plan       text not null,
+		created_at timestamp default (strftime('%Y-%m-%d %H:%M:%f', 'now')) not null,
+		updated_at timestamp default (strftime('%Y-%m-%d %H:%M:%f', 'now')) not null)`,
+	`CREATE TABLE IF NOT EXISTS pick_faces (
+		cell_id integer not null references cells,
+		prod_id integer not null,
+		min_qty integer default 0 not null,
+		max_qty integer default 0 not null,
+		PRIMARY KEY (cell_id, prod_id))`,
+	`CREATE TABLE IF NOT EXISTS product_classes (
+		whs_id    integer not null,
+		prod_id   integer not null,
+		abc_class varchar(1) not null,
+		xyz_class varchar(1) not null,
+		PRIMARY KEY (whs_id, prod_id))`,
+	`CREATE TABLE IF NOT EXISTS external_ids (
+		system  varchar(32) not null,
+		entity  varchar(32) not null,
+		ext_key varchar(128) not null,
+		id      integer not null,
+		PRIMARY KEY (system, entity, ext_key))`,
+	`CREATE INDEX IF NOT EXISTS external_ids_entity_idx ON external_ids (entity, id)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id         integer primary key autoincrement,
+		entity     varchar(32) not null,
+		entity_id  integer not null,
+		action     varchar(16) not null,
+		changes    text not null,
+		user_id    integer default 0 not null,
+		created_at timestamp default (strftime('%Y-%m-%d %H:%M:%f', 'now')) not null)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity, entity_id)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at)`,
+	`CREATE TABLE IF NOT EXISTS operation_keys (
+		op_key     varchar(36) primary key,
+		operation  varchar(32) not null,
+		request    varchar(64) not null,
+		result     text not null,
+		created_at timestamp default (strftime('%Y-%m-%d %H:%M:%f', 'now')) not null)`,
+}
+
+// sqliteColumns колонки, добавленные в таблицы SQLite после их создания
+// SQLite не поддерживает ADD COLUMN IF NOT EXISTS, поэтому Migrate добавляет только отсутствующие колонки
+var sqliteColumns = []struct {
+	table, column, def string
+}{
+	{"products", "archived_at", "timestamp"},
+	{"manufacturers", "archived_at", "timestamp"},
+	{"warehouses", "archived_at", "timestamp"},
+	{"users", "archived_at", "timestamp"},
+	{"products", "version", "integer default 1 not null"},
+	{"manufacturers", "version", "integer default 1 not null"},
+	{"barcodes", "version", "integer default 1 not null"},
+	{"warehouses", "version", "integer default 1 not null"},
+	{"users", "version", "integer default 1 not null"},
+	{"cells", "version", "integer default 1 not null"},
+	{"cells", "max_weight", "real default 0 not null"},
+	{"cells", "max_volume", "real default 0 not null"},
+	{"products", "weight", "real default 0 not null"},
+	{"products", "volume", "real default 0 not null"},
+	{"audit_log", "terminal", "varchar(64) default '' not null"},
+	{"waves", "user_id", "integer default 0 not null"},
+	{"waves", "terminal", "varchar(64) default '' not null"},
+	{"waves", "status_user_id", "integer default 0 not null"},
+	{"waves", "status_terminal", "varchar(64) default '' not null"},
+}
+
+// sqliteLedgerColumns колонки, добавленные в ledger SQLite после его создания, см. sqliteColumns
+var sqliteLedgerColumns = []struct {
+	column, def string
+}{
+	{"terminal", "varchar(64) default '' not null"},
+	{"lot", "varchar(64) default '' not null"},
+}
+
+// sqliteLedgerSchema объекты ledger склада в SQLite, %[1]d - id склада
+// Время хранится строкой в UTC (sqliteTimeLayout)
+var sqliteLedgerSchema = []string{
+	`CREATE TABLE IF NOT EXISTS storage%[1]d (
+		doc_id   integer default 0 not null,
+		doc_type smallint default 0 not null,
+		row_id   varchar(36) default '' not null,
+		row_time timestamp default (strftime('%%Y-%%m-%%d %%H:%%M:%%f', 'now')) not null,
+		zone_id  integer,
+		cell_id  integer constraint storage%[1]d_cells_id_fk references cells,
+		prod_id  integer,
+		quantity integer,
+		user_id  integer default 0 not null)`,
+	`CREATE INDEX IF NOT EXISTS storage%[1]d_row_time_idx ON storage%[1]d (row_time)`,
+	`CREATE INDEX IF NOT EXISTS storage%[1]d_cell_prod_idx ON storage%[1]d (cell_id, prod_id)`,
+	`CREATE INDEX IF NOT EXISTS storage%[1]d_row_id_idx ON storage%[1]d (row_id) WHERE row_id <> ''`,
+}
+
+// Migrate создает (при отсутствии) объекты БД, необходимые модулю
+func (w *Wms) Migrate(ctx context.Context) error {
+	stmts := schema
+	if w.dialect == DialectSQLite {
+		stmts = sqliteSchema
+	}
+	for _, stmt := range stmts {
+		if _, err := w.Db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if w.dialect == DialectSQLite {
+		if err := w.migrateSqliteColumns(ctx); err != nil {
+			return err
+		}
+	}
+	rows, err := w.Db.QueryContext(ctx, "SELECT id FROM warehouses")
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err = w.migrateLedger(ctx, w.Db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateSqliteColumns добавляет отсутствующие колонки sqliteColumns
+func (w *Wms) migrateSqliteColumns(ctx context.Context) error {
+	for _, c := range sqliteColumns {
+		if err := addSqliteColumn(ctx, w.Db, c.table, c.column, c.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// addSqliteColumn добавляет в таблицу SQLite table колонку column с определением def, если ее нет
+func addSqliteColumn(ctx context.Context, db dbtx, table, column, def string) error {
+	var n int
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM pragma_table_info($1) WHERE name = $2", table, column).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def))
+	return err
+}
+
+// migrateLedger создает или обновляет ledger склада whsId
+func (w *Wms) migrateLedger(ctx context.Context, db dbtx, whsId int64) error {
+	if w.dialect != DialectSQLite {
+		for _, stmt := range ledgerSchema {
+			if _, err := db.ExecContext(ctx, fmt.Sprintf(stmt, whsId)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, stmt := range sqliteLedgerSchema {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(stmt, whsId)); err != nil {
+			return err
+		}
+	}
+	for _, c := range sqliteLedgerColumns {
+		if err := addSqliteColumn(ctx, db, fmt.Sprintf("storage%d", whsId), c.column, c.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package whs
+
+import (
+	"context"
+	"fmt"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"time"
+)
+
+// GetPickFrequency возвращает количество отборов (расходных строк ledger) по продуктам склада whsId за период
+func (s *Storage) GetPickFrequency(ctx context.Context, whsId int64, from time.Time, to time.Time) (map[int64]int, error) {
+	picks := make(map[int64]int)
+	sqlSel := fmt.Sprintf("SELECT prod_id, COUNT(*) FROM storage%d "+
+		"WHERE quantity < 0 AND doc_type IN (%d, %d) AND row_time >= $1 AND row_time < $2 GROUP BY prod_id", whsId, DocTypeUnknown, DocTypeOutbound)
+	rows, err := s.db().QueryContext(ctx, sqlSel, s.wms.timeArg(from), s.wms.timeArg(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var productId int64
+		var count int
+		if err = rows.Scan(&productId, &count); err != nil {
+			return nil, err
+		}
+		picks[productId] = count
+	}
+	return picks, rows.Err()
+}
+
+// AnalyzeSlotting анализирует размещение продуктов склада whsId по частоте отборов за период
+// и возвращает план переразмещения с ожидаемым сокращением пути
+func (s *Storage) AnalyzeSlotting(ctx context.Context, whsId int64, from time.Time, to time.Time, opts model.SlottingOptions) (*model.SlottingPlan, error) {
+	layout, err := s.GetLayout(ctx, whsId)
+	if err != nil {
+		return nil, err
+	}
+	picks, err := s.GetPickFrequency(ctx, whsId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := s.GetCellStocks(ctx, whsId, nil)
+	if err != nil {
+		return nil, err
+	}
+	return model.PlanSlotting(layout, picks, stock, opts)
+}
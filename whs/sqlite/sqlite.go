@@ -0,0 +1,65 @@
+// Package sqlite хранилище Wms в файле SQLite (драйвер modernc.org/sqlite, без cgo)
+// для небольших складов, работающих на одном компьютере без сервера PostgreSQL
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/mlplabs/mwms-core/whs"
+	"net/url"
+	"strings"
+
+	"modernc.org/sqlite"
+)
+
+// DriverName имя драйвера database/sql
+const DriverName = "sqlite"
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction(whs.SQLiteLower, 1, lower)
+}
+
+// lower функция whs.SQLiteLower: строка в нижнем регистре с учетом Unicode, прочие значения без изменений
+func lower(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	switch v := args[0].(type) {
+	case string:
+		return strings.ToLower(v), nil
+	case []byte:
+		return strings.ToLower(string(v)), nil
+	}
+	return args[0], nil
+}
+
+// BusyTimeout время ожидания (мс) освобождения базы, заблокированной другим соединением
+var BusyTimeout = 5000
+
+// Open открывает (создает) базу SQLite в файле path и возвращает Wms со схемой, готовой к работе
+// Транзакции начинаются с блокировки записи (BEGIN IMMEDIATE), что исключает взаимоблокировки
+// при конкурентных изменениях, включены внешние ключи и журнал WAL
+func Open(ctx context.Context, path string) (*whs.Wms, error) {
+	db, err := sql.Open(DriverName, dsn(path))
+	if err != nil {
+		return nil, err
+	}
+	w := whs.NewWmsDialect(db, whs.DialectSQLite)
+	if err = w.Migrate(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func dsn(path string) string {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", BusyTimeout))
+	params.Set("_txlock", "immediate")
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return "file:" + path + sep + params.Encode()
+}
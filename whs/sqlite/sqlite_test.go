@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/mlplabs/mwms-core/whs"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"github.com/mlplabs/mwms-core/whs/repotest"
+	"path/filepath"
+	"testing"
+)
+
+func open(t *testing.T) *whs.Wms {
+	t.Helper()
+	w, err := Open(context.Background(), filepath.Join(t.TempDir(), "wms.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Db.Close() })
+	return w
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) whs.Repository { return whs.NewStorage(open(t)) })
+}
+
+func TestStorage(t *testing.T) {
+	repotest.RunStorage(t, open)
+}
+
+func TestOpen_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "wms.db")
+	w, err := Open(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	whsId, err := whs.NewStorage(w).CreateWarehouse(ctx, &model.Warehouse{Name: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Db.Close()
+
+	// повторная миграция существующей базы
+	if w, err = Open(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Db.Close()
+	if item, err := whs.NewStorage(w).GetWarehouseById(ctx, whsId); err != nil || item.Name != "main" {
+		t.Errorf("GetWarehouseById = %+v, %v", item, err)
+	}
+}
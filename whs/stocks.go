@@ -0,0 +1,198 @@
+package whs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"strings"
+)
+
+// stockSortColumns колонки сортировки остатков
+var stockSortColumns = map[string]string{
+	model.StockSortProduct:      "st.prod_name",
+	model.StockSortManufacturer: "st.mnf_name",
+	model.StockSortZone:         "st.zone_name",
+	model.StockSortCell:         "st.cell_name",
+	model.StockSortQuantity:     "st.quantity",
+}
+
+// stockCursor позиция последней строки страницы
+type stockCursor struct {
+	Name     string `json:"s,omitempty"`
+	Quantity int64  `json:"q,omitempty"`
+	ProdId   int64  `json:"p"`
+	ZoneId   int64  `json:"z"`
+	CellId   int64  `json:"c"`
+}
+
+func (c *stockCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeStockCursor(s string) (*stockCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, &core.Error{Kind: core.ErrValidation, Msg: "invalid cursor", Err: err}
+	}
+	c := stockCursor{}
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, &core.Error{Kind: core.ErrValidation, Msg: "invalid cursor", Err: err}
+	}
+	return &c, nil
+}
+
+// QueryStocks возвращает страницу остатков склада по фильтру с группировкой и сортировкой
+// Выполняется одним запросом, пагинация по курсору (keyset)
+func (s *Storage) QueryStocks(ctx context.Context, q *model.StockQuery) (*model.StockPage, error) {
+	f := &q.Filter
+	if f.WhsId == 0 {
+		return nil, core.Validation(tableWarehouses, 0, "unacceptable action. whs id eq 0")
+	}
+	sortKey := q.Sort
+	if sortKey == "" {
+		sortKey = model.StockSortProduct
+	}
+	sortCol, ok := stockSortColumns[sortKey]
+	if !ok {
+		return nil, core.Validation("", 0, "unknown stock sort %q", q.Sort)
+	}
+
+	// колонки зоны и ячейки и выражения группировки зависят от уровня группировки
+	zoneCols := "0 AS zone_id, '' AS zone_name"
+	cellCols := "0 AS cell_id, '' AS cell_name, 0 AS section_id, 0 AS passage_id, 0 AS rack_id, 0 AS floor, 0 AS number"
+	groupBy := "s.prod_id, p.name, m.id, m.name"
+	switch q.Group {
+	case model.StockGroupCell:
+		zoneCols = "s.zone_id AS zone_id, coalesce(z.name, '<unnamed>') AS zone_name"
+		// адрес ячейки - для имени ячейки без сохраненного имени (Cell.SetName)
+		cellCols = "s.cell_id AS cell_id, coalesce(c.name, '') AS cell_name, coalesce(c.section_id, 0) AS section_id, " +
+			"coalesce(c.passage_id, 0) AS passage_id, coalesce(c.rack_id, 0) AS rack_id, coalesce(c.floor, 0) AS floor, coalesce(c.number, 0) AS number"
+		groupBy += ", s.zone_id, z.name, s.cell_id, c.name, c.section_id, c.passage_id, c.rack_id, c.floor, c.number"
+	case model.StockGroupProductZone:
+		zoneCols = "s.zone_id AS zone_id, coalesce(z.name, '<unnamed>') AS zone_name"
+		groupBy += ", s.zone_id, z.name"
+	case model.StockGroupProduct:
+	default:
+		return nil, core.Validation("", 0, "unknown stock group %d", q.Group)
+	}
+
+	args := make([]any, 0)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	cond := make([]string, 0)
+	if len(f.ZoneIds) > 0 {
+		cond = append(cond, s.wms.inArray("s.zone_id", arg(s.wms.arrayArg(f.ZoneIds))))
+	}
+	if len(f.ProductIds) > 0 {
+		cond = append(cond, s.wms.inArray("s.prod_id", arg(s.wms.arrayArg(f.ProductIds))))
+	}
+	if len(f.ManufacturerIds) > 0 {
+		cond = append(cond, s.wms.inArray("p.manufacturer_id", arg(s.wms.arrayArg(f.ManufacturerIds))))
+	}
+	if f.Lot != "" {
+		cond = append(cond, "s.lot = "+arg(f.Lot))
+	}
+	if f.CellFrom != "" {
+		cond = append(cond, "c.name >= "+arg(f.CellFrom))
+	}
+	if f.CellTo != "" {
+		cond = append(cond, "c.name <= "+arg(f.CellTo))
+	}
+	sqlWhere := ""
+	if len(cond) > 0 {
+		sqlWhere = "WHERE " + strings.Join(cond, " AND ")
+	}
+
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	sqlCursor := ""
+	if q.Cursor != "" {
+		c, err := decodeStockCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		var last any = c.Name
+		if sortKey == model.StockSortQuantity {
+			last = c.Quantity
+		}
+		sqlCursor = fmt.Sprintf("WHERE (%s, st.prod_id, st.zone_id, st.cell_id) %s (%s, %s, %s, %s)",
+			sortCol, cmp, arg(last), arg(c.ProdId), arg(c.ZoneId), arg(c.CellId))
+	}
+	sqlLimit := ""
+	if q.Limit > 0 {
+		// лишняя строка - признак наличия следующей страницы
+		sqlLimit = "LIMIT " + arg(q.Limit+1)
+	}
+
+	sqlSel := fmt.Sprintf("SELECT st.prod_id, st.prod_name, st.mnf_id, st.mnf_name, st.zone_id, st.zone_name, st.cell_id, st.cell_name, "+
+		"       st.section_id, st.passage_id, st.rack_id, st.floor, st.number, st.quantity "+
+		"FROM (SELECT s.prod_id, coalesce(p.name, '<unnamed>') AS prod_name, "+
+		"             coalesce(m.id, 0) AS mnf_id, coalesce(m.name, '<unnamed>') AS mnf_name, "+
+		"             %s, %s, SUM(s.quantity) AS quantity "+
+		"      FROM storage%d s "+
+		"      LEFT JOIN products p ON s.prod_id = p.id "+
+		"      LEFT JOIN manufacturers m ON p.manufacturer_id = m.id "+
+		"      LEFT JOIN zones z ON s.zone_id = z.id "+
+		"      LEFT JOIN cells c ON s.cell_id = c.id "+
+		"      %s "+
+		"      GROUP BY %s "+
+		"      HAVING SUM(s.quantity) <> 0) AS st "+
+		"%s "+
+		"ORDER BY %s %s, st.prod_id %s, st.zone_id %s, st.cell_id %s %s",
+		zoneCols, cellCols, f.WhsId, sqlWhere, groupBy, sqlCursor, sortCol, dir, dir, dir, dir, sqlLimit)
+
+	rows, err := s.db().QueryContext(ctx, sqlSel, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &model.StockPage{Rows: make([]model.RowStock, 0)}
+	for rows.Next() {
+		if q.Limit > 0 && len(page.Rows) == q.Limit {
+			last := page.Rows[len(page.Rows)-1]
+			c := stockCursor{ProdId: last.Product.Id, ZoneId: last.Zone.Id}
+			if len(last.Cells) > 0 {
+				c.CellId = last.Cells[0].Id
+			}
+			switch sortKey {
+			case model.StockSortProduct:
+				c.Name = last.Product.Name
+			case model.StockSortManufacturer:
+				c.Name = last.Product.Manufacturer.Name
+			case model.StockSortZone:
+				c.Name = last.Zone.Name
+			case model.StockSortCell:
+				if len(last.Cells) > 0 {
+					c.Name = last.Cells[0].Name
+				}
+			case model.StockSortQuantity:
+				c.Quantity = last.Quantity
+			}
+			page.NextCursor = c.encode()
+			break
+		}
+		row := model.RowStock{Cells: make([]model.Cell, 0)}
+		cell := model.Cell{}
+		err = rows.Scan(&row.Product.Id, &row.Product.Name, &row.Product.Manufacturer.Id, &row.Product.Manufacturer.Name,
+			&row.Zone.Id, &row.Zone.Name, &cell.Id, &cell.Name,
+			&cell.SectionId, &cell.PassageId, &cell.RackId, &cell.Floor, &cell.Number, &row.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		if cell.Id != 0 {
+			cell.WhsId, cell.ZoneId = f.WhsId, row.Zone.Id
+			row.Cells = append(row.Cells, cell)
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	return page, rows.Err()
+}
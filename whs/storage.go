@@ -3,57 +3,171 @@ package whs
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"hash/fnv"
+)
+
+// Типы строк ledger (doc_type)
+const (
+	DocTypeUnknown  = iota
+	DocTypeInbound  // размещение (PutItemToCell)
+	DocTypeOutbound // отбор (GetItemFromCell)
+	DocTypeMove     // перемещение (MoveItemToCell)
 )
 
 type Storage struct {
 	wms *Wms
+	tx  *Tx // единица работы, в которой выполняются операции (nil - вне транзакции)
 }
 
 func NewStorage(s *Wms) *Storage {
 	return &Storage{wms: s}
 }
 
-func (s *Storage) balanceControl(ctx context.Context, whsId int64, itemId int64, cellId int64, tx *sql.Tx) (bool, error) {
-	var balance int
-	sqlCtrl := fmt.Sprintf("SELECT SUM(quantity) AS quantity "+
-		"FROM storage%d WHERE cell_id = $1 AND prod_id = $2 "+
-		"GROUP BY cell_id, prod_id "+
-		"HAVING SUM(quantity) < 0", whsId)
-	row := tx.QueryRowContext(ctx, sqlCtrl, cellId, itemId)
-	err := row.Scan(&balance)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return true, nil
-		}
+// lockStock блокирует остаток продукта itemId в ячейке cellId склада whsId до конца транзакции tx
+// Конкурентные списания из одной ячейки выполняются последовательно, и balanceControl каждого
+// видит строки ledger, зафиксированные предыдущими (в READ COMMITTED без блокировки оба списания
+// проходят контроль, не видя незафиксированных строк друг друга). Блокировка общая для всех партий:
+// списание партии контролирует и остаток партии, и общий остаток продукта в ячейке
+func (s *Storage) lockStock(ctx context.Context, whsId int64, itemId int64, cellId int64, tx *sql.Tx) error {
+	return s.lock(ctx, tx, fmt.Sprintf("storage%d:%d:%d", whsId, cellId, itemId))
+}
+
+// lock блокирует имя name до конца транзакции tx
+func (s *Storage) lock(ctx context.Context, tx *sql.Tx, name string) error {
+	sqlLock := s.wms.advisoryLock()
+	if sqlLock == "" {
+		return nil
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	_, err := tx.ExecContext(ctx, sqlLock, int64(h.Sum64()))
+	return err
+}
+
+// Направления движения продукта для checkCell
+const (
+	cellIn  = iota // размещение в ячейку
+	cellOut        // отбор из ячейки
+)
+
+// checkCell проверяет, что ячейка cellId (cell, см. Wms.GetCellInfo) существует и открыта для движения dir
+func checkCell(cell *model.Cell, cellId int64, dir int) error {
+	switch {
+	case cell.Id == 0:
+		return core.NotFound(tableCells, cellId)
+	case dir == cellIn && cell.NotAllowedIn:
+		return core.CellBlocked(cellId, "placement into cell %s is not allowed", cell.Name)
+	case dir == cellOut && cell.NotAllowedOut:
+		return core.CellBlocked(cellId, "picking from cell %s is not allowed", cell.Name)
+	}
+	return nil
+}
+
+// balanceControl проверяет, что остаток продукта itemId в ячейке cellId не отрицательный
+// Для партии lot ("" - партия не задана) дополнительно проверяется остаток партии в ячейке
+func (s *Storage) balanceControl(ctx context.Context, whsId int64, itemId int64, cellId int64, lot string, tx *sql.Tx) (bool, error) {
+	var balance, lotBalance int
+	sqlCtrl := fmt.Sprintf("SELECT coalesce(SUM(quantity), 0), coalesce(SUM(CASE WHEN lot = $3 THEN quantity ELSE 0 END), 0) "+
+		"FROM storage%d WHERE cell_id = $1 AND prod_id = $2", whsId)
+	if err := tx.QueryRowContext(ctx, sqlCtrl, cellId, itemId, lot).Scan(&balance, &lotBalance); err != nil {
 		return false, err
 	}
-	return false, fmt.Errorf("balance control failed %d", balance)
+	if balance < 0 {
+		return false, &core.StockError{WhsId: whsId, CellId: cellId, ProductId: itemId, Balance: balance}
+	}
+	if lot != "" && lotBalance < 0 {
+		return false, &core.StockError{WhsId: whsId, CellId: cellId, ProductId: itemId, Lot: lot, Balance: lotBalance}
+	}
+	return true, nil
+}
+
+// capacityTolerance допустимая погрешность суммирования веса и объема продуктов ячейки
+const capacityTolerance = 1e-6
+
+// limited возвращает true, если для ячейки cell контролируется вес или объем размещенных продуктов
+func limited(cell *model.Cell) bool {
+	return (cell.MaxWeight > 0 && !cell.IsWeightFree) || (cell.MaxVolume > 0 && !cell.IsSizeFree)
+}
+
+// lockCapacity блокирует размещение в ячейку cell склада whsId до конца транзакции tx, если ее вместимость ограничена
+// Конкурентные размещения в одну ячейку выполняются последовательно, и capacityControl каждого видит предыдущие
+func (s *Storage) lockCapacity(ctx context.Context, whsId int64, cell *model.Cell, tx *sql.Tx) error {
+	if !limited(cell) {
+		return nil
+	}
+	return s.lock(ctx, tx, fmt.Sprintf("storage%d:%d", whsId, cell.Id))
+}
+
+// capacityControl проверяет, что вес и объем продуктов в ячейке cell не превышают ее ограничений
+// (MaxWeight, MaxVolume). Ячейки с IsWeightFree/IsSizeFree не проверяются по весу/объему
+func (s *Storage) capacityControl(ctx context.Context, whsId int64, cell *model.Cell, tx *sql.Tx) error {
+	if !limited(cell) {
+		return nil
+	}
+	var weight, volume float64
+	sqlLoad := fmt.Sprintf("SELECT coalesce(SUM(st.quantity * p.weight), 0), coalesce(SUM(st.quantity * p.volume), 0) "+
+		"FROM storage%d st JOIN products p ON p.id = st.prod_id WHERE st.cell_id = $1", whsId)
+	if err := tx.QueryRowContext(ctx, sqlLoad, cell.Id).Scan(&weight, &volume); err != nil {
+		return err
+	}
+	if cell.MaxWeight > 0 && !cell.IsWeightFree && weight > cell.MaxWeight+capacityTolerance {
+		return core.CapacityExceeded(cell.Id, "weight %g kg exceeds cell %s limit %g kg", weight, cell.Name, cell.MaxWeight)
+	}
+	if cell.MaxVolume > 0 && !cell.IsSizeFree && volume > cell.MaxVolume+capacityTolerance {
+		return core.CapacityExceeded(cell.Id, "volume %g cm3 exceeds cell %s limit %g cm3", volume, cell.Name, cell.MaxVolume)
+	}
+	return nil
 }
 
 // GetItemFromCell отбирает из ячейки (cellId) продукт (itemId) в количестве (quantity)
-// Возвращает отобранное количество (quantity)
+// Возвращает отобранное количество (quantity). Отбор из ячейки с NotAllowedOut - core.ErrCellBlocked
 func (s *Storage) GetItemFromCell(ctx context.Context, itemId int64, cellId int64, quantity int) (int, error) {
-	tx, err := s.wms.Db.Begin()
+	userId, terminal, err := actorOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+	lot := Lot(ctx)
+	if err = CheckLot(lot); err != nil {
+		return 0, err
+	}
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	cell, err := s.wms.GetCellInfo(ctx, cellId, tx)
+	cell, err := s.wms.GetCellInfo(ctx, cellId, tx.Tx)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
 	}
+	if err = checkCell(cell, cellId, cellOut); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	key := IdempotencyKey(ctx)
+	if key != "" {
+		if q, ok, err := s.replay(ctx, tx.Tx, cell.WhsId, key, DocTypeOutbound, itemId, cellId, 0, quantity); err != nil || ok {
+			return s.finishReplay(tx, q, err)
+		}
+	}
 
-	sqlInsert := fmt.Sprintf("INSERT INTO storage%d (prod_id, zone_id, cell_id, quantity) VALUES ($1, $2, $3, $4)", cell.WhsId)
-	_, err = tx.Exec(sqlInsert, itemId, cell.ZoneId, cellId, -1*quantity)
+	if err = s.lockStock(ctx, cell.WhsId, itemId, cellId, tx.Tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	sqlInsert := fmt.Sprintf("INSERT INTO storage%d (prod_id, zone_id, cell_id, quantity, doc_type, row_id, user_id, terminal, lot) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", cell.WhsId)
+	_, err = tx.ExecContext(ctx, sqlInsert, itemId, cell.ZoneId, cellId, -1*quantity, DocTypeOutbound, key, userId, terminal, lot)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
 	}
 
-	_, err = s.balanceControl(ctx, cell.WhsId, itemId, cellId, tx)
+	_, err = s.balanceControl(ctx, cell.WhsId, itemId, cellId, lot, tx.Tx)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
@@ -67,44 +181,92 @@ func (s *Storage) GetItemFromCell(ctx context.Context, itemId int64, cellId int6
 }
 
 // PutItemToCell размещает в ячейку (CellId) продукт (ItemId) в количестве (Quantity)
-// Возвращает количество которое было размещено (Quantity)
+// Возвращает количество которое было размещено (Quantity). Размещение в ячейку с NotAllowedIn - core.ErrCellBlocked,
+// сверх допустимого веса или объема ячейки - core.ErrCapacityExceeded
 func (s *Storage) PutItemToCell(ctx context.Context, itemId int64, cellId int64, quantity int) (int, error) {
-	tx, err := s.wms.Db.Begin()
+	userId, terminal, err := actorOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+	lot := Lot(ctx)
+	if err = CheckLot(lot); err != nil {
+		return 0, err
+	}
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	cell, err := s.wms.GetCellInfo(ctx, cellId, tx)
+	cell, err := s.wms.GetCellInfo(ctx, cellId, tx.Tx)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
 	}
+	if err = checkCell(cell, cellId, cellIn); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
 
-	sqlIns := fmt.Sprintf("INSERT INTO storage%d (prod_id, zone_id, cell_id, quantity) VALUES ($1, $2, $3, $4)", cell.WhsId)
-	_, err = tx.ExecContext(ctx, sqlIns, itemId, cell.ZoneId, cellId, quantity)
+	key := IdempotencyKey(ctx)
+	if key != "" {
+		if q, ok, err := s.replay(ctx, tx.Tx, cell.WhsId, key, DocTypeInbound, itemId, cellId, 0, quantity); err != nil || ok {
+			return s.finishReplay(tx, q, err)
+		}
+	}
+
+	if err = s.lockCapacity(ctx, cell.WhsId, cell, tx.Tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	sqlIns := fmt.Sprintf("INSERT INTO storage%d (prod_id, zone_id, cell_id, quantity, doc_type, row_id, user_id, terminal, lot) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", cell.WhsId)
+	_, err = tx.ExecContext(ctx, sqlIns, itemId, cell.ZoneId, cellId, quantity, DocTypeInbound, key, userId, terminal, lot)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
 	}
+	if err = s.capacityControl(ctx, cell.WhsId, cell, tx.Tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
 	err = tx.Commit()
 	if err != nil {
 		return 0, err
 	}
 	return quantity, nil
 }
+
+// MoveItemToCell перемещает продукт (itemId) из ячейки cellSrcId в ячейку cellDstId в количестве (quantity)
+// Возвращает перемещенное количество. Источник с NotAllowedOut или получатель с NotAllowedIn - core.ErrCellBlocked,
+// перемещение сверх допустимого веса или объема получателя - core.ErrCapacityExceeded
 func (s *Storage) MoveItemToCell(ctx context.Context, itemId int64, cellSrcId int64, cellDstId int64, quantity int) (int, error) {
-	tx, err := s.wms.Db.Begin()
+	userId, terminal, err := actorOf(ctx)
+	if err != nil {
+		return 0, err
+	}
+	lot := Lot(ctx)
+	if err = CheckLot(lot); err != nil {
+		return 0, err
+	}
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	cellSrc, err := s.wms.GetCellInfo(ctx, cellSrcId, tx)
+	cellSrc, err := s.wms.GetCellInfo(ctx, cellSrcId, tx.Tx)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
 	}
 
-	cellDst, err := s.wms.GetCellInfo(ctx, cellDstId, tx)
+	cellDst, err := s.wms.GetCellInfo(ctx, cellDstId, tx.Tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err = checkCell(cellSrc, cellSrcId, cellOut); err == nil {
+		err = checkCell(cellDst, cellDstId, cellIn)
+	}
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
@@ -112,27 +274,48 @@ func (s *Storage) MoveItemToCell(ctx context.Context, itemId int64, cellSrcId in
 
 	if cellDst.WhsId != cellSrc.WhsId {
 		// TODO: cellSrc.WhsId <> cellDst.WhsId - временной разрыв или виртуальное перемещение
-		return 0, fmt.Errorf("межскладское перемещение пока не реализовано(")
+		_ = tx.Rollback()
+		return 0, core.Validation(tableCells, cellDstId, "межскладское перемещение пока не реализовано(")
+	}
+
+	key := IdempotencyKey(ctx)
+	if key != "" {
+		if q, ok, err := s.replay(ctx, tx.Tx, cellSrc.WhsId, key, DocTypeMove, itemId, cellSrcId, cellDstId, quantity); err != nil || ok {
+			return s.finishReplay(tx, q, err)
+		}
 	}
 
-	sqlInsertSrc := fmt.Sprintf("INSERT INTO storage%d (prod_id, zone_id, cell_id, quantity) VALUES ($1, $2, $3, $4)", cellSrc.WhsId)
-	sqlInsertDst := fmt.Sprintf("INSERT INTO storage%d (prod_id, zone_id, cell_id, quantity) VALUES ($1, $2, $3, $4)", cellDst.WhsId)
+	if err = s.lockStock(ctx, cellSrc.WhsId, itemId, cellSrcId, tx.Tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err = s.lockCapacity(ctx, cellDst.WhsId, cellDst, tx.Tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	sqlInsertSrc := fmt.Sprintf("INSERT INTO storage%d (prod_id, zone_id, cell_id, quantity, doc_type, row_id, user_id, terminal, lot) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", cellSrc.WhsId)
+	sqlInsertDst := fmt.Sprintf("INSERT INTO storage%d (prod_id, zone_id, cell_id, quantity, doc_type, row_id, user_id, terminal, lot) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", cellDst.WhsId)
 
-	_, err = tx.Exec(sqlInsertSrc, itemId, cellSrc.ZoneId, cellSrcId, -1*quantity)
+	_, err = tx.ExecContext(ctx, sqlInsertSrc, itemId, cellSrc.ZoneId, cellSrcId, -1*quantity, DocTypeMove, key, userId, terminal, lot)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
 	}
-	_, err = tx.Exec(sqlInsertDst, itemId, cellDst.ZoneId, cellDstId, quantity)
+	_, err = tx.ExecContext(ctx, sqlInsertDst, itemId, cellDst.ZoneId, cellDstId, quantity, DocTypeMove, key, userId, terminal, lot)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
 	}
-	_, err = s.balanceControl(ctx, cellSrc.WhsId, itemId, cellSrcId, tx)
+	_, err = s.balanceControl(ctx, cellSrc.WhsId, itemId, cellSrcId, lot, tx.Tx)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
 	}
+	if err = s.capacityControl(ctx, cellDst.WhsId, cellDst, tx.Tx); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -140,3 +323,44 @@ func (s *Storage) MoveItemToCell(ctx context.Context, itemId int64, cellSrcId in
 	}
 	return quantity, nil
 }
+
+// finishReplay завершает транзакцию повторной операции: фиксирует без изменений или откатывает при ошибке err
+func (s *Storage) finishReplay(tx *txScope, quantity int, err error) (int, error) {
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return quantity, nil
+}
+
+// GetCellStocks возвращает положительные остатки продуктов productIds по ячейкам склада whsId
+// Пустой productIds - все продукты склада
+func (s *Storage) GetCellStocks(ctx context.Context, whsId int64, productIds []int64) ([]model.CellStock, error) {
+	items := make([]model.CellStock, 0)
+	sqlSel := fmt.Sprintf("SELECT st.prod_id, st.quantity, c.id, c.name, c.whs_id, c.zone_id, c.section_id, c.passage_id, c.rack_id, c.floor, c.number, "+
+		"c.is_size_free, c.is_weight_free, c.not_allowed_in, c.not_allowed_out, c.is_service "+
+		"FROM (SELECT s.cell_id, s.prod_id, SUM(s.quantity) AS quantity FROM storage%d s "+
+		"      WHERE %s = 0 OR %s "+
+		"      GROUP BY s.cell_id, s.prod_id HAVING SUM(s.quantity) > 0) AS st "+
+		"JOIN cells c ON c.id = st.cell_id "+
+		"ORDER BY st.prod_id, c.id", whsId, s.wms.arrayLen("$1"), s.wms.inArray("s.prod_id", "$1"))
+	rows, err := s.db().QueryContext(ctx, sqlSel, s.wms.arrayArg(productIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		st := model.CellStock{}
+		c := &st.Cell
+		err = rows.Scan(&st.ProductId, &st.Quantity, &c.Id, &c.Name, &c.WhsId, &c.ZoneId, &c.SectionId, &c.PassageId, &c.RackId, &c.Floor, &c.Number,
+			&c.IsSizeFree, &c.IsWeightFree, &c.NotAllowedIn, &c.NotAllowedOut, &c.IsService)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, st)
+	}
+	return items, rows.Err()
+}
@@ -8,10 +8,11 @@ import (
 
 type Suggestions struct {
 	wms *Wms
+	db  dbtx // соединение запросов, см. Storage.db
 }
 
 func NewSuggestions(s *Wms) *Suggestions {
-	return &Suggestions{wms: s}
+	return &Suggestions{wms: s, db: s.Db}
 }
 
 func (s *Suggestions) GetSuggestion(ctx context.Context, refName string, text string, limit int) ([]model.Suggestion, error) {
@@ -20,8 +21,12 @@ func (s *Suggestions) GetSuggestion(ctx context.Context, refName string, text st
 		limit = DefaultSuggestionLimit
 	}
 
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE name ILIKE $1 LIMIT $2", refName)
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel, text+"%", limit)
+	sqlCond := ""
+	if archivable[refName] {
+		sqlCond = " AND archived_at IS NULL"
+	}
+	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE %s%s LIMIT $2", refName, s.wms.ilike("name", "$1"), sqlCond)
+	rows, err := s.db.QueryContext(ctx, sqlSel, text+"%", limit)
 	if err != nil {
 		return retVal, err
 	}
@@ -0,0 +1,122 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// dbtx общие методы *sql.DB и *sql.Tx, через которые Storage выполняет запросы
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Tx единица работы: все операции Storage, вызванные через Tx, выполняются в одной транзакции
+// Tx действителен только внутри функции, переданной в Wms.WithTx
+type Tx struct {
+	*Storage
+	sqlTx      *sql.Tx
+	savepoints int
+}
+
+// WithTx выполняет fn в транзакции. Транзакция фиксируется, если fn вернула nil,
+// и откатывается при ошибке, панике (паника передается дальше) или отмене контекста ctx
+func (w *Wms) WithTx(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	sqlTx, err := w.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := &Tx{sqlTx: sqlTx}
+	tx.Storage = &Storage{wms: w, tx: tx}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = sqlTx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// SqlTx возвращает транзакцию базы данных для запросов вне Storage
+func (tx *Tx) SqlTx() *sql.Tx {
+	return tx.sqlTx
+}
+
+// db возвращает соединение для запросов: транзакцию единицы работы или пул соединений
+func (s *Storage) db() dbtx {
+	if s.tx != nil {
+		return s.tx.sqlTx
+	}
+	return s.wms.Db
+}
+
+// unit выполняет fn в единице работы: новой или, внутри Tx, в точке сохранения текущей,
+// поэтому ошибка fn откатывает все ее изменения
+func (s *Storage) unit(ctx context.Context, fn func(s *Storage) error) error {
+	if s.tx != nil {
+		sp, err := s.begin(ctx)
+		if err != nil {
+			return err
+		}
+		if err = fn(s); err != nil {
+			_ = sp.Rollback()
+			return err
+		}
+		return sp.Commit()
+	}
+	return s.wms.WithTx(ctx, func(tx *Tx) error {
+		return fn(tx.Storage)
+	})
+}
+
+// txScope транзакция отдельной операции Storage. Вне единицы работы это собственная транзакция,
+// внутри Tx - точка сохранения, поэтому ошибка операции откатывает только ее изменения,
+// а фиксация происходит вместе с внешней транзакцией
+type txScope struct {
+	*sql.Tx
+	ctx       context.Context
+	savepoint string
+}
+
+// begin начинает транзакцию операции
+func (s *Storage) begin(ctx context.Context) (*txScope, error) {
+	if s.tx == nil {
+		sqlTx, err := s.wms.Db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &txScope{Tx: sqlTx, ctx: ctx}, nil
+	}
+	s.tx.savepoints++
+	sp := fmt.Sprintf("op_%d", s.tx.savepoints)
+	if _, err := s.tx.sqlTx.ExecContext(ctx, "SAVEPOINT "+sp); err != nil {
+		return nil, err
+	}
+	return &txScope{Tx: s.tx.sqlTx, ctx: ctx, savepoint: sp}, nil
+}
+
+func (t *txScope) Commit() error {
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+	_, err := t.Tx.ExecContext(t.ctx, "RELEASE SAVEPOINT "+t.savepoint)
+	return err
+}
+
+func (t *txScope) Rollback() error {
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+	_, err := t.Tx.ExecContext(t.ctx, "ROLLBACK TO SAVEPOINT "+t.savepoint)
+	return err
+}
@@ -2,9 +2,8 @@ package whs
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"github.com/lib/pq"
+	"github.com/mlplabs/mwms-core/core"
 	"github.com/mlplabs/mwms-core/whs/model"
 )
 
@@ -13,8 +12,8 @@ const tableUsers = "users"
 // GetUsers returns a list items without limit
 func (s *Storage) GetUsers(ctx context.Context) ([]model.User, error) {
 	users := make([]model.User, 0)
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s ORDER BY name ASC", tableUsers)
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel)
+	sqlSel := fmt.Sprintf("SELECT id, name, version FROM %s WHERE archived_at IS NULL ORDER BY name ASC", tableUsers)
+	rows, err := s.db().QueryContext(ctx, sqlSel)
 	if err != nil {
 		return users, err
 	}
@@ -22,7 +21,7 @@ func (s *Storage) GetUsers(ctx context.Context) ([]model.User, error) {
 
 	for rows.Next() {
 		usr := model.User{}
-		err = rows.Scan(&usr.Id, &usr.Name)
+		err = rows.Scan(&usr.Id, &usr.Name, &usr.Version)
 		users = append(users, usr)
 	}
 	return users, nil
@@ -32,7 +31,7 @@ func (s *Storage) GetUsers(ctx context.Context) ([]model.User, error) {
 func (s *Storage) GetUsersItems(ctx context.Context, offset int, limit int) ([]model.User, int64, error) {
 	var totalCount int64
 	users := make([]model.User, 0)
-	sqlCond := ""
+	sqlCond := "WHERE archived_at IS NULL"
 	args := make([]any, 0)
 
 	if limit == 0 {
@@ -41,9 +40,9 @@ func (s *Storage) GetUsersItems(ctx context.Context, offset int, limit int) ([]m
 	args = append(args, limit)
 	args = append(args, offset)
 
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s %s ORDER BY name ASC", tableUsers, sqlCond)
+	sqlSel := fmt.Sprintf("SELECT id, name, version FROM %s %s ORDER BY name ASC", tableUsers, sqlCond)
 
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel+" LIMIT $1 OFFSET $2", args...)
+	rows, err := s.db().QueryContext(ctx, sqlSel+" LIMIT $1 OFFSET $2", args...)
 	if err != nil {
 		return users, totalCount, err
 	}
@@ -51,12 +50,12 @@ func (s *Storage) GetUsersItems(ctx context.Context, offset int, limit int) ([]m
 
 	for rows.Next() {
 		usr := model.User{}
-		err = rows.Scan(&usr.Id, &usr.Name)
+		err = rows.Scan(&usr.Id, &usr.Name, &usr.Version)
 		users = append(users, usr)
 	}
 
 	sqlCount := fmt.Sprintf("SELECT COUNT(*) as count FROM ( %s ) sub", sqlSel)
-	err = s.wms.Db.QueryRowContext(ctx, sqlCount).Scan(&totalCount)
+	err = s.db().QueryRowContext(ctx, sqlCount).Scan(&totalCount)
 	if err != nil {
 		return users, totalCount, err
 	}
@@ -64,64 +63,65 @@ func (s *Storage) GetUsersItems(ctx context.Context, offset int, limit int) ([]m
 }
 
 func (s *Storage) CreateUser(ctx context.Context, user *model.User) (int64, error) {
+	return s.created(ctx, model.EntityUser, user, func(s *Storage) (int64, error) {
+		return s.createUser(ctx, user)
+	})
+}
+
+func (s *Storage) createUser(ctx context.Context, user *model.User) (int64, error) {
 	var insertId int64
 	sqlCreate := fmt.Sprintf("INSERT INTO %s (name) VALUES ($1) RETURNING id", tableUsers)
-	err := s.wms.Db.QueryRowContext(ctx, sqlCreate, user.Name).Scan(&insertId)
+	err := s.db().QueryRowContext(ctx, sqlCreate, user.Name).Scan(&insertId)
 	return insertId, err
 }
 
 func (s *Storage) UpdateUser(ctx context.Context, user *model.User) (int64, error) {
-	sqlUpd := fmt.Sprintf("UPDATE %s SET name=$2 WHERE id=$1", tableUsers)
-	res, err := s.wms.Db.ExecContext(ctx, sqlUpd, user.Id, user.Name)
-	if err != nil {
+	if err := CheckVersion(tableUsers, user.Id, user.Version); err != nil {
 		return 0, err
 	}
-	if a, err := res.RowsAffected(); a != 1 || err != nil {
+	return s.audited(ctx, model.EntityUser, model.AuditUpdate, user.Id, func(s *Storage) (int64, error) {
+		return s.updateUser(ctx, user)
+	})
+}
+
+func (s *Storage) updateUser(ctx context.Context, user *model.User) (int64, error) {
+	sqlUpd := fmt.Sprintf("UPDATE %s SET name=$2, version=version+1 WHERE id=$1 AND %s", tableUsers, versionCond(3))
+	res, err := s.db().ExecContext(ctx, sqlUpd, user.Id, user.Name, user.Version)
+	if err != nil {
 		return 0, err
 	}
-	return user.Id, nil
+	return s.updated(ctx, res, tableUsers, user.Id, user.Version)
 }
 
 func (s *Storage) DeleteUser(ctx context.Context, itemId int64) error {
 	if itemId == 0 {
-		return fmt.Errorf("unacceptable action. item id eq 0")
+		return core.Validation(tableUsers, 0, "unacceptable action. item id eq 0")
 	}
-	sqlDel := fmt.Sprintf("DELETE FROM %s WHERE id=$1", tableUsers)
-	_, err := s.wms.Db.ExecContext(ctx, sqlDel, itemId)
-	if err != nil {
-		var pgErr *pq.Error
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == ("23503") {
-				return err
-			}
-		}
-		return err
-	}
-	return nil
+	return s.deleteEntity(ctx, model.EntityUser, itemId)
 }
 
 func (s *Storage) GetUserById(ctx context.Context, itemId int64) (*model.User, error) {
-	sqlUsr := fmt.Sprintf("SELECT id, name FROM %s WHERE id = $1", tableUsers)
-	row := s.wms.Db.QueryRowContext(ctx, sqlUsr, itemId)
+	sqlUsr := fmt.Sprintf("SELECT id, name, archived_at, version FROM %s WHERE id = $1", tableUsers)
+	row := s.db().QueryRowContext(ctx, sqlUsr, itemId)
 	newItem := model.User{}
-	err := row.Scan(&newItem.Id, &newItem.Name)
+	err := row.Scan(&newItem.Id, &newItem.Name, scanNullTime(&newItem.ArchivedAt), &newItem.Version)
 	if err != nil {
-		return nil, err
+		return nil, core.Translate(tableUsers, itemId, err)
 	}
 	return &newItem, nil
 }
 
 func (s *Storage) FindUsersByName(ctx context.Context, itemName string) ([]model.User, error) {
 	users := make([]model.User, 0)
-	sql := fmt.Sprintf("SELECT id, name FROM %s WHERE name = $1", tableUsers)
-	rows, err := s.wms.Db.QueryContext(ctx, sql, itemName)
+	sql := fmt.Sprintf("SELECT id, name, version FROM %s WHERE name = $1", tableUsers)
+	rows, err := s.db().QueryContext(ctx, sql, itemName)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		usr := model.User{}
-		err = rows.Scan(&usr.Id, &usr.Name)
+		err = rows.Scan(&usr.Id, &usr.Name, &usr.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -136,8 +136,8 @@ func (s *Storage) UsersSuggest(ctx context.Context, text string, limit int) ([]m
 		limit = DefaultSuggestionLimit
 	}
 
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE name ILIKE $1 LIMIT $2", tableUsers)
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel, text+"%", limit)
+	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE %s AND archived_at IS NULL LIMIT $2", tableUsers, s.wms.ilike("name", "$1"))
+	rows, err := s.db().QueryContext(ctx, sqlSel, text+"%", limit)
 	if err != nil {
 		return retVal, err
 	}
@@ -0,0 +1,52 @@
+package whs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+)
+
+// Оптимистичная блокировка записей справочников и ячеек
+// Каждое изменение записи увеличивает ее версию (колонка version, поле Version модели).
+// Update* изменяет запись, только если ее версия не изменилась с момента чтения,
+// иначе возвращает ошибку core.ErrConflict. Безусловное изменение - явно с версией VersionAny,
+// не заданная версия (0) - ошибка core.ErrValidation
+
+// VersionAny версия для безусловного изменения записи без проверки версии
+const VersionAny int64 = -1
+
+// CheckVersion проверяет версию version изменяемой записи id сущности entity: прочитанная версия или VersionAny
+func CheckVersion(entity string, id int64, version int64) error {
+	if version <= 0 && version != VersionAny {
+		return core.Validation(entity, id, "record version %d is not set, use VersionAny to update unconditionally", version)
+	}
+	return nil
+}
+
+// versionCond условие WHERE проверки версии записи, переданной параметром $n
+func versionCond(n int) string {
+	return fmt.Sprintf("($%[1]d = %d OR version = $%[1]d)", n, VersionAny)
+}
+
+// updated возвращает результат изменения записи id таблицы table с версией version:
+// id - запись изменена, 0 - запись не найдена, core.ErrConflict - версия записи устарела
+func (s *Storage) updated(ctx context.Context, res sql.Result, table string, id int64, version int64) (int64, error) {
+	a, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if a == 1 {
+		return id, nil
+	}
+	var stored int64
+	err = s.db().QueryRowContext(ctx, fmt.Sprintf("SELECT version FROM %s WHERE id = $1", table), id).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, core.Conflict(table, id, "version %d is stale, current version is %d", version, stored)
+}
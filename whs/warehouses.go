@@ -2,9 +2,8 @@ package whs
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"github.com/lib/pq"
+	"github.com/mlplabs/mwms-core/core"
 	"github.com/mlplabs/mwms-core/whs/model"
 )
 
@@ -21,8 +20,8 @@ func NewWarehouses(s *Wms) *Warehouses {
 // GetWarehouses returns a list items without limit
 func (s *Storage) GetWarehouses(ctx context.Context) ([]model.Warehouse, error) {
 	items := make([]model.Warehouse, 0)
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s ORDER BY name ASC", tableWarehouses)
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel)
+	sqlSel := fmt.Sprintf("SELECT id, name, version FROM %s WHERE archived_at IS NULL ORDER BY name ASC", tableWarehouses)
+	rows, err := s.db().QueryContext(ctx, sqlSel)
 	if err != nil {
 		return items, err
 	}
@@ -30,7 +29,7 @@ func (s *Storage) GetWarehouses(ctx context.Context) ([]model.Warehouse, error)
 
 	for rows.Next() {
 		item := model.Warehouse{}
-		err = rows.Scan(&item.Id, &item.Name)
+		err = rows.Scan(&item.Id, &item.Name, &item.Version)
 		items = append(items, item)
 	}
 	return items, nil
@@ -40,7 +39,7 @@ func (s *Storage) GetWarehouses(ctx context.Context) ([]model.Warehouse, error)
 func (s *Storage) GetWarehousesItems(ctx context.Context, offset int, limit int) ([]model.Warehouse, int64, error) {
 	var totalCount int64
 	items := make([]model.Warehouse, 0)
-	sqlCond := ""
+	sqlCond := "WHERE archived_at IS NULL"
 	args := make([]any, 0)
 
 	if limit == 0 {
@@ -49,9 +48,9 @@ func (s *Storage) GetWarehousesItems(ctx context.Context, offset int, limit int)
 	args = append(args, limit)
 	args = append(args, offset)
 
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s %s ORDER BY name ASC", tableWarehouses, sqlCond)
+	sqlSel := fmt.Sprintf("SELECT id, name, version FROM %s %s ORDER BY name ASC", tableWarehouses, sqlCond)
 
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel+" LIMIT $1 OFFSET $2", args...)
+	rows, err := s.db().QueryContext(ctx, sqlSel+" LIMIT $1 OFFSET $2", args...)
 	if err != nil {
 		return items, totalCount, err
 	}
@@ -59,12 +58,12 @@ func (s *Storage) GetWarehousesItems(ctx context.Context, offset int, limit int)
 
 	for rows.Next() {
 		item := model.Warehouse{}
-		err = rows.Scan(&item.Id, &item.Name)
+		err = rows.Scan(&item.Id, &item.Name, &item.Version)
 		items = append(items, item)
 	}
 
 	sqlCount := fmt.Sprintf("SELECT COUNT(*) as count FROM ( %s ) sub", sqlSel)
-	err = s.wms.Db.QueryRowContext(ctx, sqlCount).Scan(&totalCount)
+	err = s.db().QueryRowContext(ctx, sqlCount).Scan(&totalCount)
 	if err != nil {
 		return nil, totalCount, err
 	}
@@ -72,9 +71,15 @@ func (s *Storage) GetWarehousesItems(ctx context.Context, offset int, limit int)
 }
 
 func (s *Storage) CreateWarehouse(ctx context.Context, whs *model.Warehouse) (int64, error) {
+	return s.created(ctx, model.EntityWarehouse, whs, func(s *Storage) (int64, error) {
+		return s.createWarehouse(ctx, whs)
+	})
+}
+
+func (s *Storage) createWarehouse(ctx context.Context, whs *model.Warehouse) (int64, error) {
 	var insertId int64
 
-	tx, err := s.wms.Db.Begin()
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return insertId, err
 	}
@@ -86,18 +91,7 @@ func (s *Storage) CreateWarehouse(ctx context.Context, whs *model.Warehouse) (in
 		return insertId, err
 	}
 
-	sqlStorage := fmt.Sprintf(
-		"create table if not exists wms%d ( "+
-			"doc_id   integer default 0 not null, "+
-			"doc_type smallint default 0 not null, "+
-			"row_id   varchar(36) default ''::character varying not null, "+
-			"row_time timestamptz default now() not null, "+
-			"zone_id  integer, "+
-			"cell_id  integer constraint wms%d_cells_id_fk references cells, "+
-			"prod_id  integer,	"+
-			"quantity integer ); "+
-			"alter table wms%d owner to %s;", whs.Id, whs.Id, whs.Id, s.wms.GetDbUser())
-	_, err = tx.Exec(sqlStorage)
+	err = s.wms.migrateLedger(ctx, tx, insertId)
 	if err != nil {
 		tx.Rollback()
 		return insertId, err
@@ -113,60 +107,55 @@ func (s *Storage) CreateWarehouse(ctx context.Context, whs *model.Warehouse) (in
 }
 
 func (s *Storage) UpdateWarehouse(ctx context.Context, whs *model.Warehouse) (int64, error) {
-	sqlUpd := fmt.Sprintf("UPDATE %s SET name=$2 WHERE id=$1", tableWarehouses)
-	res, err := s.wms.Db.ExecContext(ctx, sqlUpd, whs.Id, whs.Name)
-	if err != nil {
+	if err := CheckVersion(tableWarehouses, whs.Id, whs.Version); err != nil {
 		return 0, err
 	}
-	if a, err := res.RowsAffected(); a != 1 || err != nil {
+	return s.audited(ctx, model.EntityWarehouse, model.AuditUpdate, whs.Id, func(s *Storage) (int64, error) {
+		return s.updateWarehouse(ctx, whs)
+	})
+}
+
+func (s *Storage) updateWarehouse(ctx context.Context, whs *model.Warehouse) (int64, error) {
+	sqlUpd := fmt.Sprintf("UPDATE %s SET name=$2, version=version+1 WHERE id=$1 AND %s", tableWarehouses, versionCond(3))
+	res, err := s.db().ExecContext(ctx, sqlUpd, whs.Id, whs.Name, whs.Version)
+	if err != nil {
 		return 0, err
 	}
-	return whs.Id, nil
+	return s.updated(ctx, res, tableWarehouses, whs.Id, whs.Version)
 }
 
 // DeleteWarehouse delete warehouse
 func (s *Storage) DeleteWarehouse(ctx context.Context, itemId int64) error {
 	if itemId == 0 {
-		return fmt.Errorf("unacceptable action. item id eq 0")
-	}
-	sqlDel := fmt.Sprintf("DELETE FROM %s WHERE id=$1", tableWarehouses)
-	_, err := s.wms.Db.ExecContext(ctx, sqlDel, itemId)
-	if err != nil {
-		var pgErr *pq.Error
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == ("23503") {
-				return err
-			}
-		}
-		return err
+		return core.Validation(tableWarehouses, 0, "unacceptable action. item id eq 0")
 	}
-	return nil
+	return s.deleteEntity(ctx, model.EntityWarehouse, itemId)
 }
 
 // GetWarehouseById returns a warehouse object by id
 func (s *Storage) GetWarehouseById(ctx context.Context, itemId int64) (*model.Warehouse, error) {
 	item := model.Warehouse{}
-	sqlWhs := fmt.Sprintf("SELECT id, name, address FROM %s WHERE id = $1", tableWarehouses)
-	row := s.wms.Db.QueryRowContext(ctx, sqlWhs, itemId)
+	sqlWhs := fmt.Sprintf("SELECT id, name, address, archived_at, version FROM %s WHERE id = $1", tableWarehouses)
+	row := s.db().QueryRowContext(ctx, sqlWhs, itemId)
 
-	err := row.Scan(&item.Id, &item.Name, &item.Address)
+	err := row.Scan(&item.Id, &item.Name, &item.Address, scanNullTime(&item.ArchivedAt), &item.Version)
 	if err != nil {
-		return &item, err
+		return nil, core.Translate(tableWarehouses, itemId, err)
 	}
 	return &item, nil
 }
 
 func (s *Storage) FindWarehousesByName(ctx context.Context, itemName string) ([]model.Warehouse, error) {
 	items := make([]model.Warehouse, 0)
-	sql := fmt.Sprintf("SELECT id, name FROM %s WHERE name = $1", tableWarehouses)
-	rows, err := s.wms.Db.QueryContext(ctx, sql, itemName)
+	sql := fmt.Sprintf("SELECT id, name, version FROM %s WHERE name = $1", tableWarehouses)
+	rows, err := s.db().QueryContext(ctx, sql, itemName)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		item := model.Warehouse{}
-		err = rows.Scan(&item.Id, &item.Name)
+		err = rows.Scan(&item.Id, &item.Name, &item.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -181,8 +170,8 @@ func (s *Storage) WarehousesSuggest(ctx context.Context, text string, limit int)
 		limit = DefaultSuggestionLimit
 	}
 
-	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE name ILIKE $1 LIMIT $2", tableWarehouses)
-	rows, err := s.wms.Db.QueryContext(ctx, sqlSel, text+"%", limit)
+	sqlSel := fmt.Sprintf("SELECT id, name FROM %s WHERE %s AND archived_at IS NULL LIMIT $2", tableWarehouses, s.wms.ilike("name", "$1"))
+	rows, err := s.db().QueryContext(ctx, sqlSel, text+"%", limit)
 	if err != nil {
 		return retVal, err
 	}
@@ -0,0 +1,177 @@
+package whs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mlplabs/mwms-core/core"
+	"github.com/mlplabs/mwms-core/whs/model"
+	"time"
+)
+
+const tableWaves = "waves"
+
+// CreateWaves планирует волны из заказов orders склада whsId, формирует сводные листы отбора
+// по свободным остаткам (без зарезервированных открытыми волнами, см. Wave.HoldsStock)
+// и сохраняет волны в статусе WaveStatusPlanned. Учитывает ключ идемпотентности контекста (WithIdempotencyKey)
+func (s *Storage) CreateWaves(ctx context.Context, whsId int64, orders []model.OutboundOrder, opts model.WaveOptions) ([]model.Wave, error) {
+	request := struct {
+		WhsId  int64                 `json:"whs_id"`
+		Orders []model.OutboundOrder `json:"orders"`
+		Opts   model.WaveOptions     `json:"opts"`
+	}{whsId, orders, opts}
+	return idempotent(s, ctx, "create waves", request, func(ctx context.Context, s *Storage) ([]model.Wave, error) {
+		return s.createWaves(ctx, whsId, orders, opts)
+	})
+}
+
+func (s *Storage) createWaves(ctx context.Context, whsId int64, orders []model.OutboundOrder, opts model.WaveOptions) ([]model.Wave, error) {
+	waves, err := model.PlanWaves(orders, opts)
+	if err != nil {
+		return nil, err
+	}
+	productIds := make([]int64, 0)
+	for _, o := range orders {
+		for _, r := range o.Rows {
+			productIds = append(productIds, r.Product.Id)
+		}
+	}
+	userId, terminal, err := actorOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.unit(ctx, func(s *Storage) error {
+		// планирования волн склада выполняются последовательно, иначе оба резервируют одни остатки
+		if err := s.lock(ctx, s.tx.sqlTx, fmt.Sprintf("%s%d", tableWaves, whsId)); err != nil {
+			return err
+		}
+		stock, err := s.GetCellStocks(ctx, whsId, productIds)
+		if err != nil {
+			return err
+		}
+		pool := model.NewStockPool(stock)
+		open, err := s.GetWaves(ctx, whsId, -1)
+		if err != nil {
+			return err
+		}
+		for i := range open {
+			if open[i].HoldsStock() {
+				pool.Exclude(open[i].Allocations())
+			}
+		}
+
+		sqlIns := fmt.Sprintf("INSERT INTO %s (whs_id, status, plan, user_id, terminal) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at", tableWaves)
+		for i := range waves {
+			w := &waves[i]
+			w.WhsId, w.UserId, w.Terminal = whsId, userId, terminal
+			w.Batch(pool, opts.Pickers)
+			plan, err := json.Marshal(w)
+			if err != nil {
+				return err
+			}
+			err = s.db().QueryRowContext(ctx, sqlIns, whsId, w.Status, string(plan), userId, terminal).Scan(&w.Id, scanTime(&w.CreatedAt), scanTime(&w.UpdatedAt))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return waves, nil
+}
+
+// GetWaveById возвращает волну с листами отбора и планом сортировки
+func (s *Storage) GetWaveById(ctx context.Context, waveId int64) (*model.Wave, error) {
+	sqlSel := fmt.Sprintf("SELECT id, whs_id, status, plan, user_id, terminal, status_user_id, status_terminal, created_at, updated_at FROM %s WHERE id = $1", tableWaves)
+	w, err := s.scanWave(s.db().QueryRowContext(ctx, sqlSel, waveId))
+	if err != nil {
+		return nil, core.Translate(tableWaves, waveId, err)
+	}
+	return w, nil
+}
+
+// GetWaves возвращает волны склада whsId в статусе status (-1 - в любом статусе)
+func (s *Storage) GetWaves(ctx context.Context, whsId int64, status int) ([]model.Wave, error) {
+	items := make([]model.Wave, 0)
+	sqlSel := fmt.Sprintf("SELECT id, whs_id, status, plan, user_id, terminal, status_user_id, status_terminal, created_at, updated_at FROM %s "+
+		"WHERE whs_id = $1 AND ($2 = -1 OR status = $2) ORDER BY id", tableWaves)
+	rows, err := s.db().QueryContext(ctx, sqlSel, whsId, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		w, err := s.scanWave(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *w)
+	}
+	return items, rows.Err()
+}
+
+// SetWaveStatus переводит волну в статус status с проверкой допустимости перехода
+// Пользователь и терминал контекста (WithActor) сохраняются как автор изменения статуса
+// Повтор с тем же ключом идемпотентности контекста не меняет статус повторно и не возвращает ошибку перехода
+func (s *Storage) SetWaveStatus(ctx context.Context, waveId int64, status int) error {
+	request := struct {
+		WaveId int64 `json:"wave_id"`
+		Status int   `json:"status"`
+	}{waveId, status}
+	_, err := idempotent(s, ctx, "set wave status", request, func(ctx context.Context, s *Storage) (struct{}, error) {
+		return struct{}{}, s.setWaveStatus(ctx, waveId, status)
+	})
+	return err
+}
+
+func (s *Storage) setWaveStatus(ctx context.Context, waveId int64, status int) error {
+	userId, terminal, err := actorOf(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	var current int
+	sqlSel := fmt.Sprintf("SELECT status FROM %s WHERE id = $1%s", tableWaves, s.wms.forUpdate())
+	if err = tx.QueryRowContext(ctx, sqlSel, waveId).Scan(&current); err != nil {
+		_ = tx.Rollback()
+		return core.Translate(tableWaves, waveId, err)
+	}
+	if !model.CanChangeWaveStatus(current, status) {
+		_ = tx.Rollback()
+		return core.Conflict(tableWaves, waveId, "can not change status from %d to %d", current, status)
+	}
+	sqlUpd := fmt.Sprintf("UPDATE %s SET status = $2, status_user_id = $3, status_terminal = $4, updated_at = %s WHERE id = $1", tableWaves, s.wms.now())
+	if _, err = tx.ExecContext(ctx, sqlUpd, waveId, status, userId, terminal); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (s *Storage) scanWave(row rowScanner) (*model.Wave, error) {
+	var plan []byte
+	var id, whsId, userId, statusUserId int64
+	var status int
+	var terminal, statusTerminal string
+	var createdAt, updatedAt time.Time
+	err := row.Scan(&id, &whsId, &status, &plan, &userId, &terminal, &statusUserId, &statusTerminal, scanTime(&createdAt), scanTime(&updatedAt))
+	if err != nil {
+		return nil, err
+	}
+	w := model.Wave{}
+	if err = json.Unmarshal(plan, &w); err != nil {
+		return nil, err
+	}
+	w.Id, w.WhsId, w.Status, w.CreatedAt, w.UpdatedAt = id, whsId, status, createdAt, updatedAt
+	w.UserId, w.Terminal, w.StatusUserId, w.StatusTerminal = userId, terminal, statusUserId, statusTerminal
+	return &w, nil
+}
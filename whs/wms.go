@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/mlplabs/mwms-core/whs/model"
+	"time"
 )
 
 // SpecificSize структура весогабаритных характеристик (см/см3/кг)
@@ -43,8 +44,9 @@ const (
 )
 
 type Wms struct {
-	Db     *sql.DB
-	dbUser string
+	Db           *sql.DB
+	KeyRetention time.Duration // срок хранения ключей идемпотентности, 0 - DefaultKeyRetention
+	dialect      Dialect
 }
 
 var (
@@ -58,26 +60,32 @@ func NewWms(db *sql.DB) *Wms {
 	}
 }
 
-func (w *Wms) GetDbUser() string {
-	return w.dbUser
+// NewWmsDialect создает Wms для базы данных с диалектом SQL dialect
+// Для SQLite удобнее использовать sqlite.Open, который также настраивает соединение и схему
+func NewWmsDialect(db *sql.DB, dialect Dialect) *Wms {
+	return &Wms{
+		Db:      db,
+		dialect: dialect,
+	}
 }
 
 func (w *Wms) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	return w.Db.Query(query, args...)
 }
 
+// GetCellInfo возвращает адрес, запреты движения и ограничения веса/объема ячейки. Если tx не задан, запрос выполняется вне транзакции
 func (w *Wms) GetCellInfo(ctx context.Context, cellId int64, tx *sql.Tx) (*model.Cell, error) {
-	var err error
+	var row *sql.Row
+	sqlCell := "SELECT cs.id, cs.name, cs.whs_id, cs.zone_id, cs.passage_id, cs.rack_id, cs.floor, cs.not_allowed_in, cs.not_allowed_out, " +
+		"cs.is_size_free, cs.is_weight_free, cs.max_weight, cs.max_volume FROM cells cs WHERE cs.id = $1"
+	c := model.Cell{}
 	if tx == nil {
-		tx, err = w.Db.Begin()
-		if err != nil {
-			return nil, err
-		}
+		row = w.Db.QueryRowContext(ctx, sqlCell, cellId)
+	} else {
+		row = tx.QueryRowContext(ctx, sqlCell, cellId)
 	}
-	sqlCell := "SELECT cs.id, cs.name, cs.whs_id, cs.zone_id, cs.passage_id, cs.rack_id, cs.floor FROM cells cs WHERE cs.id = $1"
-	c := model.Cell{}
-	row := tx.QueryRowContext(ctx, sqlCell, cellId)
-	err = row.Scan(&c.Id, &c.Name, &c.WhsId, &c.ZoneId, &c.PassageId, &c.RackId, &c.Floor)
+	err := row.Scan(&c.Id, &c.Name, &c.WhsId, &c.ZoneId, &c.PassageId, &c.RackId, &c.Floor, &c.NotAllowedIn, &c.NotAllowedOut,
+		&c.IsSizeFree, &c.IsWeightFree, &c.MaxWeight, &c.MaxVolume)
 	if c.Name == "" {
 		c.Name = c.GetNumericView()
 	}